@@ -0,0 +1,43 @@
+// This package defines the types for Flux API version 12.
+package v12
+
+import (
+	"context"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// ResourceStatus describes a resource defined in the repo, and what
+// happened when it was last synced.
+type ResourceStatus struct {
+	ID flux.ResourceID
+	// The file in the repo in which the resource is defined
+	Source string
+	// The revision of the repo at which the resource was last applied
+	// without error; empty if it hasn't been, since fluxd started
+	LastAppliedRevision string
+	// The error, if any, from the most recent attempt to apply the
+	// resource
+	SyncError string
+	// Whether the resource is ignored by policy, and therefore not
+	// applied
+	Ignore bool
+}
+
+type Server interface {
+	v11.Server
+
+	// SyncDryRun reports what a sync of the current HEAD would do to
+	// the cluster, without doing it.
+	SyncDryRun(ctx context.Context) ([]cluster.ResourceChange, error)
+	// ListResources reports on all the resources defined in the repo,
+	// of any kind; the namespace, if not empty, restricts this to the
+	// resources in that namespace.
+	ListResources(ctx context.Context, namespace string) ([]ResourceStatus, error)
+}
+
+type Upstream interface {
+	v11.Upstream
+}
@@ -23,11 +23,13 @@ type ImageStatus struct {
 type ReadOnlyReason string
 
 const (
-	ReadOnlyOK       ReadOnlyReason = ""
-	ReadOnlyMissing  ReadOnlyReason = "NotInRepo"
-	ReadOnlySystem   ReadOnlyReason = "System"
-	ReadOnlyNoRepo   ReadOnlyReason = "NoRepo"
-	ReadOnlyNotReady ReadOnlyReason = "NotReady"
+	ReadOnlyOK        ReadOnlyReason = ""
+	ReadOnlyMissing   ReadOnlyReason = "NotInRepo"
+	ReadOnlySystem    ReadOnlyReason = "System"
+	ReadOnlyNoRepo    ReadOnlyReason = "NoRepo"
+	ReadOnlyNotReady  ReadOnlyReason = "NotReady"
+	ReadOnlyMode      ReadOnlyReason = "ReadOnlyMode"
+	ReadOnlySubmodule ReadOnlyReason = "Submodule"
 )
 
 type ControllerStatus struct {
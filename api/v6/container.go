@@ -36,24 +36,12 @@ func NewContainer(name string, images update.ImageInfos, currentImage image.Info
 	if sorted == nil {
 		imagesErr = registry.ErrNoImageData.Error()
 	}
-	var newImages update.SortedImageInfos
-	for _, img := range sorted {
-		if tagPattern.Newer(&img, &currentImage) {
-			newImages = append(newImages, img)
-		}
-	}
-	newImagesCount := len(newImages)
+	newImagesCount := len(sorted.NewerThan(currentImage, tagPattern))
 
 	// Filtered images
 	filteredImages := sorted.Filter(tagPattern)
 	filteredImagesCount := len(filteredImages)
-	var newFilteredImages update.SortedImageInfos
-	for _, img := range filteredImages {
-		if tagPattern.Newer(&img, &currentImage) {
-			newFilteredImages = append(newFilteredImages, img)
-		}
-	}
-	newFilteredImagesCount := len(newFilteredImages)
+	newFilteredImagesCount := len(filteredImages.NewerThan(currentImage, tagPattern))
 	latestFiltered, _ := filteredImages.Latest()
 
 	container := Container{
@@ -29,6 +29,9 @@ type Cluster interface {
 	SomeControllers([]flux.ResourceID) ([]Controller, error)
 	Ping() error
 	Export() ([]byte, error)
+	// Export the resources that were applied as part of the named
+	// sync set, i.e., those that may be garbage collected.
+	ExportSyncSet(syncSetName string) ([]byte, error)
 	Sync(SyncDef) error
 	PublicSSHKey(regenerate bool) (ssh.PublicKey, error)
 }
@@ -0,0 +1,391 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// The annotation kubectl uses to record what was last applied; using
+// the same one means the appliers can be swapped without upsetting
+// the three-way merge either of them does.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// The number of objects applied at once, by default
+const defaultApplyParallelism = 8
+
+// ClientApplier applies changesets by talking to the API server
+// directly, rather than by running kubectl. Each object is applied
+// individually, so errors are always attributed to the object that
+// caused them. Objects of the same rank (see rankOfKind) don't depend
+// on each other, so they are applied in parallel, up to
+// `Parallelism` at a time.
+type ClientApplier struct {
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+
+	Parallelism int
+
+	mu       sync.Mutex
+	mappings map[schema.GroupVersionKind]meta_v1.APIResource
+}
+
+func NewClientApplier(client dynamic.Interface, discovery discovery.DiscoveryInterface) *ClientApplier {
+	return &ClientApplier{
+		client:      client,
+		discovery:   discovery,
+		Parallelism: defaultApplyParallelism,
+		mappings:    map[schema.GroupVersionKind]meta_v1.APIResource{},
+	}
+}
+
+type applyFunc func(*unstructured.Unstructured, meta_v1.APIResource) error
+
+func (c *ClientApplier) apply(logger log.Logger, cs changeSet, errored map[flux.ResourceID]error) (errs cluster.SyncError) {
+	f := func(objs []*apiObject, cmd string, do applyFunc) {
+		if len(objs) == 0 {
+			return
+		}
+		begin := time.Now()
+		for _, stage := range stagesOf(objs) {
+			errs = append(errs, c.applyStage(stage, do)...)
+		}
+		logger.Log("cmd", cmd, "count", len(objs), "took", time.Since(begin))
+	}
+
+	// Deletes go in reverse order, for the same reason as with
+	// kubectl; see Kubectl.apply.
+	objs := cs.objs["delete"]
+	sort.Sort(sort.Reverse(applyOrder(objs)))
+	f(objs, "delete", c.delete)
+
+	objs = cs.objs["apply"]
+	sort.Sort(applyOrder(objs))
+	f(objs, "apply", c.applyOne)
+	return errs
+}
+
+// stagesOf splits objects, sorted by applyOrder, into runs of the
+// same rank.
+func stagesOf(objs []*apiObject) [][]*apiObject {
+	var stages [][]*apiObject
+	start := 0
+	for i := 1; i <= len(objs); i++ {
+		if i == len(objs) || rankOfKind(objs[i].Kind) != rankOfKind(objs[start].Kind) {
+			stages = append(stages, objs[start:i])
+			start = i
+		}
+	}
+	return stages
+}
+
+// applyStage applies each of the objects given, in parallel, and
+// returns the errors in the same order as the objects.
+func (c *ClientApplier) applyStage(objs []*apiObject, do applyFunc) cluster.SyncError {
+	parallelism := c.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := make([]error, len(objs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range objs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = c.applyObj(objs[i], do)
+		}(i)
+	}
+	wg.Wait()
+
+	var errs cluster.SyncError
+	for i, err := range results {
+		if err != nil {
+			errs = append(errs, cluster.ResourceError{Resource: objs[i].Resource, Error: err})
+		}
+	}
+	return errs
+}
+
+// applyObj prepares and applies a single object. If the API doesn't
+// know about the kind of object -- it may have been removed or
+// replaced, e.g., by changing a custom resource definition, since it
+// was looked up -- what's known about kinds is forgotten, and it's
+// tried once more.
+func (c *ClientApplier) applyObj(obj *apiObject, do applyFunc) error {
+	u, mapping, err := c.prepare(obj)
+	if err == nil {
+		err = do(u, mapping)
+	}
+	if !isNoMatch(err) {
+		return err
+	}
+	c.resetMappings()
+	u, mapping, err = c.prepare(obj)
+	if err != nil {
+		return err
+	}
+	return do(u, mapping)
+}
+
+// prepare parses the object's definition, and finds out how to address
+// it in the API.
+func (c *ClientApplier) prepare(obj *apiObject) (*unstructured.Unstructured, meta_v1.APIResource, error) {
+	u := &unstructured.Unstructured{}
+	if err := k8syaml.Unmarshal(obj.Bytes(), &u.Object); err != nil {
+		return nil, meta_v1.APIResource{}, errors.Wrap(err, "parsing definition")
+	}
+	mapping, err := c.lookup(u.GroupVersionKind())
+	if err != nil {
+		return nil, meta_v1.APIResource{}, err
+	}
+	if mapping.Namespaced && u.GetNamespace() == "" {
+		u.SetNamespace("default")
+	}
+	return u, mapping, nil
+}
+
+// lookup finds the API resource for a kind, using discovery. Results
+// are cached, since the set of kinds rarely changes; but kinds not
+// found are looked up afresh each time, since they may be custom
+// resources whose definition has only just been applied, and the
+// cache is reset when it turns out to be out of date (see applyObj).
+func (c *ClientApplier) lookup(gvk schema.GroupVersionKind) (meta_v1.APIResource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if mapping, ok := c.mappings[gvk]; ok {
+		return mapping, nil
+	}
+
+	gv := gvk.GroupVersion()
+	resources, err := c.discovery.ServerResourcesForGroupVersion(gv.String())
+	if apierrors.IsNotFound(err) {
+		return meta_v1.APIResource{}, noMatchError{gvk}
+	}
+	if err != nil {
+		return meta_v1.APIResource{}, errors.Wrap(err, fmt.Sprintf("discovering resources for %s", gv))
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind != gvk.Kind || strings.Contains(resource.Name, "/") {
+			continue
+		}
+		resource.Group, resource.Version = gv.Group, gv.Version
+		c.mappings[gvk] = resource
+		return resource, nil
+	}
+	return meta_v1.APIResource{}, noMatchError{gvk}
+}
+
+// resetMappings forgets what's been found out about kinds, so they're
+// looked up afresh.
+func (c *ClientApplier) resetMappings() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mappings = map[schema.GroupVersionKind]meta_v1.APIResource{}
+	if cached, ok := c.discovery.(discovery.CachedDiscoveryInterface); ok {
+		cached.Invalidate()
+	}
+}
+
+// noMatchError is returned when there's no API resource for a kind.
+type noMatchError struct {
+	gvk schema.GroupVersionKind
+}
+
+func (e noMatchError) Error() string {
+	return fmt.Sprintf("no resource for kind %s in API %s", e.gvk.Kind, e.gvk.GroupVersion())
+}
+
+// isNoMatch says whether an error means the API doesn't know about a
+// kind of object: either discovery didn't find it, or the API said
+// there's no such resource, as distinct from no such object (which
+// comes with the name of the object).
+func isNoMatch(err error) bool {
+	if _, ok := err.(noMatchError); ok {
+		return true
+	}
+	if !apierrors.IsNotFound(err) {
+		return false
+	}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok {
+		return false
+	}
+	details := status.Status().Details
+	return details == nil || details.Name == ""
+}
+
+func (c *ClientApplier) resourceClient(u *unstructured.Unstructured, mapping meta_v1.APIResource) dynamic.ResourceInterface {
+	client := c.client.Resource(schema.GroupVersionResource{
+		Group:    mapping.Group,
+		Version:  mapping.Version,
+		Resource: mapping.Name,
+	})
+	if mapping.Namespaced {
+		return client.Namespace(u.GetNamespace())
+	}
+	return client
+}
+
+func (c *ClientApplier) delete(u *unstructured.Unstructured, mapping meta_v1.APIResource) error {
+	propagation := meta_v1.DeletePropagationBackground
+	err := c.resourceClient(u, mapping).Delete(u.GetName(), &meta_v1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		// It's gone, which is what we wanted
+		return nil
+	}
+	return err
+}
+
+// applyOne creates the object if it doesn't exist, and otherwise
+// patches it with the difference between what was last applied,
+// what's to be applied now, and what's in the cluster -- as `kubectl
+// apply` does.
+func (c *ClientApplier) applyOne(u *unstructured.Unstructured, mapping meta_v1.APIResource) error {
+	modified, err := setLastApplied(u)
+	if err != nil {
+		return err
+	}
+
+	client := c.resourceClient(u, mapping)
+	current, err := client.Get(u.GetName(), meta_v1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = client.Create(u)
+		return err
+	case err != nil:
+		return err
+	}
+
+	currentJSON, err := json.Marshal(current.Object)
+	if err != nil {
+		return err
+	}
+	original := []byte(current.GetAnnotations()[lastAppliedAnnotation])
+
+	var patch []byte
+	var patchType types.PatchType
+	gvk := u.GroupVersionKind()
+	if versioned, err := scheme.Scheme.New(gvk); err == nil {
+		// A built-in type; these get strategic merge patches, which
+		// know how to merge lists (e.g., of containers) by key.
+		lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return err
+		}
+		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, currentJSON, lookupPatchMeta, true)
+		if err != nil {
+			return errors.Wrap(err, "creating patch")
+		}
+		patchType = types.StrategicMergePatchType
+	} else {
+		// Custom resources can only be patched with plain JSON merge
+		// patches.
+		patch, err = threeWayMergePatch(original, modified, currentJSON)
+		if err != nil {
+			return errors.Wrap(err, "creating patch")
+		}
+		patchType = types.MergePatchType
+	}
+
+	if string(patch) == "{}" {
+		return nil
+	}
+	_, err = client.Patch(u.GetName(), patchType, patch)
+	return err
+}
+
+// setLastApplied records the definition of the object in the
+// last-applied annotation, and returns the resulting definition as
+// JSON.
+func setLastApplied(u *unstructured.Unstructured) ([]byte, error) {
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	delete(annotations, lastAppliedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	u.SetAnnotations(annotations)
+	lastApplied, err := json.Marshal(u.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastAppliedAnnotation] = string(lastApplied)
+	u.SetAnnotations(annotations)
+	return json.Marshal(u.Object)
+}
+
+// threeWayMergePatch calculates a JSON merge patch (RFC 7386) that
+// will make current agree with modified; and, remove anything that
+// was in original but is no longer in modified.
+func threeWayMergePatch(original, modified, current []byte) ([]byte, error) {
+	var originalObj, modifiedObj, currentObj map[string]interface{}
+	if len(original) > 0 {
+		if err := json.Unmarshal(original, &originalObj); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(modified, &modifiedObj); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(current, &currentObj); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(originalObj, modifiedObj, currentObj))
+}
+
+func mergePatch(original, modified, current map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, v := range modified {
+		cur, inCurrent := current[k]
+		vmap, vIsMap := v.(map[string]interface{})
+		curmap, curIsMap := cur.(map[string]interface{})
+		if vIsMap && curIsMap {
+			orig, _ := original[k].(map[string]interface{})
+			if sub := mergePatch(orig, vmap, curmap); len(sub) > 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !inCurrent || !reflect.DeepEqual(v, cur) {
+			patch[k] = v
+		}
+	}
+	// Anything we applied before, but don't any more, gets removed
+	for k := range original {
+		if _, ok := modified[k]; ok {
+			continue
+		}
+		if _, ok := current[k]; ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
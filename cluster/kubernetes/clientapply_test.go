@@ -0,0 +1,402 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/weaveworks/flux"
+)
+
+func makeTestObj(t *testing.T, id, def string) *apiObject {
+	obj, err := parseObj([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Resource = rsc{id, []byte(def)}
+	return obj
+}
+
+// setupClientApplier returns an applier with a fake API behind it,
+// and a pointer to the record of what was done (other than getting
+// objects, which is done for every apply).
+func setupClientApplier() (*ClientApplier, *[]string) {
+	discovery := &discoveryfake.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	discovery.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "namespaces", Kind: "Namespace"},
+				{Name: "services", Kind: "Service", Namespaced: true},
+				{Name: "services/status", Kind: "Service", Namespaced: true},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			},
+		},
+	}
+
+	var done []string
+	client := &dynamicfake.FakeDynamicClient{}
+	client.AddReactor("get", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		return true, nil, apierrors.NewNotFound(get.GetResource().GroupResource(), get.GetName())
+	})
+	client.AddReactor("create", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if obj.GetName() == "broken" {
+			return true, nil, errors.New("rejected")
+		}
+		done = append(done, "create "+action.GetResource().Resource+" "+action.GetNamespace()+"/"+obj.GetName())
+		return true, nil, nil
+	})
+	client.AddReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		del := action.(k8stesting.DeleteAction)
+		done = append(done, "delete "+action.GetResource().Resource+" "+action.GetNamespace()+"/"+del.GetName())
+		return true, nil, nil
+	})
+	return NewClientApplier(client, discovery), &done
+}
+
+func TestClientApplyOrder(t *testing.T) {
+	applier, done := setupClientApplier()
+
+	cs := makeChangeSet()
+	cs.stage("apply", makeTestObj(t, "default:deployment/app", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+`))
+	cs.stage("apply", makeTestObj(t, "default:service/app", `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`))
+	cs.stage("apply", makeTestObj(t, "<cluster>:namespace/default", `apiVersion: v1
+kind: Namespace
+metadata:
+  name: default
+`))
+	cs.stage("delete", makeTestObj(t, "<cluster>:namespace/old", `apiVersion: v1
+kind: Namespace
+metadata:
+  name: old
+`))
+	cs.stage("delete", makeTestObj(t, "old:configmap/config", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: old
+`))
+
+	if errs := applier.apply(log.NewNopLogger(), cs, nil); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expected := []string{
+		"delete configmaps old/config",
+		"delete namespaces /old",
+		"create namespaces /default",
+		"create services default/app",
+		"create deployments default/app",
+	}
+	if !reflect.DeepEqual(expected, *done) {
+		t.Errorf("expected actions:\n%v\ngot:\n%v", expected, *done)
+	}
+}
+
+func TestClientApplyErrors(t *testing.T) {
+	applier, done := setupClientApplier()
+
+	cs := makeChangeSet()
+	cs.stage("apply", makeTestObj(t, "default:service/broken", `apiVersion: v1
+kind: Service
+metadata:
+  name: broken
+`))
+	cs.stage("apply", makeTestObj(t, "default:widget/unknown", `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: unknown
+`))
+	cs.stage("apply", makeTestObj(t, "default:configmap/fine", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fine
+`))
+
+	errs := applier.apply(log.NewNopLogger(), cs, nil)
+	failed := map[flux.ResourceID]bool{}
+	for _, err := range errs {
+		failed[err.ResourceID()] = true
+	}
+	expectedFailed := map[flux.ResourceID]bool{
+		flux.MustParseResourceID("default:service/broken"): true,
+		flux.MustParseResourceID("default:widget/unknown"): true,
+	}
+	if !reflect.DeepEqual(expectedFailed, failed) {
+		t.Errorf("expected errors for %v, got %v", expectedFailed, errs)
+	}
+	// The failures shouldn't stop the rest from being applied
+	if expected := []string{"create configmaps default/fine"}; !reflect.DeepEqual(expected, *done) {
+		t.Errorf("expected actions %v, got %v", expected, *done)
+	}
+}
+
+func TestClientApplyResetsMappings(t *testing.T) {
+	applier, done := setupClientApplier()
+	discovery := applier.discovery.(*discoveryfake.FakeDiscovery)
+	discovery.Resources = append(discovery.Resources, &meta_v1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []meta_v1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true}},
+	})
+	// Once the resource has been renamed, the API doesn't know the
+	// old name
+	renamed := false
+	applier.client.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if renamed {
+			return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "example.com", Resource: "widgets"}, "")
+		}
+		return false, nil, nil
+	})
+
+	widget := `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: thing
+`
+	cs := makeChangeSet()
+	cs.stage("apply", makeTestObj(t, "default:widget/thing", widget))
+	if errs := applier.apply(log.NewNopLogger(), cs, nil); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	renamed = true
+	discovery.Resources[len(discovery.Resources)-1].APIResources[0].Name = "gadgets"
+	if errs := applier.apply(log.NewNopLogger(), cs, nil); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expected := []string{"create widgets default/thing", "create gadgets default/thing"}
+	if !reflect.DeepEqual(expected, *done) {
+		t.Errorf("expected actions %v, got %v", expected, *done)
+	}
+}
+
+func TestStagesOf(t *testing.T) {
+	var objs []*apiObject
+	for _, kind := range []string{"Namespace", "Service", "ServiceAccount", "Deployment", "DaemonSet"} {
+		def := fmt.Sprintf("apiVersion: v1\nkind: %s\nmetadata:\n  name: thing\n", kind)
+		objs = append(objs, makeTestObj(t, "default:"+kind+"/thing", def))
+	}
+	var sizes []int
+	for _, stage := range stagesOf(objs) {
+		sizes = append(sizes, len(stage))
+	}
+	if expected := []int{1, 2, 2}; !reflect.DeepEqual(expected, sizes) {
+		t.Errorf("expected stages of sizes %v, got %v", expected, sizes)
+	}
+}
+
+func benchChangeSet(b *testing.B, namespace string, n, iteration int) changeSet {
+	cs := makeChangeSet()
+	for i := 0; i < n; i++ {
+		def := fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-%d
+  namespace: %s
+data:
+  iteration: "%d"
+`, i, namespace, iteration)
+		obj, err := parseObj([]byte(def))
+		if err != nil {
+			b.Fatal(err)
+		}
+		obj.Resource = rsc{fmt.Sprintf("%s:configmap/config-%d", namespace, i), []byte(def)}
+		cs.stage("apply", obj)
+	}
+	return cs
+}
+
+// BenchmarkClientApplyParallelism applies objects through an API that
+// takes a while to respond to each request, as a real one does, to
+// show the effect of applying objects in parallel.
+func BenchmarkClientApplyParallelism(b *testing.B) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404, "details": {"name": %q, "kind": "configmaps"}}`, path.Base(r.URL.Path))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	}))
+	defer api.Close()
+	client, err := dynamic.NewForConfig(&rest.Config{Host: api.URL})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, parallelism := range []int{1, defaultApplyParallelism} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			applier, _ := setupClientApplier()
+			applier.client = client
+			applier.Parallelism = parallelism
+			for i := 0; i < b.N; i++ {
+				if errs := applier.apply(log.NewNopLogger(), benchChangeSet(b, "default", 50, i), nil); len(errs) > 0 {
+					b.Fatal(errs)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkApply compares the client applier with kubectl, applying
+// changes to the same objects in a real cluster. It runs only if
+// FLUX_BENCH_KUBECONFIG names a kubeconfig file, and kubectl is on the
+// PATH. The objects are put in the namespace flux-apply-bench, which
+// is deleted afterwards.
+func BenchmarkApply(b *testing.B) {
+	kubeconfig := os.Getenv("FLUX_BENCH_KUBECONFIG")
+	if kubeconfig == "" {
+		b.Skip("FLUX_BENCH_KUBECONFIG not set")
+	}
+	exe, err := exec.LookPath("kubectl")
+	if err != nil {
+		b.Skip("kubectl not found")
+	}
+	// kubectl is given the server and some credentials as arguments,
+	// and gets anything else from the kubeconfig
+	os.Setenv("KUBECONFIG", kubeconfig)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	const namespace = "flux-apply-bench"
+	ns, err := parseObj([]byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: " + namespace + "\n"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	ns.Resource = rsc{"<cluster>:namespace/" + namespace, ns.Bytes()}
+	setup, teardown := makeChangeSet(), makeChangeSet()
+	setup.stage("apply", ns)
+	teardown.stage("delete", ns)
+
+	for _, a := range []struct {
+		name    string
+		applier Applier
+	}{
+		{"kubectl", NewKubectl(exe, config)},
+		{"client", NewClientApplier(client, disco)},
+	} {
+		b.Run(a.name, func(b *testing.B) {
+			if errs := a.applier.apply(log.NewNopLogger(), setup, nil); len(errs) > 0 {
+				b.Fatal(errs)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if errs := a.applier.apply(log.NewNopLogger(), benchChangeSet(b, namespace, 50, i), nil); len(errs) > 0 {
+					b.Fatal(errs)
+				}
+			}
+		})
+	}
+	NewClientApplier(client, disco).apply(log.NewNopLogger(), teardown, nil)
+}
+
+func TestThreeWayMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		name                        string
+		original, modified, current string
+		expected                    string
+	}{
+		{
+			name:     "no change",
+			original: `{"spec":{"replicas":1}}`,
+			modified: `{"spec":{"replicas":1}}`,
+			current:  `{"spec":{"replicas":1},"status":{"ready":1}}`,
+			expected: `{}`,
+		},
+		{
+			name:     "changed field",
+			original: `{"spec":{"replicas":1}}`,
+			modified: `{"spec":{"replicas":2}}`,
+			current:  `{"spec":{"replicas":1}}`,
+			expected: `{"spec":{"replicas":2}}`,
+		},
+		{
+			name:     "field no longer applied",
+			original: `{"spec":{"replicas":1,"paused":true}}`,
+			modified: `{"spec":{"replicas":1}}`,
+			current:  `{"spec":{"replicas":1,"paused":true}}`,
+			expected: `{"spec":{"paused":null}}`,
+		},
+		{
+			name:     "field never applied",
+			modified: `{"spec":{"replicas":1}}`,
+			current:  `{"spec":{"replicas":1,"paused":true}}`,
+			expected: `{}`,
+		},
+		{
+			name:     "field changed in cluster",
+			original: `{"spec":{"size":"small"}}`,
+			modified: `{"spec":{"size":"small"}}`,
+			current:  `{"spec":{"size":"large"}}`,
+			expected: `{"spec":{"size":"small"}}`,
+		},
+	} {
+		patch, err := threeWayMergePatch([]byte(c.original), []byte(c.modified), []byte(c.current))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var got, expected interface{}
+		if err := json.Unmarshal(patch, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(c.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected patch %s, got %s", c.name, c.expected, patch)
+		}
+	}
+}
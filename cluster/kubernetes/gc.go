@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Everything fluxd applies as part of a sync is labelled with a mark
+// derived from the name of the sync set (i.e., where the resources
+// came from) and the resource's identity. Only resources bearing the
+// mark for the sync set in question are candidates for garbage
+// collection; anything created by other means -- by hand, by another
+// fluxd, or by controllers in the cluster -- is left alone.
+const gcMarkLabel = kresource.PolicyPrefix + "sync-gc-mark"
+
+// makeGCMark returns the value of the garbage collection label for a
+// resource applied as part of the sync set given.
+func makeGCMark(syncSetName, resourceID string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(syncSetName))
+	// Include the resource's identity, so that a label copied to
+	// another object doesn't make that object eligible for deletion.
+	hasher.Write([]byte(resourceID))
+	// The prefix makes sure it's a valid (Kubernetes) label value.
+	return "sha256." + base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// applyMetadata returns the definition of the resource, with the
+// garbage collection mark for the sync set added to its labels.
+func applyMetadata(res resource.Resource, syncSetName string) ([]byte, error) {
+	definition := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(res.Bytes(), &definition); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse yaml from %s", res.Source()))
+	}
+
+	meta, ok := definition["metadata"].(map[interface{}]interface{})
+	if !ok {
+		meta = map[interface{}]interface{}{}
+		definition["metadata"] = meta
+	}
+	labels, ok := meta["labels"].(map[interface{}]interface{})
+	if !ok {
+		labels = map[interface{}]interface{}{}
+		meta["labels"] = labels
+	}
+	labels[gcMarkLabel] = makeGCMark(syncSetName, res.ResourceID().String())
+
+	bytes, err := yaml.Marshal(definition)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to serialize yaml after applying metadata to %s", res.Source()))
+	}
+	return bytes, nil
+}
+
+// ExportSyncSet exports the resources in the cluster that were
+// applied as part of the sync set named, and are therefore
+// candidates for garbage collection.
+func (c *Cluster) ExportSyncSet(syncSetName string) ([]byte, error) {
+	var config bytes.Buffer
+
+	namespaces, err := c.getAllowedNamespaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting namespaces")
+	}
+
+	resources, err := c.client.coreClient.Discovery().ServerPreferredResources()
+	if err != nil {
+		// Some API groups (e.g., those served by an aggregated API
+		// server that is down) may fail discovery; carry on with
+		// those that didn't, so long as there are some.
+		if len(resources) == 0 {
+			return nil, errors.Wrap(err, "discovering API resources")
+		}
+		c.logger.Log("warning", "discovery of some API resources failed", "err", err)
+	}
+	// We have to be able to find the resources, and then delete them
+	resources = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, resources)
+
+	listOptions := meta_v1.ListOptions{LabelSelector: gcMarkLabel}
+	for _, list := range resources {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiResource := range list.APIResources {
+			// Subresources can't be listed by themselves
+			if strings.Contains(apiResource.Name, "/") {
+				continue
+			}
+			client := c.client.dynamicClient.Resource(gv.WithResource(apiResource.Name))
+
+			var items []unstructured.Unstructured
+			if apiResource.Namespaced {
+				for _, ns := range namespaces {
+					objs, err := client.Namespace(ns.Name).List(listOptions)
+					if err != nil {
+						return nil, errors.Wrap(err, fmt.Sprintf("listing %s in namespace %s", apiResource.Name, ns.Name))
+					}
+					items = append(items, objs.Items...)
+				}
+			} else if len(c.nsWhitelist) == 0 {
+				// When restricted to some namespaces, we can't be
+				// sure cluster-scoped resources are ours to delete
+				objs, err := client.List(listOptions)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("listing %s", apiResource.Name))
+				}
+				items = objs.Items
+			}
+
+			for _, item := range items {
+				if isAddon(&item) {
+					continue
+				}
+				if err := appendSyncSetMember(&config, syncSetName, item); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return config.Bytes(), nil
+}
+
+// appendSyncSetMember appends the YAML for the object to the buffer,
+// if (and only if) the object bears the garbage collection mark of
+// the sync set named.
+func appendSyncSetMember(buffer *bytes.Buffer, syncSetName string, obj unstructured.Unstructured) error {
+	yamlBytes, err := k8syaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	// Parse the object the same way manifests are parsed, so the
+	// resource ID (and therefore the mark) is calculated identically.
+	resources, err := kresource.ParseMultidoc(yamlBytes, "exported")
+	if err != nil {
+		return err
+	}
+	for _, res := range resources {
+		if obj.GetLabels()[gcMarkLabel] != makeGCMark(syncSetName, res.ResourceID().String()) {
+			continue
+		}
+		buffer.WriteString("---\n")
+		buffer.Write(yamlBytes)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// GeneratorConfigFile is the name of the file which, when present in
+// a directory, says how to generate the manifests for that directory
+// (and those under it), rather than having them read from YAML files.
+const GeneratorConfigFile = ".flux.yaml"
+
+// How long a generator or updater command may run before it is
+// killed.
+const generatorTimeout = time.Minute
+
+// GeneratorConfig is the content of a generator config file. For
+// example,
+//
+//	version: 1
+//	generators:
+//	- kustomize: .
+//	updaters:
+//	- containerImage:
+//	    command: kustomize edit set image $FLUX_IMG:$FLUX_TAG
+//	  policy:
+//	    command: ./update-annotation.sh
+//
+// The output of each generator is taken as (multidoc) YAML, and
+// parsed as manifests. Updaters are run when an image or policy of a
+// generated workload is to be changed; each is given details of the
+// change in environment variables, and is expected to change the
+// files in the directory so that the generators' output reflects it.
+type GeneratorConfig struct {
+	Version    int         `yaml:"version"`
+	Generators []Generator `yaml:"generators"`
+	Updaters   []Updater   `yaml:"updaters"`
+}
+
+// Generator says how to produce manifests: either by running a
+// command, or by building the kustomization in the directory given.
+type Generator struct {
+	Command   string `yaml:"command,omitempty"`
+	Kustomize string `yaml:"kustomize,omitempty"`
+}
+
+// Updater names commands for updating a container image, and for
+// updating a policy, in a way that will be reflected in the output
+// of the generators.
+type Updater struct {
+	ContainerImage *UpdaterCommand `yaml:"containerImage,omitempty"`
+	Policy         *UpdaterCommand `yaml:"policy,omitempty"`
+}
+
+type UpdaterCommand struct {
+	Command string `yaml:"command"`
+}
+
+// ParseGeneratorConfig parses and checks the content of a generator
+// config file.
+func ParseGeneratorConfig(data []byte) (*GeneratorConfig, error) {
+	var config GeneratorConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if config.Version != 1 {
+		return nil, fmt.Errorf("unsupported generator config version %d; only version 1 is supported", config.Version)
+	}
+	if len(config.Generators) == 0 {
+		return nil, errors.New("no generators given")
+	}
+	for i, g := range config.Generators {
+		if (g.Command == "") == (g.Kustomize == "") {
+			return nil, fmt.Errorf("generator %d must have exactly one of command or kustomize", i)
+		}
+	}
+	return &config, nil
+}
+
+func loadGeneratorConfig(path string) (*GeneratorConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseGeneratorConfig(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading generator config %q", path)
+	}
+	return config, nil
+}
+
+// generate runs each generator in turn, in the directory given,
+// and returns the combined output.
+func (config *GeneratorConfig) generate(dir string) ([]byte, error) {
+	var out bytes.Buffer
+	for _, g := range config.Generators {
+		command := g.Command
+		if g.Kustomize != "" {
+			command = "kustomize build " + g.Kustomize
+		}
+		output, err := runGeneratorCommand(dir, command, nil)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("\n---\n")
+		out.Write(output)
+	}
+	return out.Bytes(), nil
+}
+
+func workloadEnv(id flux.ResourceID) []string {
+	ns, kind, name := id.Components()
+	return []string{
+		"FLUX_WORKLOAD=" + id.String(),
+		"FLUX_WL_NS=" + ns,
+		"FLUX_WL_KIND=" + kind,
+		"FLUX_WL_NAME=" + name,
+	}
+}
+
+// setImage runs the container image updaters, with the details of
+// the change in the environment.
+func (config *GeneratorConfig) setImage(dir string, id flux.ResourceID, container string, ref image.Ref) error {
+	env := append(workloadEnv(id),
+		"FLUX_CONTAINER="+container,
+		"FLUX_IMG="+ref.Name.String(),
+		"FLUX_TAG="+ref.Tag,
+	)
+	var ran bool
+	for _, u := range config.Updaters {
+		if u.ContainerImage == nil {
+			continue
+		}
+		if _, err := runGeneratorCommand(dir, u.ContainerImage.Command, env); err != nil {
+			return err
+		}
+		ran = true
+	}
+	if !ran {
+		return errors.New("no updater given for container images")
+	}
+	return nil
+}
+
+// updatePolicies runs the policy updaters once for each policy added
+// or removed. A policy to be removed is indicated by FLUX_POLICY_VALUE
+// being unset.
+func (config *GeneratorConfig) updatePolicies(dir string, id flux.ResourceID, update policy.Update) error {
+	var commands []string
+	for _, u := range config.Updaters {
+		if u.Policy != nil {
+			commands = append(commands, u.Policy.Command)
+		}
+	}
+	if len(commands) == 0 {
+		return errors.New("no updater given for policies")
+	}
+
+	run := func(env []string) error {
+		for _, command := range commands {
+			if _, err := runGeneratorCommand(dir, command, env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for p, value := range update.Add {
+		if err := run(append(workloadEnv(id), "FLUX_POLICY="+string(p), "FLUX_POLICY_VALUE="+value)); err != nil {
+			return err
+		}
+	}
+	for p := range update.Remove {
+		if err := run(append(workloadEnv(id), "FLUX_POLICY="+string(p))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Env vars that generator and updater commands inherit from fluxd.
+// Commands come from the repo, so they aren't given anything else
+// (e.g., git or cloud credentials).
+var generatorEnvVars = []string{"PATH", "HOME", "TMPDIR", "http_proxy", "https_proxy", "no_proxy", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+func generatorEnv(extra []string) []string {
+	var env []string
+	for _, k := range generatorEnvVars {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	return append(env, extra...)
+}
+
+func runGeneratorCommand(dir, command string, env []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generatorTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = generatorEnv(env)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		return nil, errors.Wrapf(err, "running %q in %s: %s", command, dir, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// --- Loading manifests, given generator configs
+
+// generatorConfigDir returns the directory, at or above path but not
+// above base, that has a generator config in it; or the empty string
+// if there is none.
+func generatorConfigDir(base, path string) string {
+	base = filepath.Clean(base)
+	dir := filepath.Clean(path)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if hasGeneratorConfig(dir) {
+			return dir
+		}
+		if dir == base || !strings.HasPrefix(dir, base) {
+			return ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func hasGeneratorConfig(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, GeneratorConfigFile))
+	return err == nil
+}
+
+// loadWithGenerators loads the manifests under the paths given, using
+// generators for any directory with a config file, and reading YAML
+// files otherwise.
+func loadWithGenerators(base string, paths []string) (map[string]resource.Resource, error) {
+	var configDirs []string
+	seen := map[string]bool{}
+	addConfigDir := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			configDirs = append(configDirs, dir)
+		}
+	}
+
+	var plainPaths []string
+	for _, path := range paths {
+		if dir := generatorConfigDir(base, path); dir != "" {
+			addConfigDir(dir)
+			continue
+		}
+		plainPaths = append(plainPaths, path)
+		// Generator configs further down are found while loading,
+		// below
+	}
+
+	objs, err := kresource.LoadSkipping(base, plainPaths, func(dir string) bool {
+		if hasGeneratorConfig(dir) {
+			addConfigDir(dir)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return objs, err
+	}
+
+	for _, dir := range configDirs {
+		configPath := filepath.Join(dir, GeneratorConfigFile)
+		config, err := loadGeneratorConfig(configPath)
+		if err != nil {
+			return objs, err
+		}
+		output, err := config.generate(dir)
+		if err != nil {
+			return objs, err
+		}
+		source, err := filepath.Rel(base, configPath)
+		if err != nil {
+			return objs, err
+		}
+		generated, err := kresource.ParseMultidoc(output, source)
+		if err != nil {
+			return objs, err
+		}
+		for id, obj := range generated {
+			if alreadyDefined, ok := objs[id]; ok {
+				return objs, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
+			}
+			objs[id] = obj
+		}
+	}
+	return objs, nil
+}
@@ -0,0 +1,213 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+const generatedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: generated
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+// This is under the generator's directory, but not included in its
+// output, so should not be loaded.
+const notLoadedConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: notloaded
+  namespace: default
+`
+
+const plainService = `apiVersion: v1
+kind: Service
+metadata:
+  name: plain
+  namespace: default
+`
+
+// The generator just cats the YAML files in its directory; since the
+// directory has a config file, they shouldn't be loaded by any other
+// means.
+const generatorConfig = `version: 1
+generators:
+- command: cat *.yaml
+updaters:
+- containerImage:
+    command: sed -i "s#image: .*#image: $FLUX_IMG:$FLUX_TAG#" deployment.yaml
+  policy:
+    command: echo "$FLUX_WORKLOAD $FLUX_POLICY=${FLUX_POLICY_VALUE-<removed>}" >> policies.log
+`
+
+func setupGenerated(t *testing.T) (string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	for path, content := range map[string]string{
+		"service.yaml":                 plainService,
+		"generated/.flux.yaml":         generatorConfig,
+		"generated/deployment.yaml":    generatedDeployment,
+		"generated/sub/notloaded.yaml": notLoadedConfigMap,
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func TestLoadGenerated(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{Generate: true}
+	for _, paths := range [][]string{
+		{dir},
+		{dir, filepath.Join(dir, "generated")},
+		{filepath.Join(dir, "service.yaml"), filepath.Join(dir, "generated", "sub", "notloaded.yaml")},
+	} {
+		resources, err := m.LoadManifests(dir, paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"default:service/plain":        "service.yaml",
+			"default:deployment/generated": "generated/.flux.yaml",
+		}
+		if len(resources) != len(expected) {
+			t.Errorf("loading %v: expected %d resources, got %v", paths, len(expected), resources)
+		}
+		for id, source := range expected {
+			res, ok := resources[id]
+			if !ok {
+				t.Errorf("loading %v: expected resource %s", paths, id)
+				continue
+			}
+			if res.Source() != source {
+				t.Errorf("loading %v: expected %s to have source %q, got %q", paths, id, source, res.Source())
+			}
+		}
+	}
+}
+
+func TestLoadGeneratedDisabled(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{}
+	resources, err := m.LoadManifests(dir, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := resources["default:deployment/generated"]
+	if !ok {
+		t.Fatal("expected deployment to be loaded from its file")
+	}
+	if res.Source() != filepath.Join("generated", "deployment.yaml") {
+		t.Errorf("expected deployment to come from its file, but source is %q", res.Source())
+	}
+	if m.IsGenerated(filepath.Join(dir, "generated", GeneratorConfigFile)) {
+		t.Error("expected nothing to be considered generated when generation is off")
+	}
+}
+
+func TestGeneratedUpdates(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{Generate: true}
+	configPath := filepath.Join(dir, "generated", GeneratorConfigFile)
+	if !m.IsGenerated(configPath) {
+		t.Fatalf("expected %s to be considered a generator config", configPath)
+	}
+
+	id := flux.MustParseResourceID("default:deployment/generated")
+	ref, err := image.ParseRef("quay.io/weaveworks/helloworld:master-b000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetWorkloadContainerImage(configPath, id, "app", ref); err != nil {
+		t.Fatal(err)
+	}
+	resources, err := m.LoadManifests(dir, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := resources[id.String()].(resource.Workload).Containers()
+	if len(containers) != 1 || containers[0].Image.String() != ref.String() {
+		t.Errorf("expected image to be updated to %s, got containers %v", ref, containers)
+	}
+
+	update := policy.Update{
+		Add:    policy.Set{policy.Automated: "true"},
+		Remove: policy.Set{policy.Locked: "true"},
+	}
+	if err := m.UpdateWorkloadPolicies(configPath, id, update); err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile(filepath.Join(dir, "generated", "policies.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "default:deployment/generated automated=true\ndefault:deployment/generated locked=<removed>\n"
+	if string(log) != expected {
+		t.Errorf("expected policy updater to be run with\n%s\ngot\n%s", expected, log)
+	}
+}
+
+func TestGeneratorCommandEnv(t *testing.T) {
+	os.Setenv("FLUX_GIT_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("FLUX_GIT_PASSWORD")
+
+	out, err := runGeneratorCommand(os.TempDir(), "env", []string{"FLUX_WORKLOAD=default:deployment/app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := string(out)
+	if strings.Contains(env, "s3cr3t") {
+		t.Errorf("expected fluxd's environment not to be passed to commands, got\n%s", env)
+	}
+	for _, v := range []string{"PATH=" + os.Getenv("PATH"), "FLUX_WORKLOAD=default:deployment/app"} {
+		if !strings.Contains(env, v) {
+			t.Errorf("expected %q in the environment, got\n%s", v, env)
+		}
+	}
+}
+
+func TestParseGeneratorConfig(t *testing.T) {
+	for _, bad := range []string{
+		"generators:\n- command: echo\n",
+		"version: 2\ngenerators:\n- command: echo\n",
+		"version: 1\n",
+		"version: 1\ngenerators:\n- {}\n",
+		"version: 1\ngenerators:\n- command: echo\n  kustomize: .\n",
+	} {
+		if _, err := ParseGeneratorConfig([]byte(bad)); err == nil {
+			t.Errorf("expected error parsing config:\n%s", bad)
+		}
+	}
+	if _, err := ParseGeneratorConfig([]byte(generatorConfig)); err != nil {
+		t.Error(err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
 
 	"github.com/weaveworks/flux"
@@ -27,6 +28,7 @@ type fluxHelmClient fhrclient.Interface
 type extendedClient struct {
 	coreClient
 	fluxHelmClient
+	dynamicClient dynamic.Interface
 }
 
 // --- internal types for keeping track of syncing
@@ -40,6 +42,17 @@ type apiObject struct {
 	resource.Resource
 	Kind     string   `yaml:"kind"`
 	Metadata metadata `yaml:"metadata"`
+
+	// payload, if not nil, is what gets sent to the cluster in place
+	// of the resource's own definition
+	payload []byte
+}
+
+func (o *apiObject) Bytes() []byte {
+	if o.payload != nil {
+		return o.payload
+	}
+	return o.Resource.Bytes()
 }
 
 // A convenience for getting an minimal object from some bytes.
@@ -111,6 +124,7 @@ type Cluster struct {
 // NewCluster returns a usable cluster.
 func NewCluster(clientset k8sclient.Interface,
 	fluxHelmClientset fhrclient.Interface,
+	dynamicClientset dynamic.Interface,
 	applier Applier,
 	sshKeyRing ssh.KeyRing,
 	logger log.Logger,
@@ -121,6 +135,7 @@ func NewCluster(clientset k8sclient.Interface,
 		client: extendedClient{
 			clientset,
 			fluxHelmClientset,
+			dynamicClientset,
 		},
 		applier:           applier,
 		logger:            logger,
@@ -232,6 +247,9 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 				continue
 			}
 			obj, err := parseObj(stage.res.Bytes())
+			if syncSetName := action.SyncSetName(spec); err == nil && stage.cmd == "apply" && syncSetName != "" {
+				obj.payload, err = applyMetadata(stage.res, syncSetName)
+			}
 			if err == nil {
 				obj.Resource = stage.res
 				cs.stage(stage.cmd, obj)
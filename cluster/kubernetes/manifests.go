@@ -1,16 +1,26 @@
 package kubernetes
 
 import (
+	"path/filepath"
+
 	"github.com/weaveworks/flux"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/resource"
 )
 
 type Manifests struct {
+	// Generate, when true, makes directories with a generator config
+	// file in them produce manifests by running the generators the
+	// config names, rather than by reading YAML files.
+	Generate bool
 }
 
 func (c *Manifests) LoadManifests(base string, paths []string) (map[string]resource.Resource, error) {
+	if c.Generate {
+		return loadWithGenerators(base, paths)
+	}
 	return kresource.Load(base, paths)
 }
 
@@ -23,3 +33,25 @@ func (c *Manifests) UpdateImage(def []byte, id flux.ResourceID, container string
 }
 
 // UpdatePolicies and ServicesWithPolicies in policies.go
+
+// --- generated manifests; see generator.go
+
+func (c *Manifests) IsGenerated(path string) bool {
+	return c.Generate && filepath.Base(path) == GeneratorConfigFile
+}
+
+func (c *Manifests) SetWorkloadContainerImage(configPath string, id flux.ResourceID, container string, newImageID image.Ref) error {
+	config, err := loadGeneratorConfig(configPath)
+	if err != nil {
+		return err
+	}
+	return config.setImage(filepath.Dir(configPath), id, container, newImageID)
+}
+
+func (c *Manifests) UpdateWorkloadPolicies(configPath string, id flux.ResourceID, update policy.Update) error {
+	config, err := loadGeneratorConfig(configPath)
+	if err != nil {
+		return err
+	}
+	return config.updatePolicies(filepath.Dir(configPath), id, update)
+}
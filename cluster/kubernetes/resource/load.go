@@ -16,6 +16,12 @@ import (
 // based on the file(s) therein. Resources are named according to the
 // file content, rather than the file name of directory structure.
 func Load(base string, paths []string) (map[string]resource.Resource, error) {
+	return LoadSkipping(base, paths, nil)
+}
+
+// LoadSkipping is like Load, but does not look in any directory for
+// which `skipDir` returns true.
+func LoadSkipping(base string, paths []string, skipDir func(path string) bool) (map[string]resource.Resource, error) {
 	if _, err := os.Stat(base); os.IsNotExist(err) {
 		return nil, fmt.Errorf("git path %q not found", base)
 	}
@@ -34,6 +40,10 @@ func Load(base string, paths []string) (map[string]resource.Resource, error) {
 				return filepath.SkipDir
 			}
 
+			if info.IsDir() && skipDir != nil && skipDir(path) {
+				return filepath.SkipDir
+			}
+
 			if charts.isPathInChart(path) {
 				return nil
 			}
@@ -1,10 +1,12 @@
 package kubernetes
 
 import (
+	"reflect"
 	"sort"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"gopkg.in/yaml.v2"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
@@ -110,3 +112,41 @@ func TestApplyOrder(t *testing.T) {
 		}
 	}
 }
+
+// TestApplyMetadata checks that the garbage collection mark is added
+// to the resource's labels, without disturbing those already there.
+func TestApplyMetadata(t *testing.T) {
+	res := rsc{"default:deployment/helloworld", []byte(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+  labels:
+    app: helloworld
+`)}
+	def, err := applyMetadata(res, "test-sync-set")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var obj struct {
+		Metadata struct {
+			Labels map[string]string `yaml:"labels"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal(def, &obj); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"app":       "helloworld",
+		gcMarkLabel: makeGCMark("test-sync-set", "default:deployment/helloworld"),
+	}
+	if !reflect.DeepEqual(expected, obj.Metadata.Labels) {
+		t.Errorf("expected labels %#v, got %#v", expected, obj.Metadata.Labels)
+	}
+
+	if makeGCMark("test-sync-set", "default:deployment/helloworld") == makeGCMark("other-sync-set", "default:deployment/helloworld") {
+		t.Error("expected different sync sets to give different marks")
+	}
+}
@@ -0,0 +1,122 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/weaveworks/flux/job"
+)
+
+// The annotation recording when a sync state key was last updated,
+// suffixed with the key; the equivalent of the message on a sync tag.
+const syncStateUpdatedAnnotation = "flux.weave.works/sync-updated."
+
+// The suffix of the key under which the notes for a sync are kept,
+// alongside the revision; the equivalent of the notes on commits.
+const syncStateNotesSuffix = ".notes"
+
+// ConfigMapSyncState records sync progress (as a sync.State) in a key
+// of a ConfigMap, rather than in the git repo; so, syncing does not
+// need write access to the repo. More than one git source (or fluxd)
+// can share a ConfigMap, so long as each uses its own key.
+type ConfigMapSyncState struct {
+	api  v1.ConfigMapInterface
+	name string
+	key  string
+}
+
+func NewConfigMapSyncState(api v1.ConfigMapInterface, name, key string) *ConfigMapSyncState {
+	return &ConfigMapSyncState{api: api, name: name, key: key}
+}
+
+func (s *ConfigMapSyncState) GetRevision(ctx context.Context) (string, error) {
+	cm, err := s.api.Get(s.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", errors.Wrapf(err, "getting sync state from ConfigMap %s", s.name)
+	}
+	return cm.Data[s.key], nil
+}
+
+// GetNotes returns the notes recorded with the last sync, by
+// revision; or nil, if there are none.
+func (s *ConfigMapSyncState) GetNotes(ctx context.Context) (map[string]job.Note, error) {
+	cm, err := s.api.Get(s.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "getting sync state from ConfigMap %s", s.name)
+	}
+	data, ok := cm.Data[s.key+syncStateNotesSuffix]
+	if !ok {
+		return nil, nil
+	}
+	var notes map[string]job.Note
+	if err := json.Unmarshal([]byte(data), &notes); err != nil {
+		return nil, errors.Wrapf(err, "parsing sync notes from ConfigMap %s", s.name)
+	}
+	return notes, nil
+}
+
+func (s *ConfigMapSyncState) UpdateMarker(ctx context.Context, revision string, notes map[string]job.Note) error {
+	var notesData []byte
+	if len(notes) > 0 {
+		var err error
+		if notesData, err = json.Marshal(notes); err != nil {
+			return errors.Wrap(err, "serialising sync notes")
+		}
+	}
+
+	// Other keys in the ConfigMap may be updated at the same time,
+	// e.g., by another git source, so retry if it's changed since
+	// it was read.
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.api.Get(s.name, metav1.GetOptions{})
+		notFound := apierrors.IsNotFound(err)
+		if err != nil && !notFound {
+			return err
+		}
+		if notFound {
+			cm = &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name},
+			}
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Data[s.key] = revision
+		if notesData != nil {
+			cm.Data[s.key+syncStateNotesSuffix] = string(notesData)
+		} else {
+			delete(cm.Data, s.key+syncStateNotesSuffix)
+		}
+		cm.Annotations[syncStateUpdatedAnnotation+s.key] = time.Now().UTC().Format(time.RFC3339)
+
+		if notFound {
+			_, err = s.api.Create(cm)
+			// Someone else got there first; try again, to update
+			// theirs
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(apiv1.Resource("configmaps"), s.name, err)
+			}
+		} else {
+			_, err = s.api.Update(cm)
+		}
+		return err
+	})
+	return errors.Wrapf(err, "recording sync state in ConfigMap %s", s.name)
+}
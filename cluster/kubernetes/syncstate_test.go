@@ -0,0 +1,105 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weaveworks/flux/job"
+)
+
+func TestConfigMapSyncState(t *testing.T) {
+	ctx := context.Background()
+	configMaps := fake.NewSimpleClientset().Core().ConfigMaps("flux")
+	primary := NewConfigMapSyncState(configMaps, "flux-sync-state", "flux-sync")
+	other := NewConfigMapSyncState(configMaps, "flux-sync-state", "flux-sync-0123abcd")
+
+	// Nothing recorded, and no ConfigMap yet
+	rev, err := primary.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "" {
+		t.Errorf("expected no revision, got %q", rev)
+	}
+
+	if err := primary.UpdateMarker(ctx, "abc123", map[string]job.Note{"abc123": {JobID: "job-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.UpdateMarker(ctx, "def456", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.UpdateMarker(ctx, "abc789", map[string]job.Note{"abc789": {JobID: "job-2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for state, expected := range map[*ConfigMapSyncState]string{
+		primary: "abc789",
+		other:   "def456",
+	} {
+		rev, err := state.GetRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev != expected {
+			t.Errorf("expected revision %q for key %s, got %q", expected, state.key, rev)
+		}
+	}
+
+	cm, err := configMaps.Get("flux-sync-state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cm.Annotations[syncStateUpdatedAnnotation+"flux-sync"]; !ok {
+		t.Errorf("expected the update time to be recorded, got annotations %v", cm.Annotations)
+	}
+
+	// The notes are replaced by those of the latest sync
+	notes, err := primary.GetNotes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]job.Note{"abc789": {JobID: "job-2"}}; !reflect.DeepEqual(notes, expected) {
+		t.Errorf("expected notes %v, got %v", expected, notes)
+	}
+	if notes, err := other.GetNotes(ctx); err != nil || notes != nil {
+		t.Errorf("expected no notes for key %s, got %v (err: %v)", other.key, notes, err)
+	}
+}
+
+func TestConfigMapSyncStateConflict(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "flux-sync-state", Namespace: "flux"},
+	})
+	var updates int
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates == 1 {
+			return true, nil, apierrors.NewConflict(apiv1.Resource("configmaps"), "flux-sync-state", nil)
+		}
+		return false, nil, nil
+	})
+	state := NewConfigMapSyncState(clientset.Core().ConfigMaps("flux"), "flux-sync-state", "flux-sync")
+
+	if err := state.UpdateMarker(ctx, "abc123", nil); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 2 {
+		t.Errorf("expected the update to be retried once, got %d updates", updates)
+	}
+	rev, err := state.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "abc123" {
+		t.Errorf("expected revision %q, got %q", "abc123", rev)
+	}
+}
@@ -37,21 +37,59 @@ type Manifests interface {
 	UpdatePolicies([]byte, flux.ResourceID, policy.Update) ([]byte, error)
 }
 
+// GeneratedManifests is implemented by Manifests that can generate
+// resources by running commands named in a config file, as well as
+// reading them from files. A generated resource has the config file
+// as its source; since there is no file to edit, it is updated by
+// running the commands the config names for that purpose.
+type GeneratedManifests interface {
+	Manifests
+	// IsGenerated says whether the path given (as an absolute path)
+	// is that of a config for generating resources
+	IsGenerated(path string) bool
+	// SetWorkloadContainerImage updates the image used by a
+	// container of a generated workload
+	SetWorkloadContainerImage(configPath string, resourceID flux.ResourceID, container string, newImageID image.Ref) error
+	// UpdateWorkloadPolicies applies the policy update to a generated
+	// workload
+	UpdateWorkloadPolicies(configPath string, resourceID flux.ResourceID, update policy.Update) error
+}
+
+func isGenerated(m Manifests, path string) bool {
+	g, ok := m.(GeneratedManifests)
+	return ok && g.IsGenerated(path)
+}
+
+// findManifest returns the identified resource, and the path to the
+// file in which it is defined.
+func findManifest(m Manifests, root string, paths []string, id flux.ResourceID) (string, resource.Resource, error) {
+	resources, err := m.LoadManifests(root, paths)
+	if err != nil {
+		return "", nil, err
+	}
+
+	res, ok := resources[id.String()]
+	if !ok {
+		return "", nil, ErrResourceNotFound(id.String())
+	}
+	return filepath.Join(root, res.Source()), res, nil
+}
+
 // UpdateManifest looks for the manifest for the identified resource,
 // reads its contents, applies f(contents), and writes the results
 // back to the file.
 func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID, f func(manifest []byte) ([]byte, error)) error {
-	resources, err := m.LoadManifests(root, paths)
+	path, _, err := findManifest(m, root, paths, id)
 	if err != nil {
 		return err
 	}
-
-	resource, ok := resources[id.String()]
-	if !ok {
-		return ErrResourceNotFound(id.String())
+	if isGenerated(m, path) {
+		return ManifestError{fmt.Errorf("manifest for resource %s is generated by %s, so cannot be edited", id, path)}
 	}
+	return updateFile(path, f)
+}
 
-	path := filepath.Join(root, resource.Source())
+func updateFile(path string, f func(manifest []byte) ([]byte, error)) error {
 	def, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
@@ -68,3 +106,37 @@ func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID
 	}
 	return ioutil.WriteFile(path, newDef, fi.Mode())
 }
+
+// UpdatePolicies applies the policy update to the identified
+// resource: by running the updaters given in its generator config, if
+// it's generated, or otherwise by editing its manifest. It returns
+// whether the resource's definition was changed.
+func UpdatePolicies(m Manifests, root string, paths []string, id flux.ResourceID, update policy.Update) (bool, error) {
+	path, res, err := findManifest(m, root, paths, id)
+	if err != nil {
+		return false, err
+	}
+
+	if isGenerated(m, path) {
+		if err := m.(GeneratedManifests).UpdateWorkloadPolicies(path, id, update); err != nil {
+			return false, err
+		}
+		// See whether the updaters made any difference
+		_, after, err := findManifest(m, root, paths, id)
+		if err != nil {
+			return false, err
+		}
+		return string(after.Bytes()) != string(res.Bytes()), nil
+	}
+
+	var changed bool
+	err = updateFile(path, func(def []byte) ([]byte, error) {
+		newDef, err := m.UpdatePolicies(def, id, update)
+		if err != nil {
+			return nil, err
+		}
+		changed = string(newDef) != string(def)
+		return newDef, nil
+	})
+	return changed, err
+}
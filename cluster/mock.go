@@ -14,6 +14,7 @@ type Mock struct {
 	SomeServicesFunc   func([]flux.ResourceID) ([]Controller, error)
 	PingFunc           func() error
 	ExportFunc         func() ([]byte, error)
+	ExportSyncSetFunc  func(syncSetName string) ([]byte, error)
 	SyncFunc           func(SyncDef) error
 	PublicSSHKeyFunc   func(regenerate bool) (ssh.PublicKey, error)
 	UpdateImageFunc    func(def []byte, id flux.ResourceID, container string, newImageID image.Ref) ([]byte, error)
@@ -39,6 +40,10 @@ func (m *Mock) Export() ([]byte, error) {
 	return m.ExportFunc()
 }
 
+func (m *Mock) ExportSyncSet(syncSetName string) ([]byte, error) {
+	return m.ExportSyncSetFunc(syncSetName)
+}
+
 func (m *Mock) Sync(c SyncDef) error {
 	return m.SyncFunc(c)
 }
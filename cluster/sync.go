@@ -3,6 +3,7 @@ package cluster
 import (
 	"strings"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -13,9 +14,26 @@ import (
 type SyncAction struct {
 	Delete resource.Resource // ) one of these
 	Apply  resource.Resource // )
+	// The name of the sync set the resource to apply belongs to, if
+	// not that given in the SyncDef
+	SyncSet string
+}
+
+// SyncSetName gives the name of the sync set that the resource
+// applied by the action is to be marked with, if any.
+func (a SyncAction) SyncSetName(def SyncDef) string {
+	if a.SyncSet != "" {
+		return a.SyncSet
+	}
+	return def.Name
 }
 
 type SyncDef struct {
+	// The name of the sync set, i.e., where the resources came
+	// from. If not empty, applied resources are marked with it so
+	// they can be found (and garbage collected) later. Each action
+	// can name its own sync set instead.
+	Name string
 	// The actions to undertake
 	Actions []SyncAction
 }
@@ -34,3 +52,34 @@ func (err SyncError) Error() string {
 	}
 	return strings.Join(errs, "; ")
 }
+
+// SyncChangeType says what a sync would do to a resource.
+type SyncChangeType string
+
+const (
+	SyncCreate SyncChangeType = "create"
+	SyncUpdate SyncChangeType = "update"
+	SyncDelete SyncChangeType = "delete"
+	// The resource would be applied, but its kind is not exported
+	// from the cluster, so it's not known whether it'd be created or
+	// updated.
+	SyncApply SyncChangeType = "apply"
+)
+
+// FieldChange is a difference in a single field between a resource
+// as exported from the cluster, and as defined in the repo. Old and
+// New are JSON-encoded values, and are empty when the field is
+// absent.
+type FieldChange struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// ResourceChange describes what a sync would do to a resource.
+type ResourceChange struct {
+	ID     flux.ResourceID
+	Type   SyncChangeType
+	Source string
+	Fields []FieldChange
+}
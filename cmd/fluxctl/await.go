@@ -33,12 +33,22 @@ is safe to retry operations.`)
 		update.PrintResults(stdout, result.Result, verbosity)
 	}
 	if result.Revision != "" {
-		fmt.Fprintf(stderr, "Commit pushed:\t%s\n", result.Revision[:7])
+		if result.PushAttempts > 1 {
+			fmt.Fprintf(stderr, "Commit pushed:\t%s (rebased, after %d attempts)\n", result.Revision[:7], result.PushAttempts)
+		} else {
+			fmt.Fprintf(stderr, "Commit pushed:\t%s\n", result.Revision[:7])
+		}
 	}
 	if result.Result == nil {
 		fmt.Fprintf(stderr, "Nothing to do\n")
 		return nil
 	}
+	if result.PullRequest != "" {
+		// The commit won't be applied until the pull request is
+		// merged, so there's no point waiting for it.
+		fmt.Fprintf(stderr, "Pull request:\t%s\n", result.PullRequest)
+		return nil
+	}
 
 	if apply && result.Revision != "" {
 		if err := awaitSync(ctx, client, result.Revision); err != nil {
@@ -19,6 +19,7 @@ type controllerShowOpts struct {
 	namespace  string
 	controller string
 	limit      int
+	labels     []string
 
 	// Deprecated
 	service string
@@ -30,14 +31,18 @@ func newControllerShow(parent *rootOpts) *controllerShowOpts {
 
 func (opts *controllerShowOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "list-images",
-		Short:   "Show the deployed and available images for a controller.",
-		Example: makeExample("fluxctl list-images --namespace default --controller=deployment/foo"),
-		RunE:    opts.RunE,
+		Use:   "list-images",
+		Short: "Show the deployed and available images for a controller.",
+		Example: makeExample(
+			"fluxctl list-images --namespace default --controller=deployment/foo",
+			"fluxctl list-images --controller=deployment/foo --label=org.opencontainers.image.created",
+		),
+		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
 	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Show images for this controller")
 	cmd.Flags().IntVarP(&opts.limit, "limit", "l", 10, "Number of images to show (0 for all)")
+	cmd.Flags().StringSliceVar(&opts.labels, "label", nil, "Show the value of this image label for each image, e.g., when it's used to order the images")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Show images for this service")
@@ -76,10 +81,17 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	out := newTabwriter()
 
-	fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED")
+	// Any labels asked for are shown in extra columns
+	var labelHeaders, labelPadding string
+	for _, label := range opts.labels {
+		labelHeaders += "\t" + label
+		labelPadding += "\t"
+	}
+
+	fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED"+labelHeaders)
 	for _, controller := range controllers {
 		if len(controller.Containers) == 0 {
-			fmt.Fprintf(out, "%s\t\t\t\n", controller.ID)
+			fmt.Fprintf(out, "%s\t\t\t%s\n", controller.ID, labelPadding)
 			continue
 		}
 
@@ -96,9 +108,9 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 				if availableErr == "" {
 					availableErr = registry.ErrNoImageData.Error()
 				}
-				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s\n", controllerName, containerName, reg, repo, availableErr)
+				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s%s\n", controllerName, containerName, reg, repo, availableErr, labelPadding)
 			} else {
-				fmt.Fprintf(out, "%s\t%s\t%s%s\t\n", controllerName, containerName, reg, repo)
+				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s\n", controllerName, containerName, reg, repo, labelPadding)
 			}
 			foundRunning := false
 			for _, available := range container.Available {
@@ -119,14 +131,18 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					printEllipsis, printLine = lineCount > (opts.limit+1), true
 				}
 				if printEllipsis {
-					fmt.Fprintf(out, "\t\t%s (%d image(s) omitted)\t\n", ":", lineCount-opts.limit-1)
+					fmt.Fprintf(out, "\t\t%s (%d image(s) omitted)\t%s\n", ":", lineCount-opts.limit-1, labelPadding)
 				}
 				if printLine {
 					createdAt := ""
 					if !available.CreatedAt.IsZero() {
 						createdAt = available.CreatedAt.Format(time.RFC822)
 					}
-					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
+					var labelValues string
+					for _, label := range opts.labels {
+						labelValues += "\t" + available.Labels[label]
+					}
+					fmt.Fprintf(out, "\t\t%s %s\t%s%s\n", running, tag, createdAt, labelValues)
 				}
 			}
 			controllerName = ""
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v12"
+	"github.com/weaveworks/flux/event"
+)
+
+type resourceListOpts struct {
+	*rootOpts
+	namespace     string
+	allNamespaces bool
+}
+
+func newResourceList(parent *rootOpts) *resourceListOpts {
+	return &resourceListOpts{rootOpts: parent}
+}
+
+func (opts *resourceListOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list-resources",
+		Short:   "List the resources defined in the git repo, and how they were last synced.",
+		Example: makeExample("fluxctl list-resources --all-namespaces"),
+		RunE:    opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Confine query to namespace")
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces, including cluster-scoped resources")
+	return cmd
+}
+
+func (opts *resourceListOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	if opts.allNamespaces {
+		opts.namespace = ""
+	}
+
+	ctx := context.Background()
+
+	resources, err := opts.API.ListResources(ctx, opts.namespace)
+	if err != nil {
+		return err
+	}
+
+	w := newTabwriter()
+	fmt.Fprintf(w, "RESOURCE\tSOURCE\tAPPLIED\tSTATUS\n")
+	for _, r := range resources {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.Source, event.ShortRevision(r.LastAppliedRevision), resourceSyncStatus(r))
+	}
+	w.Flush()
+	return nil
+}
+
+func resourceSyncStatus(r v12.ResourceStatus) string {
+	switch {
+	case r.Ignore:
+		return "ignored"
+	case r.SyncError != "":
+		return "error: " + r.SyncError
+	case r.LastAppliedRevision == "":
+		return "not yet applied"
+	default:
+		return "applied"
+	}
+}
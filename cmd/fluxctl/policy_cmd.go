@@ -19,6 +19,7 @@ type controllerPolicyOpts struct {
 	controller string
 	tagAll     string
 	tags       []string
+	sortLabels []string
 
 	automate, deautomate bool
 	lock, unlock         bool
@@ -46,12 +47,18 @@ Surrounding these with single-quotes are recommended to avoid shell expansion.
 
 If both --tag-all and --tag are specified, --tag-all will apply to all
 containers which aren't explicitly named.
+
+Images are ordered by their creation date (or for semver: filters, by
+version). To order them by the value of an image label instead, e.g., for
+images built reproducibly, give the label as 'container=label'; an empty
+label goes back to the usual order.
         `,
 		Example: makeExample(
 			"fluxctl policy --controller=default:deployment/foo --automate",
 			"fluxctl policy --controller=default:deployment/foo --lock",
 			"fluxctl policy --controller=default:deployment/foo --tag='bar=1.*' --tag='baz=2.*'",
 			"fluxctl policy --controller=default:deployment/foo --tag-all='master-*' --tag='bar=1.*'",
+			"fluxctl policy --controller=default:deployment/foo --sort-label='bar=org.opencontainers.image.created'",
 		),
 		RunE: opts.RunE,
 	}
@@ -63,6 +70,7 @@ containers which aren't explicitly named.
 	flags.StringVarP(&opts.controller, "controller", "c", "", "Controller to modify")
 	flags.StringVar(&opts.tagAll, "tag-all", "", "Tag filter pattern to apply to all containers")
 	flags.StringSliceVar(&opts.tags, "tag", nil, "Tag filter container/pattern pairs")
+	flags.StringSliceVar(&opts.sortLabels, "sort-label", nil, "Container/image label pairs, to order a container's images by the label")
 	flags.BoolVar(&opts.automate, "automate", false, "Automate controller")
 	flags.BoolVar(&opts.deautomate, "deautomate", false, "Deautomate controller")
 	flags.BoolVar(&opts.lock, "lock", false, "Lock controller")
@@ -159,6 +167,20 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 		}
 	}
 
+	for _, labelPair := range opts.sortLabels {
+		parts := strings.SplitN(labelPair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return policy.Update{}, fmt.Errorf("invalid container/label pair: %q. Expected format is 'container=label'", labelPair)
+		}
+
+		container, label := parts[0], parts[1]
+		if label != "" {
+			add = add.Set(policy.SortLabelPrefix(container), label)
+		} else {
+			remove = remove.Add(policy.SortLabelPrefix(container))
+		}
+	}
+
 	return policy.Update{
 		Add:    add,
 		Remove: remove,
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+type controllerPromoteOpts struct {
+	*rootOpts
+	from           string
+	to             string
+	namespace      string
+	controllers    []string
+	allControllers bool
+	dryRun         bool
+	force          bool
+	outputOpts
+	cause update.Cause
+}
+
+func newControllerPromote(parent *rootOpts) *controllerPromoteOpts {
+	return &controllerPromoteOpts{rootOpts: parent}
+}
+
+func (opts *controllerPromoteOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the images used by controllers in one path of the git repo to the same controllers in another.",
+		Example: makeExample(
+			"fluxctl promote --from=staging --to=production --all",
+			"fluxctl promote --from=staging --to=production -n staging --controller=deployment/foo",
+		),
+		RunE: opts.RunE,
+	}
+
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	cmd.Flags().StringVar(&opts.from, "from", "", "Path in the git repo with the controllers to promote images from")
+	cmd.Flags().StringVar(&opts.to, "to", "", "Path in the git repo with the controllers to promote images to; this must be synced by fluxd")
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace, in the path promoted from")
+	cmd.Flags().StringSliceVarP(&opts.controllers, "controller", "c", []string{}, "List of controllers to promote <namespace>:<kind>/<name>, as defined in the path promoted from")
+	cmd.Flags().BoolVar(&opts.allControllers, "all", false, "Promote all controllers")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Do not promote anything; just report back what would have been done")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Disregard locks and container image filters")
+
+	return cmd
+}
+
+func (opts *controllerPromoteOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	switch {
+	case opts.from == "" || opts.to == "":
+		return newUsageError("please supply both --from=<path> and --to=<path>")
+	case len(opts.controllers) <= 0 && !opts.allControllers:
+		return newUsageError("please supply either --all, or at least one --controller=<controller>")
+	}
+
+	var controllers []update.ResourceSpec
+	if opts.allControllers {
+		controllers = []update.ResourceSpec{update.ResourceSpecAll}
+	} else {
+		for _, controller := range opts.controllers {
+			id, err := flux.ParseResourceIDOptionalNamespace(opts.namespace, controller)
+			if err != nil {
+				return err
+			}
+			controllers = append(controllers, update.MakeResourceSpec(id))
+		}
+	}
+
+	var kind update.ReleaseKind = update.ReleaseKindExecute
+	if opts.dryRun {
+		kind = update.ReleaseKindPlan
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting dry-run promotion ...\n")
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting promotion ...\n")
+	}
+
+	ctx := context.Background()
+	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
+		Type:  update.Promote,
+		Cause: opts.cause,
+		Spec: update.PromoteSpec{
+			From:      opts.from,
+			To:        opts.to,
+			Workloads: controllers,
+			Kind:      kind,
+			Force:     opts.force,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbosity)
+}
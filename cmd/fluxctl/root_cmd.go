@@ -81,7 +81,9 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newServiceList(opts).Command(),
 		newControllerShow(opts).Command(),
 		newControllerList(opts).Command(),
+		newResourceList(opts).Command(),
 		newControllerRelease(opts).Command(),
+		newControllerPromote(opts).Command(),
 		newServiceAutomate(opts).Command(),
 		newControllerDeautomate(opts).Command(),
 		newControllerLock(opts).Command(),
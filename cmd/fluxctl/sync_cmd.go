@@ -12,6 +12,7 @@ import (
 
 type syncOpts struct {
 	*rootOpts
+	dryRun bool
 }
 
 func newSync(parent *rootOpts) *syncOpts {
@@ -22,8 +23,13 @@ func (opts *syncOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "synchronize the cluster with the git repository, now",
-		RunE:  opts.RunE,
+		Example: makeExample(
+			"fluxctl sync",
+			"fluxctl sync --dry-run",
+		),
+		RunE: opts.RunE,
 	}
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "show the changes a sync would make to the cluster, without applying them")
 	return cmd
 }
 
@@ -48,6 +54,28 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("git repository %s is not ready to sync (status: %s)", gitConfig.Remote.URL, string(gitConfig.Status))
 	}
 
+	if opts.dryRun {
+		fmt.Fprintf(cmd.OutOrStderr(), "Comparing %s with the cluster\n", gitConfig.Remote.URL)
+		changes, err := opts.API.SyncDryRun(ctx)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Fprintln(cmd.OutOrStderr(), "No changes.")
+			return nil
+		}
+		w := newTabwriter()
+		fmt.Fprintf(w, "RESOURCE\tACTION\tSOURCE\n")
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", change.ID, change.Type, change.Source)
+			for _, field := range change.Fields {
+				fmt.Fprintf(w, "  %s\t%s -> %s\t\n", field.Path, fieldValue(field.Old), fieldValue(field.New))
+			}
+		}
+		w.Flush()
+		return nil
+	}
+
 	fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing with %s\n", gitConfig.Remote.URL)
 
 	updateSpec := update.Spec{
@@ -74,3 +102,12 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
 	return nil
 }
+
+// fieldValue gives a value from a field change for display; values
+// are absent if the field is added or removed.
+func fieldValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/weaveworks/flux/daemon"
+	"github.com/weaveworks/flux/git"
+)
+
+// gitSourceFlag is an extra git source as given with --git-source,
+// e.g.,
+//
+//	url=git@github.com:example/team-a,branch=prod,path=k8s,path=crds
+//
+// Anything not given is taken from the flags for the primary repo.
+type gitSourceFlag struct {
+	URL      string
+	Branch   string
+	Paths    []string
+	SyncTag  string
+	NotesRef string
+	// Private SSH key to use for this repo, rather than the deploy
+	// key
+	Key string
+	// Directory containing the files `username` and `password`, for
+	// an https:// URL; otherwise, the credentials for the primary
+	// repo are used
+	Credentials string
+
+	credentials *git.HTTPCredentials
+}
+
+func parseGitSource(s string) (gitSourceFlag, error) {
+	var src gitSourceFlag
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return src, fmt.Errorf("expected key=value in git source %q, got %q", s, field)
+		}
+		switch value := kv[1]; kv[0] {
+		case "url":
+			src.URL = value
+		case "branch":
+			src.Branch = value
+		case "path":
+			if value[0] == '/' {
+				return src, fmt.Errorf("path in git source %q should not have leading forward slash", s)
+			}
+			src.Paths = append(src.Paths, value)
+		case "sync-tag":
+			src.SyncTag = value
+		case "notes-ref":
+			src.NotesRef = value
+		case "key":
+			src.Key = value
+		case "credentials":
+			src.Credentials = value
+		default:
+			return src, fmt.Errorf("unknown key %q in git source %q", kv[0], s)
+		}
+	}
+	if src.URL == "" {
+		return src, fmt.Errorf("no url given in git source %q", s)
+	}
+	return src, nil
+}
+
+// name gives the name under which the source is mirrored.
+func (src gitSourceFlag) name() string {
+	return src.URL + "#" + src.Branch
+}
+
+// syncStateKey gives the key under which the sync progress for a git
+// source is recorded, when not using the sync tag. That's the name of
+// the sync tag, for the primary source; but since extra sources
+// usually share the tag name, theirs are made distinct.
+func syncStateKey(src daemon.GitSource) string {
+	if src.Name == "" {
+		return src.Config.SyncTag
+	}
+	sum := sha256.Sum256([]byte(src.Name))
+	return src.Config.SyncTag + "-" + hex.EncodeToString(sum[:])[:8]
+}
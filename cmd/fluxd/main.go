@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,12 +13,14 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	k8sifclient "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -26,17 +29,23 @@ import (
 	"github.com/weaveworks/flux/cluster/kubernetes"
 	"github.com/weaveworks/flux/daemon"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/gpg"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/http/client"
 	daemonhttp "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/http/webhook"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/registry/cache"
+	registryLocal "github.com/weaveworks/flux/registry/cache/local"
 	registryMemcache "github.com/weaveworks/flux/registry/cache/memcached"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/update"
 )
 
 var version = "unversioned"
@@ -77,6 +86,7 @@ func main() {
 		listenAddr        = fs.StringP("listen", "l", ":3030", "listen address where /metrics and API will be served")
 		listenMetricsAddr = fs.String("listen-metrics", "", "listen address for /metrics endpoint")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "optional, explicit path to kubectl tool")
+		kubernetesApplier = fs.String("kubernetes-applier", "kubectl", `how to apply resources to the cluster; "kubectl" to run kubectl, or "client-go" to use the API directly`)
 		versionFlag       = fs.Bool("version", false, "get version number")
 		// Git repo & key etc.
 		gitURL       = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-get-started")
@@ -94,10 +104,42 @@ func main() {
 
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
 		gitTimeout      = fs.Duration("git-timeout", 20*time.Second, "duration after which git operations time out")
+		gitPushAttempts = fs.Int("git-push-attempts", 3, "how many times to try pushing a commit; if a push fails because of commits pushed in the meantime, fluxd's commit is rebased onto them before trying again")
+		gitCredentials  = fs.String("git-https-credentials", "", "directory containing the files 'username' and 'password' (e.g., a mounted secret), with the credentials for a git repo given as an https:// URL; otherwise, they are taken from the environment variables "+gitHTTPSUsernameVar+" and "+gitHTTPSPasswordVar+", if set")
+		gitSparse       = fs.Bool("git-sparse-checkout", false, "check out only the files under --git-path (and any .flux.yaml files above them) in the working clones used for syncs and commits")
+		gitSubmodules   = fs.Bool("git-submodules", false, "initialise git submodules in the working clones used for syncs and commits, authenticating as for the repo itself; manifests in submodules are synced, but not updated")
+		gitMirrorDepth  = fs.Int("git-mirror-depth", 0, "if more than zero, fetch only this many commits of the history of each branch and tag when first cloning the git repo; the sync tag should be within this depth of the branch head")
+		gitBackend      = fs.String("git-backend", string(git.ExecBackend), `how to carry out git operations; either "exec", to run the git executable, or "go-git", to use a pure-Go implementation (signing and verifying commits still need the git executable)`)
+		gitReadonly     = fs.Bool("git-readonly", false, "only sync from the git repo, and never write to it; releases and policy changes are refused, and sync progress is recorded in a ConfigMap (implies --sync-state=configmap)")
+		gitSources      = fs.StringArray("git-source", nil, "experimental; an extra git repo to sync from, as comma-separated key=value pairs with keys url, branch, path (repeatable), sync-tag, notes-ref, key (a private SSH key file) and credentials (a directory, as for --git-https-credentials); may be given more than once")
+		// signing and verifying commits
+		gitSigningKey       = fs.String("git-signing-key", "", "if set, fluxd will sign its commits and sync tags with this GPG key (e.g., an email address or key ID); the key must be imported, e.g., with --git-gpg-key-import")
+		gitVerifySignatures = fs.Bool("git-verify-signatures", false, "if set, fluxd will only sync commits signed by a key in its GPG keyring, stopping at the first that is not")
+		gitGPGKeyImport     = fs.StringSlice("git-gpg-key-import", nil, "GPG key(s) to import into fluxd's keyring, for signing and verifying commits; a file, or a directory of files (e.g., a mounted secret), and may be given more than once")
+		// webhooks
+		gitWebhookSecret      = fs.String("git-webhook-secret", "", "file containing the secret for webhooks that notify fluxd of pushes to the git repo, served at /hook/git/<github|gitlab|bitbucket|generic> if this is given")
+		registryWebhookSecret = fs.String("registry-webhook-secret", "", "file containing the secret for webhooks that notify fluxd of pushes to image registries, served at /hook/registry/<dockerhub|quay|harbor|gcr|generic> if this is given")
+		// pull requests
+		gitPullRequest       = fs.String("git-pull-request", "", `if set, propose commits as pull requests rather than pushing them to --git-branch; either "github" or "gitlab", for the host of the git repo`)
+		gitPullRequestToken  = fs.String("git-pull-request-token", "", "file containing an API token that can open pull requests on the git repo, with --git-pull-request")
+		gitPullRequestAPIURL = fs.String("git-pull-request-api-url", "", "base URL of the API used to open pull requests, with --git-pull-request; by default, it's worked out from the host of the git repo")
+		// commit messages
+		gitCommitTemplateRelease     = fs.String("git-commit-template-release", "", "Go template for the messages of commits made for releases; see the docs for what it's given")
+		gitCommitTemplateAutoRelease = fs.String("git-commit-template-auto-release", "", "Go template for the messages of commits made for automated releases")
+		gitCommitTemplatePolicy      = fs.String("git-commit-template-policy", "", "Go template for the messages of commits made for policy changes")
+		// manifests
+		manifestGeneration = fs.Bool("manifest-generation", false, "experimental; run the generators given in .flux.yaml files in the git repo to produce manifests, and the updaters given to change them")
 		// syncing
-		syncInterval = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncInterval      = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncGC            = fs.Bool("sync-garbage-collection", false, "experimental; delete resources that were created by fluxd, but are no longer in the git repo")
+		syncDryRun        = fs.Bool("sync-dry-run", false, "do not apply anything to the cluster; only log the changes each sync would make")
+		syncHealthTimeout = fs.Duration("sync-health-timeout", 0, "if non-zero, wait up to this long for workloads changed by a sync to finish rolling out before moving the sync tag; the tag is not moved if they do not")
+		syncState         = fs.String("sync-state", "git", `where to record sync progress; either "git", to use the sync tag, or "configmap", to use a ConfigMap in fluxd's namespace, which doesn't need write access to the git repo`)
+		syncConfigMap     = fs.String("sync-state-configmap", "flux-sync-state", "name of the ConfigMap used to record sync progress, with --sync-state=configmap")
 
 		// registry
+		registryCache     = fs.String("registry-cache", "memcached", `where to cache image metadata; either "memcached", or "local", to keep it in fluxd's memory (and optionally a file; see --registry-cache-file)`)
+		registryCacheFile = fs.String("registry-cache-file", "", `with --registry-cache=local, save the cache to this file (e.g., on a persistent volume) now and then, and load it on startup, so it needn't be refreshed from scratch after a restart`)
 		memcachedHostname = fs.String("memcached-hostname", "memcached", "hostname for memcached service.")
 		memcachedTimeout  = fs.Duration("memcached-timeout", time.Second, "maximum time to wait before giving up on memcached requests.")
 		memcachedService  = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
@@ -108,12 +150,18 @@ func main() {
 		registryTrace        = fs.Bool("registry-trace", false, "output trace of image registry requests to log")
 		registryInsecure     = fs.StringSlice("registry-insecure-host", []string{}, "let these registry hosts skip TLS host verification and fall back to using HTTP instead of HTTPS; this allows man-in-the-middle attacks, so use with extreme caution")
 		registryExcludeImage = fs.StringSlice("registry-exclude-image", []string{"k8s.gcr.io/*"}, "do not scan images that match these glob expressions; the default is to exclude the 'k8s.gcr.io/*' images")
+		registryPlatform     = fs.String("registry-platform", registry.DefaultPlatform.String(), "the platform of the cluster's nodes, as <os>/<arch> or <os>/<arch>/<variant>; where an image tag has builds for several platforms, the one for this platform is used, and tags without one are not considered for automation")
+		automationRollback   = fs.Bool("automation-rollback", false, "when the rollout of an automated release fails, commit a revert of the release and lock the workloads involved")
 
 		// AWS authentication
 		registryAWSRegions         = fs.StringSlice("registry-ecr-region", nil, "restrict ECR scanning to these AWS regions; if empty, only the cluster's region will be scanned")
 		registryAWSAccountIDs      = fs.StringSlice("registry-ecr-include-id", nil, "restrict ECR scanning to these AWS account IDs; if empty, all account IDs that aren't excluded may be scanned")
 		registryAWSBlockAccountIDs = fs.StringSlice("registry-ecr-exclude-id", []string{registry.EKS_SYSTEM_ACCOUNT}, "do not scan ECR for images in these AWS account IDs; the default is to exclude the EKS system account")
 
+		// credential helpers
+		registryCredentialHelpers   = fs.StringArray("registry-credential-helper", nil, "get credentials for registry hosts matching a glob by running a command, given as <host-glob>=<command>; the command is run as a Docker credential helper, with the argument `get` and the host on stdin; may be given more than once")
+		registryCredentialHelperTTL = fs.Duration("registry-credential-helper-ttl", 5*time.Minute, "how long to reuse the credentials from a --registry-credential-helper before running it again; this should be shorter than the credentials are valid for")
+
 		// k8s-secret backed ssh keyring configuration
 		k8sSecretName            = fs.String("k8s-secret-name", "flux-git-deploy", "name of the k8s secret used to store the private SSH key")
 		k8sSecretVolumeMountPath = fs.String("k8s-secret-volume-mount-path", "/etc/fluxd/ssh", "mount location of the k8s secret storing the private SSH key")
@@ -181,6 +229,164 @@ func main() {
 		}
 	}
 
+	{
+		var known bool
+		for _, b := range git.Backends {
+			known = known || *gitBackend == string(b)
+		}
+		if !known {
+			logger.Log("err", fmt.Sprintf("unknown git backend %q; expected one of %v", *gitBackend, git.Backends))
+			os.Exit(1)
+		}
+	}
+
+	// go-git can't do sparse checkouts, so rather than silently
+	// checking out everything, refuse
+	if *gitSparse && git.Backend(*gitBackend) == git.GoGitBackend {
+		logger.Log("err", "--git-sparse-checkout is not supported with --git-backend=go-git")
+		os.Exit(1)
+	}
+
+	// Credentials for HTTPS are given to git by a credential helper,
+	// so they're kept out of the URL.
+	var gitCreds *git.HTTPCredentials
+	*gitURL, gitCreds = splitURLCredentials(*gitURL)
+	if gitCreds != nil {
+		logger.Log("warning", "credentials given in --git-url; these will be supplied to git separately, but are better given with --git-https-credentials")
+	}
+	if *gitCredentials != "" {
+		creds, err := readHTTPCredentials(*gitCredentials)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		gitCreds = creds
+	} else if creds := envHTTPCredentials(); creds != nil {
+		gitCreds = creds
+	}
+
+	var extraGitSources []gitSourceFlag
+	for _, s := range *gitSources {
+		src, err := parseGitSource(s)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		var urlCreds *git.HTTPCredentials
+		src.URL, urlCreds = splitURLCredentials(src.URL)
+		switch {
+		case src.Credentials != "":
+			if src.credentials, err = readHTTPCredentials(src.Credentials); err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+		case urlCreds != nil:
+			logger.Log("warning", "credentials given in the url of --git-source; these will be supplied to git separately, but are better given with credentials=<dir>")
+			src.credentials = urlCreds
+		default:
+			src.credentials = gitCreds
+		}
+		if src.Branch == "" {
+			src.Branch = *gitBranch
+		}
+		if src.SyncTag == "" {
+			src.SyncTag = *gitSyncTag
+		}
+		if src.NotesRef == "" {
+			src.NotesRef = *gitNotesRef
+		}
+		extraGitSources = append(extraGitSources, src)
+	}
+
+	readWebhookSecret := func(flag, path string) []byte {
+		if path == "" {
+			return nil
+		}
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		secret = bytes.TrimSpace(secret)
+		if len(secret) == 0 {
+			logger.Log("err", fmt.Sprintf("the file given with --%s is empty", flag))
+			os.Exit(1)
+		}
+		return secret
+	}
+	webhookSecret := readWebhookSecret("git-webhook-secret", *gitWebhookSecret)
+	registryHookSecret := readWebhookSecret("registry-webhook-secret", *registryWebhookSecret)
+
+	var pullRequests pullrequest.Provider
+	if *gitPullRequest != "" {
+		if *gitReadonly {
+			logger.Log("err", "--git-pull-request cannot be used with --git-readonly, since opening a pull request needs a commit to be pushed")
+			os.Exit(1)
+		}
+		if *gitPullRequestToken == "" {
+			logger.Log("err", "--git-pull-request-token must be given with --git-pull-request")
+			os.Exit(1)
+		}
+		token, err := ioutil.ReadFile(*gitPullRequestToken)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		switch *gitPullRequest {
+		case "github":
+			pullRequests = &pullrequest.GitHub{APIURL: *gitPullRequestAPIURL, Token: string(bytes.TrimSpace(token))}
+		case "gitlab":
+			pullRequests = &pullrequest.GitLab{APIURL: *gitPullRequestAPIURL, Token: string(bytes.TrimSpace(token))}
+		default:
+			logger.Log("err", fmt.Sprintf("unknown value for --git-pull-request: %q", *gitPullRequest))
+			os.Exit(1)
+		}
+	}
+
+	if *gitPushAttempts < 1 {
+		logger.Log("err", "--git-push-attempts must be at least 1")
+		os.Exit(1)
+	}
+
+	var commitTemplates update.CommitTemplates
+	for _, t := range []struct {
+		flag     string
+		text     string
+		template **template.Template
+	}{
+		{"git-commit-template-release", *gitCommitTemplateRelease, &commitTemplates.Release},
+		{"git-commit-template-auto-release", *gitCommitTemplateAutoRelease, &commitTemplates.AutoRelease},
+		{"git-commit-template-policy", *gitCommitTemplatePolicy, &commitTemplates.Policy},
+	} {
+		if t.text == "" {
+			continue
+		}
+		parsed, err := update.ParseCommitTemplate(t.flag, t.text)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("invalid --%s: %s", t.flag, err))
+			os.Exit(1)
+		}
+		*t.template = parsed
+	}
+
+	if *gitReadonly && *automationRollback {
+		logger.Log("err", "--automation-rollback cannot be used with --git-readonly, since a rollback is committed to the git repo")
+		os.Exit(1)
+	}
+
+	if *gitReadonly && *syncState != "configmap" {
+		if fs.Changed("sync-state") {
+			logger.Log("overridden", "sync-state", "value", "configmap", "reason", "--git-readonly is set, so the sync tag can't be moved")
+		}
+		*syncState = "configmap"
+	}
+	switch *syncState {
+	case "git", "configmap":
+	default:
+		logger.Log("err", fmt.Sprintf("unknown value for --sync-state: %q", *syncState))
+		os.Exit(1)
+	}
+
 	if *sshKeygenDir == "" {
 		logger.Log("info", fmt.Sprintf("SSH keygen dir (--ssh-keygen-dir) not provided, so using the deploy key volume (--k8s-secret-volume-mount-path=%s); this may cause problems if the deploy key volume is mounted read-only", *k8sSecretVolumeMountPath))
 		*sshKeygenDir = *k8sSecretVolumeMountPath
@@ -190,6 +396,7 @@ func main() {
 	var clusterVersion string
 	var sshKeyRing ssh.KeyRing
 	var k8s cluster.Cluster
+	var syncStateFor func(daemon.GitSource) fluxsync.State
 	var k8sManifests cluster.Manifests
 	var imageCreds func() registry.ImageCreds
 	{
@@ -214,6 +421,12 @@ func main() {
 			os.Exit(1)
 		}
 
+		dynamicClientset, err := dynamic.NewForConfig(restClientConfig)
+		if err != nil {
+			logger.Log("error", fmt.Sprintf("Error building dynamic clientset: %v", err))
+			os.Exit(1)
+		}
+
 		serverVersion, err := clientset.ServerVersion()
 		if err != nil {
 			logger.Log("err", err)
@@ -227,6 +440,13 @@ func main() {
 			os.Exit(1)
 		}
 
+		if *syncState == "configmap" {
+			configMaps := clientset.Core().ConfigMaps(string(namespace))
+			syncStateFor = func(src daemon.GitSource) fluxsync.State {
+				return kubernetes.NewConfigMapSyncState(configMaps, *syncConfigMap, syncStateKey(src))
+			}
+		}
+
 		sshKeyRing, err = kubernetes.NewSSHKeyRing(kubernetes.SSHKeyRingConfig{
 			SecretAPI:             clientset.Core().Secrets(string(namespace)),
 			SecretName:            *k8sSecretName,
@@ -248,20 +468,30 @@ func main() {
 		logger.Log("identity.pub", strings.TrimSpace(publicKey.Key))
 		logger.Log("host", restClientConfig.Host, "version", clusterVersion)
 
-		kubectl := *kubernetesKubectl
-		if kubectl == "" {
-			kubectl, err = exec.LookPath("kubectl")
-		} else {
-			_, err = os.Stat(kubectl)
-		}
-		if err != nil {
-			logger.Log("err", err)
+		var applier kubernetes.Applier
+		switch *kubernetesApplier {
+		case "kubectl":
+			kubectl := *kubernetesKubectl
+			if kubectl == "" {
+				kubectl, err = exec.LookPath("kubectl")
+			} else {
+				_, err = os.Stat(kubectl)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("kubectl", kubectl)
+			applier = kubernetes.NewKubectl(kubectl, restClientConfig)
+		case "client-go":
+			logger.Log("applier", "client-go")
+			applier = kubernetes.NewClientApplier(dynamicClientset, clientset.Discovery())
+		default:
+			logger.Log("err", fmt.Sprintf("unknown value for --kubernetes-applier: %q", *kubernetesApplier))
 			os.Exit(1)
 		}
-		logger.Log("kubectl", kubectl)
 
-		kubectlApplier := kubernetes.NewKubectl(kubectl, restClientConfig)
-		k8sInst := kubernetes.NewCluster(clientset, ifclientset, kubectlApplier, sshKeyRing, logger, *k8sNamespaceWhitelist, *registryExcludeImage)
+		k8sInst := kubernetes.NewCluster(clientset, ifclientset, dynamicClientset, applier, sshKeyRing, logger, *k8sNamespaceWhitelist, *registryExcludeImage)
 
 		if err := k8sInst.Ping(); err != nil {
 			logger.Log("ping", err)
@@ -273,11 +503,27 @@ func main() {
 		imageCreds = k8sInst.ImagesToFetch
 		// There is only one way we currently interpret a repo of
 		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+		k8sManifests = &kubernetes.Manifests{Generate: *manifestGeneration}
 	}
 
-	// Wrap the procedure for collecting images to scan
+	// Wrap the procedure for collecting images to scan. Credentials
+	// given by an image pull secret are used first, then those from
+	// the wrappers, innermost first.
 	{
+		var helpers []registry.CredentialProvider
+		for _, spec := range *registryCredentialHelpers {
+			helper, err := registry.ParseCredentialHelper(spec, *registryCredentialHelperTTL, log.With(logger, "component", "credential-helper"))
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("info", "using credential helper", "helper", helper)
+			helpers = append(helpers, helper)
+		}
+		if len(helpers) > 0 {
+			imageCreds = registry.ImageCredsWithProviders(imageCreds, helpers...)
+		}
+
 		awsConf := registry.AWSRegistryConfig{
 			Regions:    *registryAWSRegions,
 			AccountIDs: *registryAWSAccountIDs,
@@ -297,6 +543,7 @@ func main() {
 				imageCreds = credsWithDefaults
 			}
 		}
+		imageCreds = registry.ImageCredsWithProviders(imageCreds, registry.GCPCredentialProvider{}, registry.AzureCredentialProvider{})
 	}
 
 	// Registry components
@@ -305,26 +552,52 @@ func main() {
 	{
 		// Cache client, for use by registry and cache warmer
 		var cacheClient cache.Client
-		var memcacheClient *registryMemcache.MemcacheClient
-		memcacheConfig := registryMemcache.MemcacheConfig{
-			Host:           *memcachedHostname,
-			Service:        *memcachedService,
-			Timeout:        *memcachedTimeout,
-			UpdateInterval: 1 * time.Minute,
-			Logger:         log.With(logger, "component", "memcached"),
-			MaxIdleConns:   *registryBurst,
-		}
-
-		// if no memcached service is specified use the ClusterIP name instead of SRV records
-		if *memcachedService == "" {
-			memcacheClient = registryMemcache.NewFixedServerMemcacheClient(memcacheConfig,
-				fmt.Sprintf("%s:11211", *memcachedHostname))
-		} else {
-			memcacheClient = registryMemcache.NewMemcacheClient(memcacheConfig)
+		switch *registryCache {
+		case "local":
+			localClient := registryLocal.NewClient(registryLocal.Config{
+				Path:   *registryCacheFile,
+				Logger: log.With(logger, "component", "cache"),
+			})
+			defer localClient.Stop()
+			cacheClient = cache.InstrumentClient(localClient)
+		case "memcached":
+			var memcacheClient *registryMemcache.MemcacheClient
+			memcacheConfig := registryMemcache.MemcacheConfig{
+				Host:           *memcachedHostname,
+				Service:        *memcachedService,
+				Timeout:        *memcachedTimeout,
+				UpdateInterval: 1 * time.Minute,
+				Logger:         log.With(logger, "component", "memcached"),
+				MaxIdleConns:   *registryBurst,
+			}
+
+			// if no memcached service is specified use the ClusterIP name instead of SRV records
+			if *memcachedService == "" {
+				memcacheClient = registryMemcache.NewFixedServerMemcacheClient(memcacheConfig,
+					fmt.Sprintf("%s:11211", *memcachedHostname))
+			} else {
+				memcacheClient = registryMemcache.NewMemcacheClient(memcacheConfig)
+			}
+
+			defer memcacheClient.Stop()
+			cacheClient = cache.InstrumentClient(memcacheClient)
+		default:
+			logger.Log("err", fmt.Sprintf(`--registry-cache must be "memcached" or "local", not %q`, *registryCache))
+			os.Exit(1)
 		}
 
-		defer memcacheClient.Stop()
-		cacheClient = cache.InstrumentClient(memcacheClient)
+		// Image metadata depends on the platform, so keep it apart
+		// from that cached for other platforms. The default
+		// platform's entries keep the usual keys, so that a cache
+		// filled before the platform could be chosen is still good.
+		platform, err := registry.ParsePlatform(*registryPlatform)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		if platform != registry.DefaultPlatform {
+			cacheClient = cache.PrefixKeys(cacheClient, platform.String())
+		}
 
 		cacheRegistry = &cache.Cache{
 			Reader: cacheClient,
@@ -343,10 +616,10 @@ func main() {
 			Limiters:      registryLimits,
 			Trace:         *registryTrace,
 			InsecureHosts: *registryInsecure,
+			Platform:      platform,
 		}
 
 		// Warmer
-		var err error
 		cacheWarmer, err = cache.NewWarmer(remoteFactory, cacheClient, *registryBurst)
 		if err != nil {
 			logger.Log("err", err)
@@ -393,17 +666,47 @@ func main() {
 
 	gitRemote := git.Remote{URL: *gitURL}
 	gitConfig := git.Config{
-		Paths:       *gitPath,
-		Branch:      *gitBranch,
-		SyncTag:     *gitSyncTag,
-		NotesRef:    *gitNotesRef,
-		UserName:    *gitUser,
-		UserEmail:   *gitEmail,
-		SetAuthor:   *gitSetAuthor,
-		SkipMessage: *gitSkipMessage,
+		Paths:            *gitPath,
+		Branch:           *gitBranch,
+		SyncTag:          *gitSyncTag,
+		NotesRef:         *gitNotesRef,
+		UserName:         *gitUser,
+		UserEmail:        *gitEmail,
+		SetAuthor:        *gitSetAuthor,
+		SkipMessage:      *gitSkipMessage,
+		SigningKey:       *gitSigningKey,
+		VerifySignatures: *gitVerifySignatures,
+		SparseCheckout:   *gitSparse,
+		PushAttempts:     *gitPushAttempts,
+		Submodules:       *gitSubmodules,
+	}
+
+	for _, path := range *gitGPGKeyImport {
+		imported, err := gpg.ImportKeys(path)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		logger.Log("info", "imported GPG keys", "files", strings.Join(imported, ", "))
+	}
+
+	// Options for the primary repo and any extra sources. go-git
+	// doesn't use the SSH config that points git at the private key,
+	// so it must be given the key explicitly.
+	_, privateKeyPath := sshKeyRing.KeyPair()
+	commonRepoOptions := []git.Option{git.Backend(*gitBackend), git.MirrorDepth(*gitMirrorDepth)}
+	if git.Backend(*gitBackend) == git.GoGitBackend {
+		commonRepoOptions = append(commonRepoOptions, git.SSHKey(privateKeyPath))
 	}
 
-	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout))
+	repoOptions := append([]git.Option{git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout)}, commonRepoOptions...)
+	if *gitReadonly {
+		repoOptions = append(repoOptions, git.ReadOnly)
+	}
+	if gitCreds != nil {
+		repoOptions = append(repoOptions, *gitCreds)
+	}
+	repo := git.NewRepo(gitRemote, repoOptions...)
 	{
 		shutdownWg.Add(1)
 		go func() {
@@ -421,8 +724,55 @@ func main() {
 		"sync-tag", *gitSyncTag,
 		"notes-ref", *gitNotesRef,
 		"set-author", *gitSetAuthor,
+		"readonly", *gitReadonly,
+		"backend", *gitBackend,
+		"sparse-checkout", *gitSparse,
+		"submodules", *gitSubmodules,
+		"mirror-depth", *gitMirrorDepth,
+		"push-attempts", *gitPushAttempts,
+		"https-credentials", gitCreds != nil,
+		"signing-key", *gitSigningKey,
+		"verify-signatures", *gitVerifySignatures,
+		"pull-request", *gitPullRequest,
 	)
 
+	var gitMirrors *git.Mirrors
+	var daemonGitSources []daemon.GitSource
+	if len(extraGitSources) > 0 {
+		gitMirrors = git.NewMirrors()
+		for _, src := range extraGitSources {
+			options := append([]git.Option{git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout)}, commonRepoOptions...)
+			if *gitReadonly {
+				options = append(options, git.ReadOnly)
+			}
+			if src.Key != "" {
+				options = append(options, git.SSHKey(src.Key))
+			}
+			if src.credentials != nil {
+				options = append(options, *src.credentials)
+			}
+			gitMirrors.Mirror(src.name(), git.Remote{URL: src.URL}, options...)
+			repo, _ := gitMirrors.Get(src.name())
+			config := gitConfig
+			config.Branch = src.Branch
+			config.Paths = src.Paths
+			config.SyncTag = src.SyncTag
+			config.NotesRef = src.NotesRef
+			daemonGitSources = append(daemonGitSources, daemon.GitSource{
+				Name:   src.name(),
+				Repo:   repo,
+				Config: config,
+			})
+			logger.Log("url", src.URL, "branch", src.Branch, "sync-tag", src.SyncTag, "notes-ref", src.NotesRef)
+		}
+		shutdownWg.Add(1)
+		go func() {
+			defer shutdownWg.Done()
+			<-shutdown
+			gitMirrors.StopAllAndWait()
+		}()
+	}
+
 	var jobs *job.Queue
 	{
 		jobs = job.NewQueue(shutdown, shutdownWg)
@@ -439,9 +789,19 @@ func main() {
 		Jobs:           jobs,
 		JobStatusCache: &job.StatusCache{Size: 100},
 		Logger:         log.With(logger, "component", "daemon"),
+		// Extra git sources
+		ExtraGitSources: daemonGitSources,
+		GitMirrors:      gitMirrors,
+		SyncState:       syncStateFor,
+		PullRequests:    pullRequests,
+		CommitTemplates: commitTemplates,
 		LoopVars: &daemon.LoopVars{
-			SyncInterval:         *syncInterval,
-			RegistryPollInterval: *registryPollInterval,
+			SyncInterval:          *syncInterval,
+			SyncGarbageCollection: *syncGC,
+			DryRun:                *syncDryRun,
+			SyncHealthTimeout:     *syncHealthTimeout,
+			AutomationRollback:    *automationRollback,
+			RegistryPollInterval:  *registryPollInterval,
 		},
 	}
 
@@ -490,6 +850,29 @@ func main() {
 		}
 		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
 		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
+		if webhookSecret != nil {
+			sources := []webhook.GitSource{{URL: *gitURL, Branch: *gitBranch, Repo: repo}}
+			for _, src := range daemonGitSources {
+				sources = append(sources, webhook.GitSource{URL: src.Repo.Origin().URL, Branch: src.Config.Branch, Repo: src.Repo})
+			}
+			mux.Handle("/hook/git/", webhook.NewHandler(webhookSecret, sources, log.With(logger, "component", "webhook")))
+		}
+		if registryHookSecret != nil {
+			hookLogger := log.With(logger, "component", "webhook")
+			// Have the warmer look at the image straight away, and
+			// the daemon look for automated workloads to update.
+			// Don't hold up the webhook if the warmer is busy; the
+			// image will be seen in due course anyway.
+			notify := func(name image.Name) {
+				select {
+				case daemon.ImageRefresh <- name:
+				default:
+					hookLogger.Log("image", name.String(), "err", "too many images queued for refresh; dropping")
+				}
+				daemon.AskForImagePoll()
+			}
+			mux.Handle("/hook/registry/", webhook.NewRegistryHandler(registryHookSecret, notify, hookLogger))
+		}
 		logger.Log("addr", *listenAddr)
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
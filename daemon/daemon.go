@@ -3,6 +3,9 @@ package daemon
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -15,6 +18,7 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/cluster"
@@ -24,9 +28,11 @@ import (
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -53,6 +59,21 @@ type Daemon struct {
 	JobStatusCache *job.StatusCache
 	EventWriter    event.EventWriter
 	Logger         log.Logger
+	// ExtraGitSources are synced along with Repo; GitMirrors, if
+	// given, mirrors their repos, and tells the daemon when they
+	// change.
+	ExtraGitSources []GitSource
+	GitMirrors      *git.Mirrors
+	// SyncState, if given, says where to record how far each git
+	// source has been synced; otherwise, it's recorded by moving the
+	// source's sync tag.
+	SyncState func(GitSource) fluxsync.State
+	// PullRequests, if given, is used to propose commits as pull
+	// requests, rather than pushing them to the branch being synced.
+	PullRequests pullrequest.Provider
+	// CommitTemplates, if given, are used for the messages of the
+	// commits made for each kind of update.
+	CommitTemplates update.CommitTemplates
 	// bookkeeping
 	*LoopVars
 }
@@ -72,14 +93,9 @@ func (d *Daemon) Export(ctx context.Context) ([]byte, error) {
 	return d.Cluster.Export()
 }
 
-func (d *Daemon) getResources(ctx context.Context) (map[string]resource.Resource, v6.ReadOnlyReason, error) {
-	var resources map[string]resource.Resource
+func (d *Daemon) getResources(ctx context.Context) (map[string]resource.Resource, map[string]bool, v6.ReadOnlyReason, error) {
 	var globalReadOnly v6.ReadOnlyReason
-	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
-		var err error
-		resources, err = d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
-		return err
-	})
+	resources, inSubmodule, err := d.loadAllResourcesAndSubmodules(ctx)
 
 	// The reason something is missing from the map differs depending
 	// on the state of the git repo.
@@ -90,12 +106,12 @@ func (d *Daemon) getResources(ctx context.Context) (map[string]resource.Resource
 	case err == git.ErrNoConfig:
 		globalReadOnly = v6.ReadOnlyNoRepo
 	case err != nil:
-		return nil, globalReadOnly, manifestLoadError(err)
+		return nil, nil, globalReadOnly, manifestLoadError(err)
 	default:
 		globalReadOnly = v6.ReadOnlyMissing
 	}
 
-	return resources, globalReadOnly, nil
+	return resources, inSubmodule, globalReadOnly, nil
 }
 
 func (d *Daemon) ListServices(ctx context.Context, namespace string) ([]v6.ControllerStatus, error) {
@@ -118,7 +134,7 @@ func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v11.ListServi
 		return nil, errors.Wrap(err, "getting services from cluster")
 	}
 
-	resources, missingReason, err := d.getResources(ctx)
+	resources, inSubmodule, missingReason, err := d.getResources(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +151,10 @@ func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v11.ListServi
 			readOnly = missingReason
 		case service.IsSystem:
 			readOnly = v6.ReadOnlySystem
+		case d.Repo.IsReadOnly():
+			readOnly = v6.ReadOnlyMode
+		case inSubmodule[service.ID.String()]:
+			readOnly = v6.ReadOnlySubmodule
 		}
 		var syncError string
 		if service.SyncError != nil {
@@ -194,7 +214,7 @@ func (d *Daemon) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesO
 		}
 	}
 
-	resources, _, err := d.getResources(ctx)
+	resources, _, _, err := d.getResources(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +290,12 @@ func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 			return result, err
 		}
 		logger.Log("revision", result.Revision)
+		if result.PullRequest != "" {
+			// The commit isn't in the branch being synced until the
+			// pull request is merged; it'll show up as a sync then.
+			logger.Log("pullRequest", result.PullRequest)
+			return result, nil
+		}
 		if result.Revision != "" {
 			var serviceIDs []flux.ResourceID
 			for id, result := range result.Result {
@@ -325,14 +351,39 @@ func (d *Daemon) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID,
 	}
 	switch s := spec.Spec.(type) {
 	case release.Changes:
+		releaseOwned := func(owned func(flux.ResourceID) bool) (updateFunc, bool) {
+			changes, ok := ownedChanges(s, owned)
+			return d.release(spec, changes), ok
+		}
 		if s.ReleaseKind() == update.ReleaseKindPlan {
 			id := job.ID(guid.New())
-			_, err := d.executeJob(id, d.makeJobFromUpdate(d.release(spec, s)), d.Logger)
+			_, err := d.executeJob(id, d.makeJobFromSourceUpdate(releaseOwned), d.Logger)
 			return id, err
 		}
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, s)))), nil
+		if d.Repo.IsReadOnly() {
+			return id, errReadOnly
+		}
+		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromSourceUpdate(releaseOwned))), nil
 	case policy.Updates:
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicy(spec, s)))), nil
+		if d.Repo.IsReadOnly() {
+			return id, errReadOnly
+		}
+		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromSourceUpdate(func(owned func(flux.ResourceID) bool) (updateFunc, bool) {
+			updates, ok := ownedPolicyUpdates(s, owned)
+			return d.updatePolicy(spec, updates), ok
+		}))), nil
+	case update.PromoteSpec:
+		// Promotions are between paths in the git repo, so only the
+		// primary git source takes part.
+		if s.ReleaseKind() == update.ReleaseKindPlan {
+			id := job.ID(guid.New())
+			_, err := d.executeJob(id, d.makeJobFromUpdate(d.promote(spec, s)), d.Logger)
+			return id, err
+		}
+		if d.Repo.IsReadOnly() {
+			return id, errReadOnly
+		}
+		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.promote(spec, s)))), nil
 	case update.ManualSync:
 		return d.queueJob(d.sync()), nil
 	default:
@@ -372,42 +423,48 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 		// automation run straight ASAP.
 		var anythingAutomated bool
 
+		// Manifests in submodules can't be changed by committing to
+		// the repo, so those are skipped
+		var resources map[string]resource.Resource
+		if len(working.Submodules()) > 0 {
+			var err error
+			resources, err = d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+			if err != nil {
+				return result, manifestLoadError(err)
+			}
+		}
+
 		for serviceID, u := range updates {
+			if res, ok := resources[serviceID.String()]; ok && working.InSubmodule(res.Source()) {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
+					Error:  update.InSubmodule,
+				}
+				continue
+			}
 			if policy.Set(u.Add).Has(policy.Automated) {
 				anythingAutomated = true
 			}
-			// find the service manifest
-			err := cluster.UpdateManifest(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, func(def []byte) ([]byte, error) {
-				newDef, err := d.Manifests.UpdatePolicies(def, serviceID, u)
-				if err != nil {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-					return nil, err
+			// find the service manifest, and update it
+			changed, err := cluster.UpdatePolicies(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, u)
+			switch {
+			case err != nil:
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusFailed,
+					Error:  err.Error(),
 				}
-				if string(newDef) == string(def) {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSkipped,
-					}
-				} else {
-					serviceIDs = append(serviceIDs, serviceID)
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSuccess,
-					}
-				}
-				return newDef, nil
-			})
-			if err != nil {
-				switch err := err.(type) {
-				case cluster.ManifestError:
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-				default:
+				if _, ok := err.(cluster.ManifestError); !ok {
 					return result, err
 				}
+			case changed:
+				serviceIDs = append(serviceIDs, serviceID)
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSuccess,
+				}
+			default:
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
+				}
 			}
 		}
 		if len(serviceIDs) == 0 {
@@ -418,8 +475,12 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 		if d.GitConfig.SetAuthor {
 			commitAuthor = spec.Cause.User
 		}
-		commitAction := git.CommitAction{Author: commitAuthor, Message: policyCommitMessage(updates, spec.Cause)}
-		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec}); err != nil {
+		commitMsg, err := d.CommitTemplates.Message(spec, result.Result, policyCommitMessage(updates, spec.Cause))
+		if err != nil {
+			return result, err
+		}
+		commitAction := git.CommitAction{Author: commitAuthor, Message: commitMsg}
+		if err := d.commitAndPush(ctx, working, commitAction, &job.Note{JobID: jobID, Spec: spec}, &result); err != nil {
 			// On the chance pushing failed because it was not
 			// possible to fast-forward, ask for a sync so the
 			// next attempt is more likely to succeed.
@@ -429,12 +490,6 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 		if anythingAutomated {
 			d.AskForImagePoll()
 		}
-
-		var err error
-		result.Revision, err = working.HeadRevision(ctx)
-		if err != nil {
-			return result, err
-		}
 		return result, nil
 	}
 }
@@ -449,19 +504,25 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 			return zero, err
 		}
 
-		var revision string
-
+		jobResult := job.Result{
+			Spec:   &spec,
+			Result: result,
+		}
 		if c.ReleaseKind() == update.ReleaseKindExecute {
 			commitMsg := spec.Cause.Message
 			if commitMsg == "" {
 				commitMsg = c.CommitMessage(result)
 			}
+			commitMsg, err = d.CommitTemplates.Message(spec, result, commitMsg)
+			if err != nil {
+				return zero, err
+			}
 			commitAuthor := ""
 			if d.GitConfig.SetAuthor {
 				commitAuthor = spec.Cause.User
 			}
 			commitAction := git.CommitAction{Author: commitAuthor, Message: commitMsg}
-			if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}); err != nil {
+			if err := d.commitAndPush(ctx, working, commitAction, &job.Note{JobID: jobID, Spec: spec, Result: result}, &jobResult); err != nil {
 				// On the chance pushing failed because it was not
 				// possible to fast-forward, ask the repo to fetch
 				// from upstream ASAP, so the next attempt is more
@@ -469,17 +530,87 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 				d.Repo.Notify()
 				return zero, err
 			}
-			revision, err = working.HeadRevision(ctx)
-			if err != nil {
-				return zero, err
+		}
+		return jobResult, nil
+	}
+}
+
+// promote works out the changes that make up a promotion from the
+// working clone, then releases them as for any other release.
+func (d *Daemon) promote(spec update.Spec, s update.PromoteSpec) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		changes, err := release.Promotion(rc, s)
+		if err != nil {
+			return job.Result{}, err
+		}
+		return d.release(spec, changes)(ctx, jobID, working, logger)
+	}
+}
+
+// commitAndPush commits the changes made in the working clone, and
+// either pushes the commit to the branch being synced, or, if the
+// daemon has a pull request provider, pushes it to a branch of its
+// own and opens a pull request for it. The revision committed, the
+// pull request opened, if there was one, and the number of attempts
+// it took to push are recorded in the job result given.
+func (d *Daemon) commitAndPush(ctx context.Context, working *git.Checkout, commitAction git.CommitAction, n *job.Note, result *job.Result) error {
+	if d.PullRequests == nil {
+		err := working.CommitAndPush(ctx, commitAction, n)
+		result.PushAttempts = working.PushAttempts()
+		if err != nil {
+			if result.PushAttempts > 1 {
+				return errors.Wrapf(err, "pushing commit, after %d attempts", result.PushAttempts)
 			}
+			return err
 		}
-		return job.Result{
-			Revision: revision,
-			Spec:     &spec,
-			Result:   result,
-		}, nil
+		result.Revision, err = working.HeadRevision(ctx)
+		return err
+	}
+
+	branch, err := pullRequestBranch(n)
+	if err != nil {
+		return err
+	}
+	revision, err := working.CommitAndPushBranch(ctx, branch, commitAction, n)
+	if err != nil {
+		return err
+	}
+	result.Revision = revision
+	title := commitAction.Message
+	if i := strings.Index(title, "\n"); i >= 0 {
+		title = title[:i]
+	}
+	pullRequest, err := d.PullRequests.Open(ctx, pullrequest.Request{
+		RepoURL:     working.Origin().URL,
+		Base:        working.Branch(),
+		Head:        branch,
+		Title:       title,
+		Description: commitAction.Message,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "opening pull request for branch %s", branch)
 	}
+	result.PullRequest = pullRequest
+	return nil
+}
+
+// pullRequestBranch names the branch to push a commit to, to be
+// proposed as a pull request. Automated releases are repeated each
+// time the registry is polled until they're merged, so the branch is
+// named for the changes made; that way, a repeat finds the branch
+// and the pull request already there. Otherwise, the branch is named
+// for the job.
+func pullRequestBranch(n *job.Note) (string, error) {
+	if n.Spec.Type != update.Auto {
+		return "flux/" + string(n.JobID), nil
+	}
+	result, err := json.Marshal(n.Result)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(result)
+	return "flux/auto-" + hex.EncodeToString(sum[:])[:12], nil
 }
 
 // Tell the daemon to synchronise the cluster with the manifests in
@@ -490,15 +621,21 @@ func (d *Daemon) NotifyChange(ctx context.Context, change v9.Change) error {
 	switch change.Kind {
 	case v9.GitChange:
 		gitUpdate := change.Source.(v9.GitUpdate)
-		if gitUpdate.URL != d.Repo.Origin().URL && gitUpdate.Branch != d.GitConfig.Branch {
+		var notified bool
+		for _, src := range d.gitSources() {
+			if gitUpdate.URL != src.Repo.Origin().URL || gitUpdate.Branch != src.Config.Branch {
+				continue
+			}
+			src.Repo.Notify()
+			notified = true
+		}
+		if !notified {
 			// It isn't strictly an _error_ to be notified about a repo/branch pair
 			// that isn't ours, but it's worth logging anyway for debugging.
 			d.Logger.Log("msg", "notified about unrelated change",
 				"url", gitUpdate.URL,
 				"branch", gitUpdate.Branch)
-			break
 		}
-		d.Repo.Notify()
 	case v9.ImageChange:
 		imageUpdate := change.Source.(v9.ImageUpdate)
 		d.ImageRefresh <- imageUpdate.Name
@@ -515,26 +652,76 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 		return status, nil
 	}
 
+	// The notes of the commits last synced are kept with the sync
+	// state, if that's outside the repo; looking there is quicker
+	// than looking through the commits.
+	for _, src := range d.gitSources() {
+		found, err := d.jobStatusFromSyncState(ctx, src, jobID, &status)
+		if err != nil || found {
+			return status, err
+		}
+	}
+
 	// Look through the commits for a note referencing this job.  This
 	// means that even if fluxd restarts, we will at least remember
 	// jobs which have pushed a commit.
 	// FIXME(michael): consider looking at the repo for this, since read op
-	err := d.WithClone(ctx, func(working *git.Checkout) error {
+	for _, src := range d.gitSources() {
+		found, err := jobStatusFromNotes(ctx, src, jobID, &status)
+		if err != nil || found {
+			return status, err
+		}
+	}
+	return status, unknownJobError(jobID)
+}
+
+// jobStatusFromSyncState looks for a note referencing the job among
+// those recorded with the last sync of the git source given.
+func (d *Daemon) jobStatusFromSyncState(ctx context.Context, src GitSource, jobID job.ID, status *job.Status) (bool, error) {
+	if d.SyncState == nil {
+		return false, nil
+	}
+	notes, err := d.SyncState(src).GetNotes(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "getting notes from sync state")
+	}
+	for rev, n := range notes {
+		if n.JobID == jobID {
+			spec := n.Spec
+			*status = job.Status{
+				StatusString: job.StatusSucceeded,
+				Result: job.Result{
+					Revision: rev,
+					Spec:     &spec,
+					Result:   n.Result,
+				},
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// jobStatusFromNotes looks for a commit in the git source given with
+// a note referencing the job.
+func jobStatusFromNotes(ctx context.Context, src GitSource, jobID job.ID, status *job.Status) (bool, error) {
+	var found bool
+	err := src.withClone(ctx, func(working *git.Checkout) error {
 		notes, err := working.NoteRevList(ctx)
 		if err != nil {
 			return errors.Wrap(err, "enumerating commit notes")
 		}
-		commits, err := d.Repo.CommitsBefore(ctx, "HEAD", d.GitConfig.Paths...)
+		commits, err := src.Repo.CommitsBefore(ctx, "HEAD", src.Config.Paths...)
 		if err != nil {
 			return errors.Wrap(err, "checking revisions for status")
 		}
 
 		for _, commit := range commits {
 			if _, ok := notes[commit.Revision]; ok {
-				var n note
+				var n job.Note
 				ok, err := working.GetNote(ctx, commit.Revision, &n)
 				if ok && err == nil && n.JobID == jobID {
-					status = job.Status{
+					*status = job.Status{
 						StatusString: job.StatusSucceeded,
 						Result: job.Result{
 							Revision: commit.Revision,
@@ -542,13 +729,14 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 							Result:   n.Result,
 						},
 					}
+					found = true
 					return nil
 				}
 			}
 		}
-		return unknownJobError(jobID)
+		return nil
 	})
-	return status, err
+	return found, err
 }
 
 // Ask the daemon how far it's got applying things; in particular, is it
@@ -557,10 +745,25 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 // you'll get all the commits yet to be applied. If you send a hash
 // and it's applied at or _past_ it, you'll get an empty list.
 func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, error) {
-	commits, err := d.Repo.CommitsBetween(ctx, d.GitConfig.SyncTag, commitRef, d.GitConfig.Paths...)
+	// The ref could be in any of the git sources; try each in turn.
+	var commits []git.Commit
+	var err error
+	var src GitSource
+	for _, src = range d.gitSources() {
+		commits, err = d.commitsSinceSync(ctx, src, commitRef)
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	// If syncing is stuck at a commit that isn't signed, what's
+	// outstanding won't be synced; say so rather than leave the
+	// caller waiting.
+	if unverified, ok := d.unverifiedCommits.get(src.Name); ok && len(commits) > 0 {
+		return nil, unverifiedCommitError(unverified.Revision)
+	}
 	// NB we could use the messages too if we decide to change the
 	// signature of the API to include it.
 	revs := make([]string, len(commits))
@@ -570,6 +773,68 @@ func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, er
 	return revs, nil
 }
 
+func (d *Daemon) commitsSinceSync(ctx context.Context, src GitSource, commitRef string) ([]git.Commit, error) {
+	if d.SyncState == nil {
+		return src.Repo.CommitsBetween(ctx, src.Config.SyncTag, commitRef, src.Config.Paths...)
+	}
+	synced, err := d.SyncState(src).GetRevision(ctx)
+	switch {
+	case err != nil:
+		return nil, err
+	case synced == "":
+		return src.Repo.CommitsBefore(ctx, commitRef, src.Config.Paths...)
+	default:
+		return src.Repo.CommitsBetween(ctx, synced, commitRef, src.Config.Paths...)
+	}
+}
+
+// SyncDryRun reports what syncing the HEAD of the git repo would do
+// to the cluster, without applying anything.
+func (d *Daemon) SyncDryRun(ctx context.Context) ([]cluster.ResourceChange, error) {
+	for _, src := range d.gitSources() {
+		if err := src.Repo.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sources, resources, _, err := d.loadSourceResources(ctx)
+	if err == nil {
+		_, err = mergeResources(sources, resources)
+	}
+	if err != nil {
+		return nil, manifestLoadError(err)
+	}
+	return fluxsync.DryRunSets(d.Logger, d.Manifests, syncSets(sources, resources), d.Cluster, d.SyncGarbageCollection)
+}
+
+// ListResources reports on each resource defined in the repo, and
+// the outcome of the last sync as it concerns that resource.
+func (d *Daemon) ListResources(ctx context.Context, namespace string) ([]v12.ResourceStatus, error) {
+	resources, err := d.loadAllResources(ctx)
+	if err != nil {
+		return nil, manifestLoadError(err)
+	}
+
+	var res []v12.ResourceStatus
+	for _, r := range resources {
+		id := r.ResourceID()
+		if ns, _, _ := id.Components(); namespace != "" && ns != namespace {
+			continue
+		}
+		record := d.syncRecords.get(id)
+		res = append(res, v12.ResourceStatus{
+			ID:                  id,
+			Source:              r.Source(),
+			LastAppliedRevision: record.lastAppliedRevision,
+			SyncError:           record.syncError,
+			Ignore:              r.Policy().Has(policy.Ignore) || record.skipped,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.String() < res[j].ID.String()
+	})
+	return res, nil
+}
+
 func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConfig, error) {
 	publicSSHKey, err := d.Cluster.PublicSSHKey(regenerate)
 	if err != nil {
@@ -28,6 +28,7 @@ import (
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
@@ -489,6 +490,101 @@ func TestDaemon_PolicyUpdate(t *testing.T) {
 	}, "Waiting for new annotation")
 }
 
+// When the daemon has a pull request provider, an update should be
+// pushed to a branch of its own and proposed as a pull request, and
+// the branch being synced should be left as it is
+func TestDaemon_PullRequest(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	pullRequests := &pullrequest.Mock{}
+	d.PullRequests = pullRequests
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	before, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := updatePolicy(ctx, t, d)
+	stat := w.ForJobSucceeded(d, id)
+	if stat.Result.PullRequest != "mock/1" {
+		t.Errorf("expected the job result to refer to pull request mock/1, got %q", stat.Result.PullRequest)
+	}
+
+	opened := pullRequests.Opened()
+	if len(opened) != 1 {
+		t.Fatalf("expected one pull request to be opened, got %+v", opened)
+	}
+	head := "flux/" + string(id)
+	if opened[0].Base != d.GitConfig.Branch || opened[0].Head != head {
+		t.Errorf("expected a pull request from %s to %s, got %+v", head, d.GitConfig.Branch, opened[0])
+	}
+
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("expected %s to be left at %s, but it is at %s", d.GitConfig.Branch, before, after)
+	}
+	proposed, err := d.Repo.Revision(ctx, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposed != stat.Result.Revision {
+		t.Errorf("expected %s to be at %s, but it is at %s", head, stat.Result.Revision, proposed)
+	}
+}
+
+// When the repo is read-only, I should be able to see the services,
+// but not change them
+func TestDaemon_ReadOnly(t *testing.T) {
+	d, _, clean, _, _, _ := mockDaemon(t)
+	defer clean()
+
+	ctx := context.Background()
+	repo := git.NewRepo(d.Repo.Origin(), git.ReadOnly)
+	defer repo.Clean()
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.Repo = repo
+
+	services, err := d.ListServices(ctx, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].ReadOnly != v6.ReadOnlyMode {
+		t.Errorf("expected the service to be read-only with reason %q, got %+v", v6.ReadOnlyMode, services)
+	}
+
+	for _, spec := range []update.Spec{
+		{
+			Type: update.Policy,
+			Spec: policy.Updates{
+				flux.MustParseResourceID(svc): {Add: policy.Set{policy.Locked: "true"}},
+			},
+		},
+		{
+			Type: update.Images,
+			Spec: update.ReleaseImageSpec{
+				ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
+				ImageSpec:    update.ImageSpecLatest,
+				Kind:         update.ReleaseKindExecute,
+			},
+		},
+	} {
+		if _, err := d.UpdateManifests(ctx, spec); err != errReadOnly {
+			t.Errorf("expected read-only error for %s update, got %v", spec.Type, err)
+		}
+	}
+}
+
 // When I call sync status, it should return a commit showing the sync
 // that is about to take place. Then it should return empty once it is
 // complete
@@ -586,6 +682,129 @@ func TestDaemon_Automated_semver(t *testing.T) {
 	w.ForImageTag(t, d, resid.String(), container, "3")
 }
 
+// When an automated release fails to roll out, it's reverted and the
+// workload is locked
+func TestDaemon_RollbackAutomated(t *testing.T) {
+	d, start, clean, k8s, events, _ := mockDaemon(t)
+
+	// The cluster runs the released image, but the rollout is stuck
+	id := flux.MustParseResourceID(svc)
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{{
+			ID:     id,
+			Status: cluster.StatusError,
+			Rollout: cluster.RolloutStatus{
+				Messages: []string{"ReplicaSet has timed out progressing"},
+			},
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{
+					{
+						Name:  container,
+						Image: mustParseImageRef(newHelloImage),
+					},
+				},
+			},
+		}}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+	ctx := context.Background()
+
+	// Release the image, as automation would have
+	w.ForJobSucceeded(d, updateImage(ctx, d, t))
+	w.ForImageTag(t, d, svc, container, "2")
+
+	d.autoReleases.watch("abcdef0123456789", update.Result{
+		id: update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{{
+				Container: container,
+				Current:   mustParseImageRef(currentHelloImage),
+				Target:    mustParseImageRef(newHelloImage),
+			}},
+		},
+	})
+	d.checkAutoReleases(log.NewNopLogger())
+
+	w.ForImageTag(t, d, svc, container, "master-a000001")
+	co, err := d.Repo.Clone(ctx, d.GitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer co.Clean()
+	m, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDirs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := m[svc].Policy()
+	if !policies.Has(policy.Locked) {
+		t.Errorf("expected %s to be locked, has policies %v", svc, policies)
+	}
+	if msg, _ := policies.Get(policy.LockedMsg); !strings.Contains(msg, "abcdef0") {
+		t.Errorf("expected locked_msg to mention the rolled back revision, got %q", msg)
+	}
+
+	w.Eventually(func() bool {
+		es, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+		for _, e := range es {
+			if e.Type == event.EventRollback {
+				return e.Metadata.(*event.RollbackEventMetadata).RolledBack == "abcdef0123456789"
+			}
+		}
+		return false
+	}, "Waiting for rollback event")
+
+	// It's not rolled back twice
+	if len(d.autoReleases.watched()) != 0 {
+		t.Error("expected rolled back release not to be watched any more")
+	}
+}
+
+// Rollout problems reported before the released definition has been
+// observed (e.g., left over from an earlier rollout) don't mean the
+// release failed
+func TestDaemon_RollbackAutomatedNotObserved(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+
+	id := flux.MustParseResourceID(svc)
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{{
+			ID:     id,
+			Status: cluster.StatusStarted,
+			Rollout: cluster.RolloutStatus{
+				Messages: []string{"ReplicaSet has timed out progressing"},
+			},
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{
+					{
+						Name:  container,
+						Image: mustParseImageRef(newHelloImage),
+					},
+				},
+			},
+		}}, nil
+	}
+	start()
+	defer clean()
+
+	d.autoReleases.watch("abcdef0123456789", update.Result{
+		id: update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{{
+				Container: container,
+				Current:   mustParseImageRef(currentHelloImage),
+				Target:    mustParseImageRef(newHelloImage),
+			}},
+		},
+	})
+	d.checkAutoReleases(log.NewNopLogger())
+
+	if _, ok := d.autoReleases.watched()[id]; !ok {
+		t.Error("expected the release to be watched still, rather than rolled back")
+	}
+}
+
 func makeImageInfo(ref string, t time.Time) image.Info {
 	return image.Info{ID: mustParseImageRef(ref), CreatedAt: t}
 }
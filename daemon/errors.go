@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
@@ -42,6 +43,43 @@ and include the problematic file, if possible.
 	}
 }
 
+var errReadOnly = &fluxerr.Error{
+	Type: fluxerr.User,
+	Err:  errors.New("fluxd is running in read-only mode, so cannot make changes to the git repo"),
+	Help: `Cannot make changes in read-only mode
+
+This fluxd was started with --git-readonly, so it only syncs the
+cluster with the git repo, and never writes to the repo. Releasing
+images, and changing policies (e.g., automating or locking a
+workload), both need fluxd to commit to the repo, so aren't possible.
+
+To make the change, edit the manifests in the repo directly. To let
+fluxd make changes, give it a deploy key with write access and
+restart it without --git-readonly.
+`,
+}
+
+func unverifiedCommitError(revision string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("syncing is stopped at commit %s, which does not have a valid signature", revision),
+		Help: `Syncing stopped at a commit without a valid signature
+
+This fluxd verifies the signature of each commit before syncing it,
+and commit
+
+    ` + revision + `
+
+is either not signed, or not signed by a key in fluxd's keyring. Flux
+will not sync that commit, or any after it.
+
+To continue syncing, either remove the commit from the branch and
+replace it with one signed by a trusted key, or add the key it was
+signed with to the keyring given to fluxd.
+`,
+	}
+}
+
 func unknownJobError(id job.ID) error {
 	return &fluxerr.Error{
 		Type: fluxerr.Missing,
@@ -60,9 +60,12 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 					logger.Log("warning", "untagged image in available images", "action", "skip container")
 					continue containers
 				}
+				// Images ordered by a label needn't have a creation
+				// date (e.g., if built reproducibly)
+				_, byLabel := pattern.(policy.LabelOrderPattern)
 				currentCreatedAt := ""
 				for _, info := range filteredImages {
-					if info.CreatedAt.IsZero() {
+					if info.CreatedAt.IsZero() && !byLabel {
 						logger.Log("warning", "image with zero created timestamp", "image", info.ID, "action", "skip container")
 						continue containers
 					}
@@ -82,6 +85,12 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 
 	if len(changes.Changes) > 0 {
+		if d.Repo.IsReadOnly() {
+			// The updates are reported above; there's just no
+			// releasing them.
+			logger.Log("msg", "not running automated release in read-only mode", "updates", len(changes.Changes))
+			return
+		}
 		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
 	}
 }
@@ -99,7 +108,7 @@ func (r resources) IDs() (ids []flux.ResourceID) {
 // automated but do not have policies set to restrain them from
 // getting updated.
 func (d *Daemon) getAllowedAutomatedResources(ctx context.Context) (resources, error) {
-	resources, _, err := d.getResources(ctx)
+	resources, _, _, err := d.getResources(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -14,6 +14,7 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/resource"
 	fluxsync "github.com/weaveworks/flux/sync"
@@ -25,13 +26,36 @@ const (
 	gitOpTimeout = 15 * time.Second
 )
 
+// How often to check on rollouts, when waiting for them to finish
+// before moving the sync tag. A var so it can be shortened in tests.
+var rolloutPollInterval = 5 * time.Second
+
 type LoopVars struct {
 	SyncInterval         time.Duration
 	RegistryPollInterval time.Duration
+	// Delete resources from the cluster that were previously synced
+	// from the repo, but no longer appear in it
+	SyncGarbageCollection bool
+	// Don't apply anything to the cluster; just log what a sync
+	// would do
+	DryRun bool
+	// If non-zero, wait this long for the workloads changed in a
+	// sync to finish rolling out, before moving the sync tag
+	SyncHealthTimeout time.Duration
+	// Revert automated releases whose rollouts fail, and lock the
+	// workloads involved
+	AutomationRollback bool
 
 	initOnce       sync.Once
 	syncSoon       chan struct{}
 	pollImagesSoon chan struct{}
+
+	// What happened to each resource when it was last synced
+	syncRecords syncRecords
+	// Automated releases being watched, so they can be rolled back
+	autoReleases autoReleases
+	// Commits not synced, because they aren't signed
+	unverifiedCommits unverifiedCommits
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -56,6 +80,21 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 	// mirror notification as a change. Otherwise, we'll just sync
 	// every timer tick as well as every mirror refresh.
 	syncHead := ""
+	// .. and likewise for any other git sources, by name.
+	sourceHeads := map[string]string{}
+	var mirrorChanges <-chan map[string]struct{}
+	if d.GitMirrors != nil {
+		mirrorChanges = d.GitMirrors.Changes()
+	}
+
+	// A sync waiting for the rollouts of the workloads it changed,
+	// if there is one; and whether another sync was asked for in the
+	// meantime.
+	var (
+		rollouts      *rolloutWait
+		rolloutsDone  <-chan rolloutResult
+		syncAfterWait bool
+	)
 
 	// Ask for a sync, and to poll images, straight away
 	d.AskForSync()
@@ -69,6 +108,9 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 		select {
 		case <-stop:
 			logger.Log("stopping", "true")
+			if rollouts != nil {
+				rollouts.abandon()
+			}
 			return
 		case <-d.pollImagesSoon:
 			if !imagePollTimer.Stop() {
@@ -88,10 +130,35 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				default:
 				}
 			}
-			if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+			if rollouts != nil {
+				// Don't sync again until the last sync is done;
+				// but do once it is.
+				syncAfterWait = true
+				syncTimer.Reset(d.SyncInterval)
+				continue
+			}
+			w, err := d.startSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange)
+			if err != nil {
 				logger.Log("err", err)
 			}
+			if w != nil {
+				rollouts, rolloutsDone = w, w.done
+			} else if d.AutomationRollback {
+				d.checkAutoReleases(logger)
+			}
 			syncTimer.Reset(d.SyncInterval)
+		case result := <-rolloutsDone:
+			if err := d.finishSync(rollouts, result); err != nil {
+				logger.Log("err", err)
+			}
+			rollouts, rolloutsDone = nil, nil
+			if d.AutomationRollback {
+				d.checkAutoReleases(logger)
+			}
+			if syncAfterWait {
+				syncAfterWait = false
+				d.AskForSync()
+			}
 		case <-syncTimer.C:
 			d.AskForSync()
 		case <-d.Repo.C:
@@ -107,6 +174,24 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				syncHead = newSyncHead
 				d.AskForSync()
 			}
+		case changed := <-mirrorChanges:
+			for _, src := range d.ExtraGitSources {
+				if _, ok := changed[src.Name]; !ok {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
+				newHead, err := src.Repo.Revision(ctx, src.Config.Branch)
+				cancel()
+				if err != nil {
+					logger.Log("url", src.Repo.Origin().URL, "err", err)
+					continue
+				}
+				logger.Log("event", "refreshed", "url", src.Repo.Origin().URL, "branch", src.Config.Branch, "HEAD", newHead)
+				if newHead != sourceHeads[src.Name] {
+					sourceHeads[src.Name] = newHead
+					d.AskForSync()
+				}
+			}
 		case job := <-d.Jobs.Ready():
 			queueLength.Set(float64(d.Jobs.Len()))
 			jobLogger := log.With(logger, "jobID", job.ID)
@@ -123,12 +208,14 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				jobLogger.Log("state", "done", "success", "false", "err", err)
 			} else {
 				jobLogger.Log("state", "done", "success", "true")
-				ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
-				err := d.Repo.Refresh(ctx)
-				if err != nil {
-					logger.Log("err", err)
+				for _, src := range d.gitSources() {
+					ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
+					err := src.Repo.Refresh(ctx)
+					if err != nil {
+						logger.Log("err", err)
+					}
+					cancel()
 				}
-				cancel()
 			}
 		}
 	}
@@ -154,59 +241,149 @@ func (d *LoopVars) AskForImagePoll() {
 
 // -- extra bits the loop needs
 
-func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAboutSyncTagChange *bool) (retErr error) {
+// doSync syncs, and if the sync has to wait for rollouts, waits for
+// them before returning.
+func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAboutSyncTagChange *bool) error {
+	w, err := d.startSync(logger, lastKnownSyncTagRev, warnedAboutSyncTagChange)
+	if err != nil || w == nil {
+		return err
+	}
+	return d.finishSync(w, <-w.done)
+}
+
+// startSync applies what's in the git sources to the cluster. If the
+// workloads changed must finish rolling out before the sync is
+// recorded, it returns a rolloutWait, which sends on its channel
+// `done` when they have (or the timeout has passed); the sync is
+// then recorded with finishSync. Otherwise, the sync is recorded
+// before returning.
+func (d *Daemon) startSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAboutSyncTagChange *bool) (_ *rolloutWait, retErr error) {
 	started := time.Now().UTC()
+	waiting := false
 	defer func() {
-		syncDuration.With(
-			fluxmetrics.LabelSuccess, fmt.Sprint(retErr == nil),
-		).Observe(time.Since(started).Seconds())
+		if !waiting {
+			observeSync(started, retErr)
+		}
 	}()
 	// We don't care how long this takes overall, only about not
 	// getting bogged down in certain operations, so use an
 	// undeadlined context in general.
 	ctx := context.Background()
 
-	// checkout a working clone so we can mess around with tags later
-	var working *git.Checkout
-	{
-		var err error
-		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		defer cancel()
-		working, err = d.Repo.Clone(ctx, d.GitConfig)
+	// checkout a working clone of each git source, so we can mess
+	// around with tags later
+	var sources []*sourceSync
+	defer func() {
+		if waiting {
+			return // the clones are needed until the sync is finished
+		}
+		for _, s := range sources {
+			s.working.Clean()
+		}
+	}()
+	var resources []map[string]resource.Resource
+	for i, src := range d.gitSources() {
+		s := &sourceSync{source: src}
+		{
+			ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+			working, err := src.Repo.Clone(ctx, src.Config)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+			s.working = working
+			sources = append(sources, s)
+		}
+
+		if d.SyncState != nil {
+			s.state = d.SyncState(src)
+		} else {
+			s.state = fluxsync.NewGitTagState(s.working)
+		}
+
+		// For comparison later.
+		oldTagRev, err := s.state.GetRevision(ctx)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		s.oldTagRev = oldTagRev
+		if i == 0 {
+			// Check if something other than the current instance of fluxd changed the sync tag.
+			// This is likely to be caused by another fluxd instance using the same tag.
+			// Having multiple instances fighting for the same tag can lead to fluxd missing manifest changes.
+			if *lastKnownSyncTagRev != "" && oldTagRev != *lastKnownSyncTagRev && !*warnedAboutSyncTagChange {
+				logger.Log("warning",
+					"detected external change in git sync tag; the sync tag should not be shared by fluxd instances")
+				*warnedAboutSyncTagChange = true
+			}
+			s.lastKnownTagRev = lastKnownSyncTagRev
 		}
-		defer working.Clean()
-	}
 
-	// For comparison later.
-	oldTagRev, err := working.SyncRevision(ctx)
-	if err != nil && !isUnknownRevision(err) {
-		return err
-	}
-	// Check if something other than the current instance of fluxd changed the sync tag.
-	// This is likely to be caused by another fluxd instance using the same tag.
-	// Having multiple instances fighting for the same tag can lead to fluxd missing manifest changes.
-	if *lastKnownSyncTagRev != "" && oldTagRev != *lastKnownSyncTagRev && !*warnedAboutSyncTagChange {
-		logger.Log("warning",
-			"detected external change in git sync tag; the sync tag should not be shared by fluxd instances")
-		*warnedAboutSyncTagChange = true
+		s.newTagRev, err = s.working.HeadRevision(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// If asked to, sync only as far as the commits are signed
+		// with a trusted key.
+		if src.Config.VerifySignatures {
+			valid, invalid, err := latestValidRevision(ctx, src, s.working, s.oldTagRev, s.newTagRev)
+			if err != nil {
+				return nil, errors.Wrap(err, "verifying commit signatures")
+			}
+			if d.unverifiedCommits.set(src.Name, invalid) && invalid != nil {
+				// Report it with the sync, the first time it's seen
+				s.unverifiedCommit = invalid
+			}
+			if invalid != nil {
+				logger.Log("warning", "commit does not have a valid signature; not syncing it, or anything after it",
+					"url", src.Repo.Origin().URL, "revision", invalid.Revision)
+				if valid == "" {
+					return nil, fmt.Errorf("nothing to sync from %s; commit %s does not have a valid signature", src.Repo.Origin().URL, invalid.Revision)
+				}
+				if valid != s.newTagRev {
+					ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+					err := s.working.Checkout(ctx, valid)
+					cancel()
+					if err != nil {
+						return nil, err
+					}
+					s.newTagRev = valid
+				}
+			}
+		}
+
+		// Get a map of all resources defined in the repo
+		s.resources, err = d.Manifests.LoadManifests(s.working.Dir(), s.working.ManifestDirs())
+		if err != nil {
+			return nil, errors.Wrap(err, "loading resources from repo")
+		}
+		resources = append(resources, s.resources)
 	}
 
-	newTagRev, err := working.HeadRevision(ctx)
+	var gitSources []GitSource
+	for _, s := range sources {
+		gitSources = append(gitSources, s.source)
+	}
+	allResources, err := mergeResources(gitSources, resources)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "loading resources from repo")
 	}
 
-	// Get a map of all resources defined in the repo
-	allResources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
-	if err != nil {
-		return errors.Wrap(err, "loading resources from repo")
+	if d.DryRun {
+		changes, err := fluxsync.DryRunSets(logger, d.Manifests, syncSets(gitSources, resources), d.Cluster, d.SyncGarbageCollection)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			logger.Log("dry-run", change.Type, "resource", change.ID, "source", change.Source, "fields", len(change.Fields))
+		}
+		return nil, nil
 	}
 
 	var resourceErrors []event.ResourceError
-	// TODO supply deletes argument from somewhere (command-line?)
-	if err := fluxsync.Sync(logger, d.Manifests, allResources, d.Cluster, false); err != nil {
+	syncDef, err := fluxsync.SyncSets(logger, d.Manifests, syncSets(gitSources, resources), d.Cluster, d.SyncGarbageCollection)
+	if err != nil {
 		logger.Log("err", err)
 		switch syncerr := err.(type) {
 		case cluster.SyncError:
@@ -218,22 +395,180 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 				})
 			}
 		default:
-			return err
+			return nil, err
 		}
 	}
 
-	// update notes and emit events for applied commits
+	revisions := map[flux.ResourceID]string{}
+	for _, s := range sources {
+		for _, r := range s.resources {
+			revisions[r.ResourceID()] = s.newTagRev
+		}
+	}
+	d.syncRecords.record(revisions, allResources, syncDef, resourceErrors)
+
+	// Collect the resources that were garbage collected, so they can
+	// be reported along with what changed. Those that failed to be
+	// deleted are already reported as errors.
+	failed := map[flux.ResourceID]bool{}
+	for _, e := range resourceErrors {
+		failed[e.ID] = true
+	}
+	var deletedIDs []flux.ResourceID
+	for _, action := range syncDef.Actions {
+		if action.Delete != nil && !failed[action.Delete.ResourceID()] {
+			deletedIDs = append(deletedIDs, action.Delete.ResourceID())
+		}
+	}
 
-	var initialSync bool
-	var commits []git.Commit
+	// Each source reports the errors for the resources defined in
+	// it; anything else, including what was deleted, is reported
+	// along with the primary source.
+	for _, e := range resourceErrors {
+		owner := sources[0]
+		for _, s := range sources {
+			if _, ok := s.resources[e.ID.String()]; ok {
+				owner = s
+				break
+			}
+		}
+		owner.errors = append(owner.errors, e)
+	}
+	sources[0].deleted = deletedIDs
+
+	var toWatch []flux.ResourceID
+	for _, s := range sources {
+		s.err = d.prepareSource(ctx, s, failed)
+		if s.err == nil {
+			toWatch = append(toWatch, s.toWatch...)
+		}
+	}
+
+	w := &rolloutWait{
+		logger:  logger,
+		started: started,
+		sources: sources,
+		done:    make(chan rolloutResult, 1),
+	}
+	// If asked to, don't treat the sync as done until the workloads
+	// it changed are healthy. This can take a while, so it's done
+	// in the background; meanwhile, the loop carries on with
+	// everything but syncing.
+	if d.SyncHealthTimeout > 0 && len(toWatch) > 0 {
+		waiting = true
+		var ctx context.Context
+		ctx, w.cancel = context.WithTimeout(context.Background(), d.SyncHealthTimeout)
+		go func() {
+			stuck, err := d.waitForRollouts(ctx, toWatch)
+			w.done <- rolloutResult{stuck: stuck, err: err}
+		}()
+		return w, nil
+	}
+	return nil, d.recordSync(w, rolloutResult{})
+}
+
+// rolloutWait is a sync that has been applied, and is waiting for the
+// workloads it changed to finish rolling out before it's recorded.
+type rolloutWait struct {
+	logger  log.Logger
+	started time.Time
+	sources []*sourceSync
+	cancel  context.CancelFunc
+	done    chan rolloutResult
+}
+
+type rolloutResult struct {
+	// the workloads that didn't finish rolling out in time
+	stuck []cluster.Controller
+	err   error
+}
+
+// abandon gives up on a sync waiting for rollouts, e.g., because
+// fluxd is shutting down. The sync tag isn't moved, so the sync will
+// be tried again.
+func (w *rolloutWait) abandon() {
+	w.cancel()
+	for _, s := range w.sources {
+		s.working.Clean()
+	}
+}
+
+// finishSync records a sync once the rollouts it was waiting for are
+// done.
+func (d *Daemon) finishSync(w *rolloutWait, result rolloutResult) (err error) {
+	defer func() {
+		w.cancel()
+		for _, s := range w.sources {
+			s.working.Clean()
+		}
+		observeSync(w.started, err)
+	}()
+	return d.recordSync(w, result)
+}
+
+func observeSync(started time.Time, err error) {
+	syncDuration.With(
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(started).Seconds())
+}
+
+// recordSync reports the sync of each source, and moves its sync tag,
+// unless the workloads it changed didn't finish rolling out.
+func (d *Daemon) recordSync(w *rolloutWait, result rolloutResult) error {
+	var syncErr error
+	for _, s := range w.sources {
+		err := s.err
+		if err == nil {
+			err = d.syncSource(context.Background(), w.logger, s, w.started, result)
+		}
+		switch {
+		case err == nil:
+		case syncErr == nil:
+			syncErr = err
+		default:
+			w.logger.Log("url", s.source.Repo.Origin().URL, "err", err)
+		}
+	}
+	return syncErr
+}
+
+// sourceSync is the state of a sync as it concerns one git source.
+type sourceSync struct {
+	source    GitSource
+	working   *git.Checkout
+	state     fluxsync.State
+	oldTagRev string
+	newTagRev string
+	resources map[string]resource.Resource
+	errors    []event.ResourceError
+	deleted   []flux.ResourceID
+	// the commit at which syncing stopped, because it isn't signed,
+	// if it's to be reported
+	unverifiedCommit *git.Commit
+	// if not nil, updated when the sync tag is moved
+	lastKnownTagRev *string
+
+	// what prepareSource found out
+	err              error
+	initialSync      bool
+	commits          []git.Commit
+	changedResources map[string]resource.Resource
+	serviceIDs       flux.ResourceIDSet
+	toWatch          []flux.ResourceID
+}
+
+// prepareSource finds out which commits, and which resources, from a
+// git source are being synced; and, which workloads to watch the
+// rollout of, if that's asked for.
+func (d *Daemon) prepareSource(ctx context.Context, s *sourceSync, failed map[flux.ResourceID]bool) error {
 	{
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		if oldTagRev != "" {
-			commits, err = d.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, d.GitConfig.Paths...)
+		if s.oldTagRev != "" {
+			s.commits, err = s.source.Repo.CommitsBetween(ctx, s.oldTagRev, s.newTagRev, s.source.Config.Paths...)
 		} else {
-			initialSync = true
-			commits, err = d.Repo.CommitsBefore(ctx, newTagRev, d.GitConfig.Paths...)
+			s.initialSync = true
+			s.commits, err = s.source.Repo.CommitsBefore(ctx, s.newTagRev, s.source.Config.Paths...)
 		}
 		cancel()
 		if err != nil {
@@ -242,18 +577,18 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 	}
 
 	// Figure out which service IDs changed in this release
-	changedResources := map[string]resource.Resource{}
+	s.changedResources = map[string]resource.Resource{}
 
-	if initialSync {
+	if s.initialSync {
 		// no synctag, We are syncing everything from scratch
-		changedResources = allResources
+		s.changedResources = s.resources
 	} else {
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		changedFiles, err := working.ChangedFiles(ctx, oldTagRev)
+		changedFiles, err := s.working.ChangedFiles(ctx, s.oldTagRev)
 		if err == nil && len(changedFiles) > 0 {
 			// We had some changed files, we're syncing a diff
 			// FIXME(michael): this won't be accurate when a file can have more than one resource
-			changedResources, err = d.Manifests.LoadManifests(working.Dir(), changedFiles)
+			s.changedResources, err = d.Manifests.LoadManifests(s.working.Dir(), changedFiles)
 		}
 		cancel()
 		if err != nil {
@@ -261,15 +596,83 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		}
 	}
 
-	serviceIDs := flux.ResourceIDSet{}
-	for _, r := range changedResources {
-		serviceIDs.Add([]flux.ResourceID{r.ResourceID()})
+	s.serviceIDs = flux.ResourceIDSet{}
+	for _, r := range s.changedResources {
+		s.serviceIDs.Add([]flux.ResourceID{r.ResourceID()})
+	}
+	s.serviceIDs.Add(s.deleted)
+
+	if d.SyncHealthTimeout > 0 {
+		for _, r := range s.changedResources {
+			if _, ok := r.(resource.Workload); ok && !failed[r.ResourceID()] {
+				s.toWatch = append(s.toWatch, r.ResourceID())
+			}
+		}
+	}
+	return nil
+}
+
+// syncSource reports the commits synced from a git source, and moves
+// its sync tag, once the resources have been applied and any rollouts
+// waited for.
+func (d *Daemon) syncSource(ctx context.Context, logger log.Logger, s *sourceSync, started time.Time, rollouts rolloutResult) error {
+	// update notes and emit events for applied commits
+	var err error
+
+	initialSync, commits, changedResources, serviceIDs := s.initialSync, s.commits, s.changedResources, s.serviceIDs
+
+	// Workloads that didn't finish rolling out are reported as
+	// errors, and the tag stays put so the revision will be synced
+	// (and waited on) again.
+	if len(s.toWatch) > 0 {
+		if rollouts.err != nil {
+			return errors.Wrap(rollouts.err, "checking rollouts")
+		}
+		watched := flux.ResourceIDSet{}
+		watched.Add(s.toWatch)
+		var stuck []cluster.Controller
+		for _, c := range rollouts.stuck {
+			if watched.Contains(c.ID) {
+				stuck = append(stuck, c)
+			}
+		}
+		if len(stuck) > 0 {
+			var stuckIDs []string
+			for _, c := range stuck {
+				stuckIDs = append(stuckIDs, c.ID.String())
+				msg := fmt.Sprintf("rollout did not complete within %s", d.SyncHealthTimeout)
+				if len(c.Rollout.Messages) > 0 {
+					msg += ": " + strings.Join(c.Rollout.Messages, "; ")
+				}
+				s.errors = append(s.errors, event.ResourceError{
+					ID:    c.ID,
+					Path:  changedResources[c.ID.String()].Source(),
+					Error: msg,
+				})
+			}
+			if err := d.LogEvent(event.Event{
+				ServiceIDs: serviceIDs.ToSlice(),
+				Type:       event.EventSync,
+				StartedAt:  started,
+				EndedAt:    time.Now().UTC(),
+				LogLevel:   event.LogLevelError,
+				Metadata: &event.SyncEventMetadata{
+					Commits:     eventCommits(commits),
+					InitialSync: initialSync,
+					Errors:      s.errors,
+					Deleted:     s.deleted,
+				},
+			}); err != nil {
+				logger.Log("err", err)
+			}
+			return fmt.Errorf("not moving sync tag to %s; workloads did not become ready: %s", s.newTagRev, strings.Join(stuckIDs, ", "))
+		}
 	}
 
 	var notes map[string]struct{}
 	{
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		notes, err = working.NoteRevList(ctx)
+		notes, err = s.working.NoteRevList(ctx)
 		cancel()
 		if err != nil {
 			return errors.Wrap(err, "loading notes from repo")
@@ -282,7 +685,10 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 	// autoreleases, that we're already posting as events, so upstream
 	// can skip the sync event if it wants to.
 	includes := make(map[string]bool)
-	if len(commits) > 0 {
+	// The notes found are also recorded with the sync state, for
+	// those kept outside the repo.
+	var syncedNotes map[string]job.Note
+	if len(commits) > 0 || s.unverifiedCommit != nil {
 		var noteEvents []event.Event
 
 		// Find notes in revisions.
@@ -292,8 +698,8 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 				continue
 			}
 			ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-			var n note
-			ok, err := working.GetNote(ctx, commits[i].Revision, &n)
+			var n job.Note
+			ok, err := s.working.GetNote(ctx, commits[i].Revision, &n)
 			cancel()
 			if err != nil {
 				return errors.Wrap(err, "loading notes from repo")
@@ -317,6 +723,11 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 				break
 			}
 
+			if syncedNotes == nil {
+				syncedNotes = map[string]job.Note{}
+			}
+			syncedNotes[commits[i].Revision] = n
+
 			// Interpret some notes as events to send to the upstream
 			switch n.Spec.Type {
 			case update.Containers:
@@ -363,6 +774,25 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 					},
 				})
 				includes[event.EventRelease] = true
+			case update.Promote:
+				spec := n.Spec.Spec.(update.PromoteSpec)
+				noteEvents = append(noteEvents, event.Event{
+					ServiceIDs: n.Result.AffectedResources(),
+					Type:       event.EventPromote,
+					StartedAt:  started,
+					EndedAt:    time.Now().UTC(),
+					LogLevel:   event.LogLevelInfo,
+					Metadata: &event.PromoteEventMetadata{
+						ReleaseEventCommon: event.ReleaseEventCommon{
+							Revision: commits[i].Revision,
+							Result:   n.Result,
+							Error:    n.Result.Error(),
+						},
+						Spec:  spec,
+						Cause: n.Spec.Cause,
+					},
+				})
+				includes[event.EventPromote] = true
 			case update.Auto:
 				spec := n.Spec.Spec.(update.Automated)
 				noteEvents = append(noteEvents, event.Event{
@@ -381,6 +811,16 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 					},
 				})
 				includes[event.EventAutoRelease] = true
+				if d.AutomationRollback {
+					// A release proposed as a pull request is made on
+					// a branch of its own, and reaches the cluster in
+					// the revision that merges it
+					revision := commits[i].Revision
+					if d.PullRequests != nil {
+						revision = s.newTagRev
+					}
+					d.autoReleases.watch(revision, n.Result)
+				}
 			case update.Policy:
 				// Use this to mean any change to policy
 				includes[event.EventUpdatePolicy] = true
@@ -391,23 +831,28 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 			}
 		}
 
-		cs := make([]event.Commit, len(commits))
-		for i, c := range commits {
-			cs[i].Revision = c.Revision
-			cs[i].Message = c.Message
+		metadata := &event.SyncEventMetadata{
+			Commits:     eventCommits(commits),
+			InitialSync: initialSync,
+			Includes:    includes,
+			Errors:      s.errors,
+			Deleted:     s.deleted,
+		}
+		logLevel := event.LogLevelInfo
+		if s.unverifiedCommit != nil {
+			metadata.UnverifiedCommit = &event.Commit{
+				Revision: s.unverifiedCommit.Revision,
+				Message:  s.unverifiedCommit.Message,
+			}
+			logLevel = event.LogLevelWarn
 		}
 		if err = d.LogEvent(event.Event{
 			ServiceIDs: serviceIDs.ToSlice(),
 			Type:       event.EventSync,
 			StartedAt:  started,
 			EndedAt:    started,
-			LogLevel:   event.LogLevelInfo,
-			Metadata: &event.SyncEventMetadata{
-				Commits:     cs,
-				InitialSync: initialSync,
-				Includes:    includes,
-				Errors:      resourceErrors,
-			},
+			LogLevel:   logLevel,
+			Metadata:   metadata,
 		}); err != nil {
 			logger.Log("err", err)
 			// Abort early to ensure at least once delivery of events
@@ -423,21 +868,24 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		}
 	}
 
-	// Move the tag and push it so we know how far we've gotten.
-	if oldTagRev != newTagRev {
+	// Record how far we've gotten; usually by moving the tag and
+	// pushing it.
+	if s.oldTagRev != s.newTagRev {
 		{
 			ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-			err := working.MoveSyncTagAndPush(ctx, newTagRev, "Sync pointer")
+			err := s.state.UpdateMarker(ctx, s.newTagRev, syncedNotes)
 			cancel()
 			if err != nil {
 				return err
 			}
-			*lastKnownSyncTagRev = newTagRev
+			if s.lastKnownTagRev != nil {
+				*s.lastKnownTagRev = s.newTagRev
+			}
 		}
-		logger.Log("tag", d.GitConfig.SyncTag, "old", oldTagRev, "new", newTagRev)
+		logger.Log("tag", s.source.Config.SyncTag, "old", s.oldTagRev, "new", s.newTagRev)
 		{
 			ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-			err := d.Repo.Refresh(ctx)
+			err := s.source.Repo.Refresh(ctx)
 			cancel()
 			return err
 		}
@@ -445,8 +893,111 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 	return nil
 }
 
-func isUnknownRevision(err error) bool {
-	return err != nil &&
-		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
-			strings.Contains(err.Error(), "bad revision"))
+func eventCommits(commits []git.Commit) []event.Commit {
+	cs := make([]event.Commit, len(commits))
+	for i, c := range commits {
+		cs[i].Revision = c.Revision
+		cs[i].Message = c.Message
+	}
+	return cs
+}
+
+// waitForRollouts polls the workloads given until they have all
+// finished rolling out, or until the context's deadline has passed;
+// in the latter case, it returns those that didn't finish. If the
+// context is cancelled, it gives up and returns the error.
+func (d *Daemon) waitForRollouts(ctx context.Context, ids []flux.ResourceID) ([]cluster.Controller, error) {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for {
+		controllers, err := d.Cluster.SomeControllers(ids)
+		if err != nil {
+			return nil, err
+		}
+		var unfinished []cluster.Controller
+		for _, c := range controllers {
+			if !rolloutFinished(c) {
+				unfinished = append(unfinished, c)
+			}
+		}
+		if len(unfinished) == 0 {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return unfinished, nil
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolloutFinished says whether a workload has converged on its
+// definition. Only the statuses that describe a rollout in progress
+// (or stuck) count as unfinished; others, e.g., those of Helm
+// releases, have nothing to wait for.
+func rolloutFinished(c cluster.Controller) bool {
+	switch c.Status {
+	case cluster.StatusStarted, cluster.StatusUpdating, cluster.StatusError:
+		return false
+	}
+	return true
+}
+
+// syncRecord is what's known about a resource from the last time it
+// was synced.
+type syncRecord struct {
+	lastAppliedRevision string
+	syncError           string
+	// Whether the resource was left out of the last sync, e.g.,
+	// because it is ignored in the cluster
+	skipped bool
+}
+
+type syncRecords struct {
+	mu      sync.RWMutex
+	records map[flux.ResourceID]syncRecord
+}
+
+// record updates the records with the outcome of a sync of the
+// resources given, each at the revision given for it.
+func (r *syncRecords) record(revisions map[flux.ResourceID]string, resources map[string]resource.Resource, syncDef cluster.SyncDef, errs []event.ResourceError) {
+	failed := map[flux.ResourceID]string{}
+	for _, e := range errs {
+		failed[e.ID] = e.Error
+	}
+	applied := map[flux.ResourceID]bool{}
+	for _, action := range syncDef.Actions {
+		if action.Apply != nil {
+			applied[action.Apply.ResourceID()] = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := map[flux.ResourceID]syncRecord{}
+	for _, res := range resources {
+		id := res.ResourceID()
+		rec := r.records[id]
+		switch {
+		case !applied[id]:
+			rec.skipped = true
+		case failed[id] != "":
+			rec.skipped = false
+			rec.syncError = failed[id]
+		default:
+			rec = syncRecord{lastAppliedRevision: revisions[id]}
+		}
+		records[id] = rec
+	}
+	// Anything no longer in the repo is forgotten
+	r.records = records
+}
+
+func (r *syncRecords) get(id flux.ResourceID) syncRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.records[id]
 }
@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -15,14 +16,18 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/update"
 )
 
 const (
@@ -146,6 +151,184 @@ func TestPullAndSync_InitialSync(t *testing.T) {
 	}
 }
 
+func TestDoSync_RecordsResourceStatus(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	failing := flux.MustParseResourceID("default:deployment/helloworld")
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		for _, action := range def.Actions {
+			if action.Apply != nil && action.Apply.ResourceID() == failing {
+				return cluster.SyncError{cluster.ResourceError{Resource: action.Apply, Error: errors.New("rejected")}}
+			}
+		}
+		return nil
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := d.ListResources(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != len(testfiles.ResourceMap) {
+		t.Errorf("expected %d resources, got %#v", len(testfiles.ResourceMap), resources)
+	}
+	for _, r := range resources {
+		if r.Source != testfiles.ResourceMap[r.ID] {
+			t.Errorf("expected %s to have source %q, got %q", r.ID, testfiles.ResourceMap[r.ID], r.Source)
+		}
+		if r.ID == failing {
+			if r.SyncError != "rejected" || r.LastAppliedRevision != "" {
+				t.Errorf("expected %s to have failed, got %#v", r.ID, r)
+			}
+			continue
+		}
+		if r.SyncError != "" || r.LastAppliedRevision != head {
+			t.Errorf("expected %s to have been applied at %s, got %#v", r.ID, head, r)
+		}
+	}
+}
+
+func TestDoSync_HealthGated(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = time.Millisecond
+	d.SyncHealthTimeout = 20 * time.Millisecond
+
+	stuck := flux.MustParseResourceID("default:deployment/helloworld")
+	stuckMessage := "Deployment has timed out progressing"
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		var controllers []cluster.Controller
+		for _, id := range ids {
+			c := cluster.Controller{ID: id, Status: cluster.StatusReady}
+			if id == stuck {
+				c.Status = cluster.StatusError
+				c.Rollout.Messages = []string{stuckMessage}
+			}
+			controllers = append(controllers, c)
+		}
+		return controllers, nil
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err == nil {
+		t.Fatal("expected an error when a workload does not become ready")
+	}
+
+	// It emits an error event naming the stuck workload
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].Type != event.EventSync || es[0].LogLevel != event.LogLevelError {
+		t.Fatalf("expected a single error-level sync event, got %#v", es)
+	}
+	errs := es[0].Metadata.(*event.SyncEventMetadata).Errors
+	if len(errs) != 1 || errs[0].ID != stuck || !strings.Contains(errs[0].Error, stuckMessage) {
+		t.Errorf("expected an error for %s including %q, got %#v", stuck, stuckMessage, errs)
+	}
+
+	// It doesn't create the tag
+	if err := d.Repo.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Repo.CommitsBefore(context.Background(), gitSyncTag); err == nil {
+		t.Error("expected the sync tag not to have been created")
+	}
+
+	// Once everything is ready, the tag moves
+	stuck = flux.ResourceID{}
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := d.Repo.CommitsBefore(context.Background(), gitSyncTag); err != nil {
+		t.Errorf("finding revisions before sync tag: %v", err)
+	} else if len(revs) <= 0 {
+		t.Errorf("Found no revisions before the sync tag")
+	}
+}
+
+func TestStartSync_WaitsInBackground(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = time.Millisecond
+	d.SyncHealthTimeout = time.Minute
+
+	var mu sync.Mutex
+	ready := false
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var controllers []cluster.Controller
+		for _, id := range ids {
+			c := cluster.Controller{ID: id, Status: cluster.StatusUpdating}
+			if ready {
+				c.Status = cluster.StatusReady
+			}
+			controllers = append(controllers, c)
+		}
+		return controllers, nil
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	// It returns while the rollouts are still going, rather than
+	// waiting for them
+	w, err := d.startSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w == nil {
+		t.Fatal("expected the sync to wait for rollouts")
+	}
+	select {
+	case <-w.done:
+		t.Fatal("expected the rollouts to be unfinished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	mu.Lock()
+	ready = true
+	mu.Unlock()
+	if err := d.finishSync(w, <-w.done); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := d.Repo.CommitsBefore(context.Background(), gitSyncTag); err != nil {
+		t.Errorf("finding revisions before sync tag: %v", err)
+	} else if len(revs) <= 0 {
+		t.Errorf("Found no revisions before the sync tag")
+	}
+}
+
 func TestDoSync_NoNewCommits(t *testing.T) {
 	d, cleanup := daemon(t)
 	defer cleanup()
@@ -321,3 +504,286 @@ func TestDoSync_WithNewCommit(t *testing.T) {
 		t.Errorf("Should have moved sync tag to HEAD (%s), but was moved to: %s", newRevision, revs[len(revs)-1].Revision)
 	}
 }
+
+func TestDoSync_MultipleSources(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// The primary source has only test-service, and the extra
+	// source only helloworld
+	d.GitConfig.Paths = []string{"test"}
+	extraRepo, extraCleanup := gittest.Repo(t)
+	defer extraCleanup()
+	if err := extraRepo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	extraConfig := d.GitConfig
+	extraConfig.Paths = []string{"helloworld-deploy.yaml"}
+	d.ExtraGitSources = []GitSource{{Name: "extra", Repo: extraRepo, Config: extraConfig}}
+
+	var applied flux.ResourceIDs
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		for _, action := range def.Actions {
+			if action.Apply != nil {
+				applied = append(applied, action.Apply.ResourceID())
+			}
+		}
+		return nil
+	}
+	k8s.UpdatePoliciesFunc = (&kubernetes.Manifests{}).UpdatePolicies
+
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	expected := flux.ResourceIDs{helloworld, flux.MustParseResourceID("default:deployment/test-service")}
+	applied.Sort()
+	if !reflect.DeepEqual(applied, expected) {
+		t.Errorf("expected %v to be applied, got %v", expected, applied)
+	}
+
+	// Each source gets its own sync tag
+	for _, src := range d.gitSources() {
+		if err := src.Repo.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if revs, err := src.Repo.CommitsBefore(ctx, gitSyncTag); err != nil || len(revs) == 0 {
+			t.Errorf("expected sync tag in %s, got error %v", src.Repo.Origin().URL, err)
+		}
+	}
+
+	// An update to helloworld is committed to the extra source, and
+	// the primary source is left alone
+	primaryHead, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extraHead, err := extraRepo.Revision(ctx, extraConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID, err := d.UpdateManifests(ctx, update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{helloworld: {Add: policy.Set{policy.Locked: "true"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case j := <-d.Jobs.Ready():
+		if err := j.Do(logger); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for job")
+	}
+	if status, _ := d.JobStatusCache.Status(jobID); status.StatusString != job.StatusSucceeded {
+		t.Fatalf("expected job to succeed, got %+v", status)
+	}
+
+	for _, src := range d.gitSources() {
+		if err := src.Repo.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if head, _ := d.Repo.Revision(ctx, d.GitConfig.Branch); head != primaryHead {
+		t.Errorf("expected primary source to be unchanged, but HEAD moved from %s to %s", primaryHead, head)
+	}
+	if head, _ := extraRepo.Revision(ctx, extraConfig.Branch); head == extraHead {
+		t.Error("expected a commit to the extra source")
+	}
+	resources, err := d.loadAllResources(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resources[helloworld.String()].Policy().Has(policy.Locked) {
+		t.Error("expected helloworld to be locked")
+	}
+}
+
+func TestDoSync_DuplicateAcrossSources(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	extraRepo, extraCleanup := gittest.Repo(t)
+	defer extraCleanup()
+	if err := extraRepo.Ready(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.ExtraGitSources = []GitSource{{Name: "extra", Repo: extraRepo, Config: d.GitConfig}}
+
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange)
+	if err == nil || !strings.Contains(err.Error(), "duplicate definition") {
+		t.Errorf("expected duplicate definition error, got %v", err)
+	}
+}
+
+type memSyncState struct {
+	revision string
+	notes    map[string]job.Note
+}
+
+func (s *memSyncState) GetRevision(ctx context.Context) (string, error) {
+	return s.revision, nil
+}
+
+func (s *memSyncState) UpdateMarker(ctx context.Context, revision string, notes map[string]job.Note) error {
+	s.revision = revision
+	s.notes = notes
+	return nil
+}
+
+func (s *memSyncState) GetNotes(ctx context.Context) (map[string]job.Note, error) {
+	return s.notes, nil
+}
+
+func TestDoSync_SyncState(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	state := &memSyncState{}
+	d.SyncState = func(GitSource) fluxsync.State { return state }
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.revision != head {
+		t.Errorf("expected sync state to be at HEAD (%s), got %q", head, state.revision)
+	}
+
+	// The sync tag is left alone
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Repo.Revision(ctx, gitSyncTag); err == nil {
+		t.Error("expected no sync tag in the repo")
+	}
+
+	// .. and the sync state is used to report on what's been synced
+	revs, err := d.SyncStatus(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 0 {
+		t.Errorf("expected no commits to be outstanding, got %v", revs)
+	}
+
+	// .. and the notes kept with it to report on jobs
+	state.notes = map[string]job.Note{head: {JobID: "job-1", Spec: update.Spec{Type: update.Images}}}
+	status, err := d.JobStatus(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.StatusString != job.StatusSucceeded || status.Result.Revision != head {
+		t.Errorf("expected job to have succeeded at %s, got %+v", head, status)
+	}
+}
+
+func TestDoSync_UnverifiedCommit(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// An empty keyring, so no signature is valid
+	gpgHome, err := ioutil.TempDir("", "flux-gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gpgHome)
+	if prev, ok := os.LookupEnv("GNUPGHOME"); ok {
+		defer os.Setenv("GNUPGHOME", prev)
+	} else {
+		defer os.Unsetenv("GNUPGHOME")
+	}
+	os.Setenv("GNUPGHOME", gpgHome)
+
+	oldRevision, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &memSyncState{revision: oldRevision}
+	d.SyncState = func(GitSource) fluxsync.State { return state }
+	d.GitConfig.VerifySignatures = true
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	// Push an unsigned commit
+	var newRevision string
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		dirs := checkout.ManifestDirs()
+		err := cluster.UpdateManifest(k8s, checkout.Dir(), dirs, flux.MustParseResourceID("default:deployment/helloworld"), func(def []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(def), "replicas: 5", "replicas: 4", -1)), nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "unsigned commit"}, nil); err != nil {
+			return err
+		}
+		newRevision, err = checkout.HeadRevision(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	// It doesn't sync past the unsigned commit
+	if state.revision != oldRevision {
+		t.Errorf("expected sync state to stay at %s, got %s", oldRevision, state.revision)
+	}
+
+	// .. and reports it in the sync event
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].Type != event.EventSync {
+		t.Fatalf("expected a single sync event, got %#v", es)
+	}
+	metadata := es[0].Metadata.(*event.SyncEventMetadata)
+	if metadata.UnverifiedCommit == nil || metadata.UnverifiedCommit.Revision != newRevision {
+		t.Errorf("expected unverified commit %s to be reported, got %#v", newRevision, metadata.UnverifiedCommit)
+	}
+
+	// .. and in the sync status
+	if _, err := d.SyncStatus(ctx, "HEAD"); err == nil || !strings.Contains(err.Error(), newRevision) {
+		t.Errorf("expected sync status to report unverified commit %s, got %v", newRevision, err)
+	}
+}
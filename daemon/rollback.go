@@ -0,0 +1,208 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/update"
+)
+
+// autoRelease is an automated release of a workload that has been
+// synced, and whose rollout is being watched.
+type autoRelease struct {
+	revision string
+	updates  []update.ContainerUpdate
+}
+
+type autoReleases struct {
+	mu       sync.Mutex
+	releases map[flux.ResourceID]autoRelease
+}
+
+// watch starts watching the rollouts of the workloads successfully
+// updated by an automated release. A later release of a workload
+// supersedes an earlier one.
+func (a *autoReleases) watch(revision string, result update.Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.releases == nil {
+		a.releases = map[flux.ResourceID]autoRelease{}
+	}
+	for id, res := range result {
+		if res.Status == update.ReleaseStatusSuccess && len(res.PerContainer) > 0 {
+			a.releases[id] = autoRelease{revision: revision, updates: res.PerContainer}
+		}
+	}
+}
+
+func (a *autoReleases) forget(id flux.ResourceID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.releases, id)
+}
+
+func (a *autoReleases) watched() map[flux.ResourceID]autoRelease {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	watched := map[flux.ResourceID]autoRelease{}
+	for id, r := range a.releases {
+		watched[id] = r
+	}
+	return watched
+}
+
+// checkAutoReleases looks at the rollouts of automatically released
+// workloads. Those that have finished are no longer watched; those
+// that are stuck get their release reverted, and are locked so
+// automation won't just try again.
+func (d *Daemon) checkAutoReleases(logger log.Logger) {
+	for id, r := range d.autoReleases.watched() {
+		controllers, err := d.Cluster.SomeControllers([]flux.ResourceID{id})
+		if err != nil || len(controllers) == 0 {
+			// Most likely the workload has gone away; in any case
+			// there's no rollout we can make sense of.
+			logger.Log("workload", id, "msg", "not watching rollout of automated release", "err", err)
+			d.autoReleases.forget(id)
+			continue
+		}
+		c := controllers[0]
+		switch {
+		case !runningReleasedImages(c, r.updates):
+			// Something else has since changed the images, so the
+			// release is not ours to roll back
+			d.autoReleases.forget(id)
+		case c.Status == cluster.StatusError:
+			// The status is only an error once the new definition
+			// has been observed, so this is about the release, and
+			// not left over from an earlier rollout
+			logger.Log("workload", id, "revision", r.revision, "msg", "rolling back automated release", "reason", strings.Join(c.Rollout.Messages, "; "))
+			rollback := d.rollback(id, r, c.Rollout.Messages)
+			d.queueJob(d.makeLoggingJobFunc(d.makeJobFromSourceUpdate(func(owned func(flux.ResourceID) bool) (updateFunc, bool) {
+				return rollback, owned(id)
+			})))
+			d.autoReleases.forget(id)
+		case c.Status == cluster.StatusReady:
+			d.autoReleases.forget(id)
+		}
+	}
+}
+
+func runningReleasedImages(c cluster.Controller, updates []update.ContainerUpdate) bool {
+	images := map[string]string{}
+	for _, container := range c.ContainersOrNil() {
+		images[container.Name] = container.Image.String()
+	}
+	for _, u := range updates {
+		if images[u.Container] != u.Target.String() {
+			return false
+		}
+	}
+	return true
+}
+
+// rollback reverts the image changes of an automated release of a
+// workload, and locks the workload, in a single commit.
+func (d *Daemon) rollback(id flux.ResourceID, r autoRelease, reasons []string) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		started := time.Now().UTC()
+
+		var reverts []update.ContainerUpdate
+		for _, u := range r.updates {
+			reverts = append(reverts, update.ContainerUpdate{
+				Container: u.Container,
+				Current:   u.Target,
+				Target:    u.Current,
+			})
+		}
+		changes := update.ReleaseContainersSpec{
+			Kind:           update.ReleaseKindExecute,
+			ContainerSpecs: map[flux.ResourceID][]update.ContainerUpdate{id: reverts},
+		}
+		spec := update.Spec{
+			Type:  update.Containers,
+			Cause: update.Cause{Message: rollbackCommitMessage(id, r, reasons)},
+			Spec:  changes,
+		}
+
+		var zero job.Result
+		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		result, err := release.Release(rc, changes, logger)
+		if err != nil {
+			return zero, err
+		}
+
+		lock := policy.Update{
+			Add: policy.Set{
+				policy.Locked:    "true",
+				policy.LockedMsg: fmt.Sprintf("Automated release in %s rolled back, because the rollout failed", event.ShortRevision(r.revision)),
+			},
+		}
+		if _, err := cluster.UpdatePolicies(d.Manifests, working.Dir(), working.ManifestDirs(), id, lock); err != nil {
+			return zero, errors.Wrap(err, "locking rolled back workload")
+		}
+
+		commitMsg, err := d.CommitTemplates.Message(spec, result, spec.Cause.Message)
+		if err != nil {
+			return zero, err
+		}
+		commitAction := git.CommitAction{Message: commitMsg}
+		jobResult := job.Result{
+			Spec:   &spec,
+			Result: result,
+		}
+		if err := d.commitAndPush(ctx, working, commitAction, &job.Note{JobID: jobID, Spec: spec, Result: result}, &jobResult); err != nil {
+			d.Repo.Notify()
+			return zero, err
+		}
+
+		if err := d.LogEvent(event.Event{
+			ServiceIDs: []flux.ResourceID{id},
+			Type:       event.EventRollback,
+			StartedAt:  started,
+			EndedAt:    time.Now().UTC(),
+			LogLevel:   event.LogLevelWarn,
+			Metadata: &event.RollbackEventMetadata{
+				ReleaseEventCommon: event.ReleaseEventCommon{
+					Revision: jobResult.Revision,
+					Result:   result,
+					Error:    result.Error(),
+				},
+				RolledBack: r.revision,
+				Reasons:    reasons,
+			},
+		}); err != nil {
+			logger.Log("err", err)
+		}
+
+		return jobResult, nil
+	}
+}
+
+func rollbackCommitMessage(id flux.ResourceID, r autoRelease, reasons []string) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Roll back automated release of %s\n\n", id)
+	fmt.Fprintf(buf, "The rollout of the images released in %s failed:\n\n", event.ShortRevision(r.revision))
+	for _, reason := range reasons {
+		fmt.Fprintf(buf, "  %s\n", reason)
+	}
+	fmt.Fprint(buf, "\nReverting to:\n\n")
+	for _, u := range r.updates {
+		fmt.Fprintf(buf, " - %s\n", u.Current)
+	}
+	fmt.Fprintf(buf, "\n%s has been locked, so it won't be updated automatically until unlocked.\n", id)
+	return buf.String()
+}
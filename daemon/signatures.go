@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// unverifiedCommits keeps track of the first commit in each git
+// source (by name) that is not synced, because it does not have a
+// valid signature.
+type unverifiedCommits struct {
+	mu      sync.Mutex
+	commits map[string]git.Commit
+}
+
+// set records the unverified commit for a source, or that there's
+// none if given nil; and reports whether that's different to what
+// was recorded before.
+func (u *unverifiedCommits) set(source string, commit *git.Commit) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	prev, had := u.commits[source]
+	if commit == nil {
+		delete(u.commits, source)
+		return had
+	}
+	if u.commits == nil {
+		u.commits = map[string]git.Commit{}
+	}
+	u.commits[source] = *commit
+	return !had || prev.Revision != commit.Revision
+}
+
+func (u *unverifiedCommits) get(source string) (git.Commit, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c, ok := u.commits[source]
+	return c, ok
+}
+
+// latestValidRevision finds how far a source can be synced, when
+// signatures are checked: up to, but not including, the first commit
+// after the last synced revision that does not have a valid
+// signature. Commits are checked parents first, so a commit is only
+// accepted once all the commits it brings in have been; and only a
+// commit that descends from the last synced revision is synced to,
+// so that a commit on a merged branch doesn't roll the cluster
+// back. It returns the revision to sync, and the offending commit if
+// there is one. If nothing can be synced, the revision is empty.
+func latestValidRevision(ctx context.Context, src GitSource, working *git.Checkout, oldRev, newRev string) (string, *git.Commit, error) {
+	var commits []git.HistoryCommit
+	{
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		var err error
+		if oldRev != "" {
+			commits, err = src.Repo.History(ctx, oldRev, newRev)
+		} else {
+			// With nothing synced before, there's no telling where
+			// the signed history starts; so just check the head.
+			var head []git.Commit
+			head, err = src.Repo.CommitsBefore(ctx, newRev)
+			if len(head) > 0 {
+				commits = []git.HistoryCommit{{Commit: head[0], OnAncestryPath: true}}
+			}
+		}
+		cancel()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	valid := oldRev
+	for i := range commits {
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		err := working.VerifyCommit(ctx, commits[i].Revision)
+		cancel()
+		if err != nil {
+			return valid, &commits[i].Commit, nil
+		}
+		if commits[i].OnAncestryPath {
+			valid = commits[i].Revision
+		}
+	}
+	return newRev, nil, nil
+}
@@ -0,0 +1,284 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/update"
+)
+
+// GitSource is a git repo from which manifests are synced, and to
+// which changes to them are committed. The daemon's Repo and
+// GitConfig make up its primary source; others can be given in
+// ExtraGitSources.
+type GitSource struct {
+	// Name is the name under which the repo is mirrored in the
+	// daemon's GitMirrors (for sources other than the primary)
+	Name   string
+	Repo   *git.Repo
+	Config git.Config
+}
+
+func (s GitSource) withClone(ctx context.Context, fn func(*git.Checkout) error) error {
+	co, err := s.Repo.Clone(ctx, s.Config)
+	if err != nil {
+		return err
+	}
+	defer co.Clean()
+	return fn(co)
+}
+
+// syncSetName returns the name under which resources are synced from
+// the source. It covers everything that determines which resources
+// are synced -- the repo, the branch, and the paths within the repo --
+// so that garbage collection never deletes resources that came from
+// elsewhere. Each source is named separately, so adding or removing
+// another source doesn't change the mark on its resources.
+func (s GitSource) syncSetName() string {
+	hasher := sha256.New()
+	hasher.Write([]byte(s.Repo.Origin().URL))
+	hasher.Write([]byte(s.Config.Branch))
+	for _, path := range s.Config.Paths {
+		hasher.Write([]byte(path))
+	}
+	return "git-" + base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// syncSets gives a sync set for each of the sources, with the
+// resources loaded from it.
+func syncSets(sources []GitSource, resources []map[string]resource.Resource) []fluxsync.SyncSet {
+	var sets []fluxsync.SyncSet
+	for i, src := range sources {
+		sets = append(sets, fluxsync.SyncSet{Name: src.syncSetName(), Resources: resources[i]})
+	}
+	return sets
+}
+
+// gitSources returns all the git sources, the primary source first.
+func (d *Daemon) gitSources() []GitSource {
+	return append([]GitSource{{Repo: d.Repo, Config: d.GitConfig}}, d.ExtraGitSources...)
+}
+
+// mergeResources combines the resources defined in each of the
+// sources given, failing if any resource is defined in more than one.
+func mergeResources(sources []GitSource, resources []map[string]resource.Resource) (map[string]resource.Resource, error) {
+	if len(resources) == 1 {
+		return resources[0], nil
+	}
+	all := map[string]resource.Resource{}
+	definedIn := map[string]int{}
+	for i, rs := range resources {
+		for id, res := range rs {
+			if j, ok := definedIn[id]; ok {
+				return nil, fmt.Errorf(`duplicate definition of '%s' (in %s of %s, and %s of %s)`,
+					id, all[id].Source(), sources[j].Repo.Origin().URL, res.Source(), sources[i].Repo.Origin().URL)
+			}
+			all[id] = res
+			definedIn[id] = i
+		}
+	}
+	return all, nil
+}
+
+// loadAllResources loads the resources defined in each of the git
+// sources.
+func (d *Daemon) loadAllResources(ctx context.Context) (map[string]resource.Resource, error) {
+	resources, _, err := d.loadAllResourcesAndSubmodules(ctx)
+	return resources, err
+}
+
+// loadAllResourcesAndSubmodules loads the resources defined in each
+// of the git sources, and also says which of them are defined in git
+// submodules (so cannot be changed).
+func (d *Daemon) loadAllResourcesAndSubmodules(ctx context.Context) (map[string]resource.Resource, map[string]bool, error) {
+	sources, resources, inSubmodule, err := d.loadSourceResources(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := mergeResources(sources, resources)
+	return all, inSubmodule, err
+}
+
+// loadSourceResources loads the resources defined in each of the git
+// sources, returning them along with the sources, and which of them
+// are defined in git submodules.
+func (d *Daemon) loadSourceResources(ctx context.Context) ([]GitSource, []map[string]resource.Resource, map[string]bool, error) {
+	sources := d.gitSources()
+	var resources []map[string]resource.Resource
+	inSubmodule := map[string]bool{}
+	for _, src := range sources {
+		err := src.withClone(ctx, func(checkout *git.Checkout) error {
+			rs, err := d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+			for id, res := range rs {
+				if checkout.InSubmodule(res.Source()) {
+					inSubmodule[id] = true
+				}
+			}
+			resources = append(resources, rs)
+			return err
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return sources, resources, inSubmodule, nil
+}
+
+// sourceUpdate gives the part of an update that concerns the
+// resources for which `owned` is true, or false if there's no such
+// part.
+type sourceUpdate func(owned func(flux.ResourceID) bool) (updateFunc, bool)
+
+// makeJobFromSourceUpdate is makeJobFromUpdate for an update which
+// may concern resources in any of the git sources. Each source is
+// given the part of the update concerning the resources defined in
+// it, so changes are committed to the repo that owns the manifests.
+// Resources not defined in any source are left to the primary
+// source, which will report them as it would were it the only one.
+func (d *Daemon) makeJobFromSourceUpdate(update sourceUpdate) jobFunc {
+	if len(d.ExtraGitSources) == 0 {
+		f, _ := update(func(flux.ResourceID) bool { return true })
+		return d.makeJobFromUpdate(f)
+	}
+
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		sources := d.gitSources()
+		err := withClones(ctx, sources, func(checkouts []*git.Checkout) error {
+			definedIn := map[string]int{}
+			for i, co := range checkouts {
+				resources, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDirs())
+				if err != nil {
+					return errors.Wrapf(err, "loading resources from %s", sources[i].Repo.Origin().URL)
+				}
+				for id := range resources {
+					definedIn[id] = i
+				}
+			}
+
+			// It's only an error for there to be no changes if
+			// there are no changes anywhere
+			var ran, unchanged int
+			for i, co := range checkouts {
+				i := i
+				f, ok := update(func(id flux.ResourceID) bool {
+					j, defined := definedIn[id.String()]
+					return j == i || (!defined && i == 0)
+				})
+				if !ok {
+					continue
+				}
+				ran++
+				res, err := f(ctx, jobID, co, logger)
+				switch {
+				case err == git.ErrNoChanges:
+					unchanged++
+				case err != nil:
+					return errors.Wrapf(err, "updating %s", sources[i].Repo.Origin().URL)
+				default:
+					result = mergeJobResults(result, res)
+				}
+			}
+			if ran > 0 && ran == unchanged {
+				return git.ErrNoChanges
+			}
+			return nil
+		})
+		return result, err
+	}
+}
+
+func withClones(ctx context.Context, sources []GitSource, fn func([]*git.Checkout) error) error {
+	var checkouts []*git.Checkout
+	defer func() {
+		for _, co := range checkouts {
+			co.Clean()
+		}
+	}()
+	for _, src := range sources {
+		co, err := src.Repo.Clone(ctx, src.Config)
+		if err != nil {
+			return err
+		}
+		checkouts = append(checkouts, co)
+	}
+	return fn(checkouts)
+}
+
+// mergeJobResults combines the results of running an update against
+// more than one git source. The revision reported is that of the
+// first source to have committed anything.
+func mergeJobResults(a, b job.Result) job.Result {
+	if a.Revision == "" {
+		a.Revision = b.Revision
+	}
+	if a.Spec == nil {
+		a.Spec = b.Spec
+	}
+	if a.Result == nil {
+		a.Result = update.Result{}
+	}
+	for id, r := range b.Result {
+		a.Result[id] = r
+	}
+	return a
+}
+
+// ownedChanges restricts release changes to the resources owned, and
+// reports whether anything is left.
+func ownedChanges(c release.Changes, owned func(flux.ResourceID) bool) (release.Changes, bool) {
+	switch s := c.(type) {
+	case update.ReleaseImageSpec:
+		var specs []update.ResourceSpec
+		for _, spec := range s.ServiceSpecs {
+			if id, err := spec.AsID(); err == nil && !owned(id) {
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		s.ServiceSpecs = specs
+		return s, len(specs) > 0
+	case update.ReleaseContainersSpec:
+		specs := map[flux.ResourceID][]update.ContainerUpdate{}
+		for id, cs := range s.ContainerSpecs {
+			if owned(id) {
+				specs[id] = cs
+			}
+		}
+		s.ContainerSpecs = specs
+		return s, len(specs) > 0
+	case *update.Automated:
+		a := &update.Automated{}
+		for _, change := range s.Changes {
+			if owned(change.ServiceID) {
+				a.Changes = append(a.Changes, change)
+			}
+		}
+		return a, len(a.Changes) > 0
+	default:
+		return c, true
+	}
+}
+
+// ownedPolicyUpdates restricts policy updates to the resources owned.
+func ownedPolicyUpdates(updates policy.Updates, owned func(flux.ResourceID) bool) (policy.Updates, bool) {
+	res := policy.Updates{}
+	for id, u := range updates {
+		if owned(id) {
+			res[id] = u
+		}
+	}
+	return res, len(res) > 0
+}
@@ -24,6 +24,8 @@ const (
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventRollback     = "rollback"
+	EventPromote      = "promote"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -131,29 +133,61 @@ func (e Event) String() string {
 			"Automated release of %s",
 			strings.Join(strImageIDs, ", "),
 		)
+	case EventRollback:
+		metadata := e.Metadata.(*RollbackEventMetadata)
+		return fmt.Sprintf(
+			"Rolled back automated release %s of %s: %s",
+			ShortRevision(metadata.RolledBack),
+			strings.Join(strServiceIDs, ", "),
+			strings.Join(metadata.Reasons, "; "),
+		)
+	case EventPromote:
+		metadata := e.Metadata.(*PromoteEventMetadata)
+		strImageIDs := metadata.Result.ChangedImages()
+		if len(strImageIDs) == 0 {
+			strImageIDs = []string{"no image changes"}
+		}
+		if len(strServiceIDs) == 0 {
+			strServiceIDs = []string{"no services"}
+		}
+		var user string
+		if metadata.Cause.User != "" {
+			user = fmt.Sprintf(", by %s", metadata.Cause.User)
+		}
+		return fmt.Sprintf(
+			"Promoted: %s from %s to %s, in %s%s",
+			strings.Join(strImageIDs, ", "),
+			metadata.Spec.From,
+			metadata.Spec.To,
+			strings.Join(strServiceIDs, ", "),
+			user,
+		)
 	case EventCommit:
 		metadata := e.Metadata.(*CommitEventMetadata)
 		svcStr := "<no changes>"
 		if len(strServiceIDs) > 0 {
 			svcStr = strings.Join(strServiceIDs, ", ")
 		}
-		return fmt.Sprintf("Commit: %s, %s", shortRevision(metadata.Revision), svcStr)
+		return fmt.Sprintf("Commit: %s, %s", ShortRevision(metadata.Revision), svcStr)
 	case EventSync:
 		metadata := e.Metadata.(*SyncEventMetadata)
 		revStr := "<no revision>"
 		if 0 < len(metadata.Commits) && len(metadata.Commits) <= 2 {
-			revStr = shortRevision(metadata.Commits[0].Revision)
+			revStr = ShortRevision(metadata.Commits[0].Revision)
 		} else if len(metadata.Commits) > 2 {
 			revStr = fmt.Sprintf(
 				"%s..%s",
-				shortRevision(metadata.Commits[len(metadata.Commits)-1].Revision),
-				shortRevision(metadata.Commits[0].Revision),
+				ShortRevision(metadata.Commits[len(metadata.Commits)-1].Revision),
+				ShortRevision(metadata.Commits[0].Revision),
 			)
 		}
 		svcStr := "no services changed"
 		if len(strServiceIDs) > 0 {
 			svcStr = strings.Join(strServiceIDs, ", ")
 		}
+		if metadata.UnverifiedCommit != nil {
+			svcStr += fmt.Sprintf("; stopped at %s, which is not signed", ShortRevision(metadata.UnverifiedCommit.Revision))
+		}
 		return fmt.Sprintf("Sync: %s, %s", revStr, svcStr)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strServiceIDs, ", "))
@@ -170,7 +204,9 @@ func (e Event) String() string {
 	}
 }
 
-func shortRevision(rev string) string {
+// ShortRevision abbreviates a git revision to the length usually
+// shown to people.
+func ShortRevision(rev string) string {
 	if len(rev) <= 7 {
 		return rev
 	}
@@ -185,7 +221,7 @@ type CommitEventMetadata struct {
 }
 
 func (c CommitEventMetadata) ShortRevision() string {
-	return shortRevision(c.Revision)
+	return ShortRevision(c.Revision)
 }
 
 // Commit represents the commit information in a sync event. We could
@@ -214,8 +250,14 @@ type SyncEventMetadata struct {
 	Includes map[string]bool `json:"includes,omitempty"`
 	// Per-resource errors
 	Errors []ResourceError `json:"errors,omitempty"`
+	// Resources deleted from the cluster because they were removed
+	// from the repo
+	Deleted []flux.ResourceID `json:"deleted,omitempty"`
 	// `true` if we have no record of having synced before
 	InitialSync bool `json:"initialSync,omitempty"`
+	// The commit at which syncing stopped, because it does not have
+	// a valid signature
+	UnverifiedCommit *Commit `json:"unverifiedCommit,omitempty"`
 }
 
 // Account for old events, which used the revisions field rather than commits
@@ -315,6 +357,26 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// RollbackEventMetadata is for when an automated release is reverted
+// because the rollout of the images it released failed. The
+// revision, result and so on are those of the commit that reverted
+// the release.
+type RollbackEventMetadata struct {
+	ReleaseEventCommon
+	// The revision with the automated release that was rolled back
+	RolledBack string `json:"rolledBack"`
+	// Why the rollout was considered to have failed
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// PromoteEventMetadata is for when the images used in one path of
+// the git repo are promoted to another
+type PromoteEventMetadata struct {
+	ReleaseEventCommon
+	Spec  update.PromoteSpec `json:"spec"`
+	Cause update.Cause       `json:"cause"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -350,6 +412,20 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventRollback:
+		var metadata RollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventPromote:
+		var metadata PromoteEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	case EventCommit:
 		var metadata CommitEventMetadata
 		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
@@ -403,6 +479,14 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (rem *RollbackEventMetadata) Type() string {
+	return EventRollback
+}
+
+func (pem *PromoteEventMetadata) Type() string {
+	return EventPromote
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
@@ -47,6 +47,41 @@ func TestEvent_ParseReleaseMetaData(t *testing.T) {
 	}
 }
 
+func TestEvent_ParsePromoteMetaData(t *testing.T) {
+	promote := update.PromoteSpec{
+		From:      "staging",
+		To:        "production",
+		Workloads: []update.ResourceSpec{update.ResourceSpecAll},
+	}
+	origEvent := Event{
+		Type: EventPromote,
+		Metadata: &PromoteEventMetadata{
+			Cause: cause,
+			Spec:  promote,
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	err := e.UnmarshalJSON(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch r := e.Metadata.(type) {
+	case *PromoteEventMetadata:
+		if r.Spec.From != promote.From || r.Spec.To != promote.To ||
+			r.Cause != cause {
+			t.Fatal("Promote event wasn't marshalled/unmarshalled")
+		}
+	default:
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	if s := e.String(); s != "Promoted: no image changes from staging to production, in no services, by test user" {
+		t.Errorf("unexpected string for event: %q", s)
+	}
+}
+
 func TestEvent_ParseNoMetadata(t *testing.T) {
 	origEvent := Event{
 		Type: EventLock,
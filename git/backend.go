@@ -0,0 +1,163 @@
+package git
+
+import (
+	"context"
+)
+
+// Backend names an implementation of the git operations used by Repo
+// and Checkout. As an Option, it selects the implementation used by
+// a repo.
+type Backend string
+
+const (
+	// ExecBackend runs the git executable, and is the default.
+	ExecBackend Backend = "exec"
+	// GoGitBackend uses a pure-Go git implementation (go-git), so
+	// needs no git executable for most operations; signing and
+	// verifying commits, and submodules, still use it.
+	GoGitBackend Backend = "go-git"
+)
+
+// Backends are the names of the backends available.
+var Backends = []Backend{ExecBackend, GoGitBackend}
+
+func (b Backend) apply(r *Repo) {
+	r.backendName = b
+}
+
+// newBackend constructs the backend named; an empty or unknown name
+// gets the default backend.
+func newBackend(name Backend, sshKey string) backend {
+	switch name {
+	case GoGitBackend:
+		return newGoGitBackend(sshKey)
+	default:
+		return execBackend{}
+	}
+}
+
+// backend carries out the git operations needed by Repo and Checkout,
+// on repos in the local filesystem and between them and remotes.
+// Credentials for remotes are supplied in the context (see
+// withCredentials).
+type backend interface {
+	config(ctx context.Context, workingDir, user, email string) error
+	setConfig(ctx context.Context, workingDir string, items map[string]string) error
+	clone(ctx context.Context, workingDir, repoURL, repoBranch string, sparse []string) (string, error)
+	mirror(ctx context.Context, workingDir, repoURL string, depth int, configs ...string) (string, error)
+	checkout(ctx context.Context, workingDir, ref string) error
+	checkPush(ctx context.Context, workingDir, upstream string) error
+	commit(ctx context.Context, workingDir string, commitAction CommitAction) error
+	rebase(ctx context.Context, workingDir, upstream, signingKey string) error
+	updateSubmodules(ctx context.Context, workingDir, upstream string, configs []string) ([]string, error)
+	verifyCommit(ctx context.Context, workingDir, commit string) error
+	push(ctx context.Context, workingDir, upstream string, refs []string) error
+	fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error
+	refExists(ctx context.Context, workingDir, ref string) (bool, error)
+	getNotesRef(ctx context.Context, workingDir, ref string) (string, error)
+	addNote(ctx context.Context, workingDir, rev, notesRef string, note interface{}) error
+	getNote(ctx context.Context, workingDir, notesRef, rev string, note interface{}) (bool, error)
+	noteRevList(ctx context.Context, workingDir, notesRef string) (map[string]struct{}, error)
+	refRevision(ctx context.Context, path, ref string) (string, error)
+	onelinelog(ctx context.Context, path, refspec string, subdirs []string) ([]Commit, error)
+	topoLog(ctx context.Context, path, from, to string) ([]HistoryCommit, error)
+	moveTagAndPush(ctx context.Context, path, tag, ref, msg, signingKey, upstream string) error
+	changed(ctx context.Context, path, ref string, subPaths []string) ([]string, error)
+	check(ctx context.Context, workingDir string, subdirs []string) bool
+}
+
+// execBackend runs the git executable, using the functions in
+// operations.go.
+type execBackend struct{}
+
+func (execBackend) config(ctx context.Context, workingDir, user, email string) error {
+	return config(ctx, workingDir, user, email)
+}
+
+func (execBackend) setConfig(ctx context.Context, workingDir string, items map[string]string) error {
+	return setConfig(ctx, workingDir, items)
+}
+
+func (execBackend) clone(ctx context.Context, workingDir, repoURL, repoBranch string, sparse []string) (string, error) {
+	return clone(ctx, workingDir, repoURL, repoBranch, sparse)
+}
+
+func (execBackend) mirror(ctx context.Context, workingDir, repoURL string, depth int, configs ...string) (string, error) {
+	return mirror(ctx, workingDir, repoURL, depth, configs...)
+}
+
+func (execBackend) checkout(ctx context.Context, workingDir, ref string) error {
+	return checkout(ctx, workingDir, ref)
+}
+
+func (execBackend) checkPush(ctx context.Context, workingDir, upstream string) error {
+	return checkPush(ctx, workingDir, upstream)
+}
+
+func (execBackend) commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
+	return commit(ctx, workingDir, commitAction)
+}
+
+func (execBackend) rebase(ctx context.Context, workingDir, upstream, signingKey string) error {
+	return rebase(ctx, workingDir, upstream, signingKey)
+}
+
+func (execBackend) updateSubmodules(ctx context.Context, workingDir, upstream string, configs []string) ([]string, error) {
+	return updateSubmodules(ctx, workingDir, upstream, configs)
+}
+
+func (execBackend) verifyCommit(ctx context.Context, workingDir, rev string) error {
+	return verifyCommit(ctx, workingDir, rev)
+}
+
+func (execBackend) push(ctx context.Context, workingDir, upstream string, refs []string) error {
+	return push(ctx, workingDir, upstream, refs)
+}
+
+func (execBackend) fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
+	return fetch(ctx, workingDir, upstream, refspec...)
+}
+
+func (execBackend) refExists(ctx context.Context, workingDir, ref string) (bool, error) {
+	return refExists(ctx, workingDir, ref)
+}
+
+func (execBackend) getNotesRef(ctx context.Context, workingDir, ref string) (string, error) {
+	return getNotesRef(ctx, workingDir, ref)
+}
+
+func (execBackend) addNote(ctx context.Context, workingDir, rev, notesRef string, note interface{}) error {
+	return addNote(ctx, workingDir, rev, notesRef, note)
+}
+
+func (execBackend) getNote(ctx context.Context, workingDir, notesRef, rev string, note interface{}) (bool, error) {
+	return getNote(ctx, workingDir, notesRef, rev, note)
+}
+
+func (execBackend) noteRevList(ctx context.Context, workingDir, notesRef string) (map[string]struct{}, error) {
+	return noteRevList(ctx, workingDir, notesRef)
+}
+
+func (execBackend) refRevision(ctx context.Context, path, ref string) (string, error) {
+	return refRevision(ctx, path, ref)
+}
+
+func (execBackend) onelinelog(ctx context.Context, path, refspec string, subdirs []string) ([]Commit, error) {
+	return onelinelog(ctx, path, refspec, subdirs)
+}
+
+func (execBackend) topoLog(ctx context.Context, path, from, to string) ([]HistoryCommit, error) {
+	return topoLog(ctx, path, from, to)
+}
+
+func (execBackend) moveTagAndPush(ctx context.Context, path, tag, ref, msg, signingKey, upstream string) error {
+	return moveTagAndPush(ctx, path, tag, ref, msg, signingKey, upstream)
+}
+
+func (execBackend) changed(ctx context.Context, path, ref string, subPaths []string) ([]string, error) {
+	return changed(ctx, path, ref, subPaths)
+}
+
+func (execBackend) check(ctx context.Context, workingDir string, subdirs []string) bool {
+	return check(ctx, workingDir, subdirs)
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"context"
+	"strings"
+)
+
+// HTTPCredentials are the username and password (or personal access
+// token) to give when connecting to the origin over HTTPS. Git gets
+// them from a credential helper, which reads them from the
+// environment of only those git commands that need them; so they
+// never appear in the URL, in git's config, or in error messages.
+type HTTPCredentials struct {
+	Username string
+	Password string
+}
+
+func (c HTTPCredentials) apply(r *Repo) {
+	r.credentials = &c
+}
+
+const (
+	credentialsUsernameVar = "FLUX_GIT_HTTPS_USERNAME"
+	credentialsPasswordVar = "FLUX_GIT_HTTPS_PASSWORD"
+
+	// credentialHelper answers git's requests for credentials with
+	// those in the environment. It's set as `credential.helper`;
+	// the leading `!` means it's run as a shell command.
+	credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$` +
+		credentialsUsernameVar + `" "$` + credentialsPasswordVar + `"; }; f`
+
+	redacted = "<redacted>"
+)
+
+type credentialsKey struct{}
+
+// withCredentials attaches credentials to a context, so that the git
+// commands run with it are given them. It's a no-op if there are no
+// credentials.
+func withCredentials(ctx context.Context, creds *HTTPCredentials) context.Context {
+	if creds == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+func credentialsFrom(ctx context.Context) *HTTPCredentials {
+	creds, _ := ctx.Value(credentialsKey{}).(*HTTPCredentials)
+	return creds
+}
+
+// env gives the environment entries that supply the credentials to
+// the credential helper.
+func (c *HTTPCredentials) env() []string {
+	return []string{
+		credentialsUsernameVar + "=" + c.Username,
+		credentialsPasswordVar + "=" + c.Password,
+	}
+}
+
+// redact removes the password from a message, should git have
+// included it.
+func (c *HTTPCredentials) redact(msg string) string {
+	if c.Password == "" {
+		return msg
+	}
+	return strings.Replace(msg, c.Password, redacted, -1)
+}
@@ -0,0 +1,52 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	creds := &HTTPCredentials{Username: "flux", Password: "s3cr$t 'token'"}
+
+	cmd := exec.Command("git", "-c", "credential.helper="+credentialHelper, "credential", "fill")
+	cmd.Env = append(env(), creds.env()...)
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=example.com\n\n")
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"username=flux", "password=s3cr$t 'token'"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected %q in credentials given to git, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestCredentialsRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := execGitCmd(context.Background(), dir, nil, "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &HTTPCredentials{Username: "flux", Password: "s3cr3t"}
+	ctx := withCredentials(context.Background(), creds)
+
+	// This fails, and git's error message includes the argument
+	err = execGitCmd(ctx, dir, nil, "rev-parse", creds.Password)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), creds.Password) {
+		t.Errorf("expected password to be redacted from error, got %q", err.Error())
+	}
+}
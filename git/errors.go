@@ -54,10 +54,12 @@ write to the upstream git repository.
 	if strings.HasPrefix(url, "http://") ||
 		strings.HasPrefix(url, "https://") {
 		help = help + `
-Usually, git URLs starting with "http://" or "https://" will not work
-well with flux, because they require the user to supply credentials
-interactively. If possible, use an SSH URL (starting with "ssh://", or
-of the form "user@host:path/to/repo").
+Git URLs starting with "http://" or "https://" need credentials to
+write to the repository. Check that they were supplied to the daemon
+(with --git-https-credentials, or in the environment), and that they
+have write access; e.g., that a personal access token has the scope
+needed to push. Otherwise, use an SSH URL (starting with "ssh://", or
+of the form "user@host:path/to/repo") with a deploy key.
 `
 	} else {
 		help = help + `
@@ -86,6 +88,25 @@ create a new deploy key. To create a new one, use
 	}
 }
 
+func RebaseError(url string, actual error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  actual,
+		Help: `Problem rebasing a commit onto changes pushed to the git repository.
+
+Someone pushed to the git repository
+
+    ` + url + `
+
+while fluxd was making a commit, and the changes they pushed conflict
+with those in fluxd's commit, so it could not be rebased onto them.
+
+Please check the changes made recently in the git repository, then
+try again, if it still makes sense to.
+`,
+	}
+}
+
 func PushError(url string, actual error) error {
 	return &fluxerr.Error{
 		Type: fluxerr.User,
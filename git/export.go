@@ -21,11 +21,11 @@ func (e *Export) Clean() {
 
 // Export creates a minimal clone of the repo, at the ref given.
 func (r *Repo) Export(ctx context.Context, ref string) (*Export, error) {
-	dir, err := r.workingClone(ctx, "")
+	dir, err := r.workingClone(ctx, "", nil)
 	if err != nil {
 		return nil, err
 	}
-	if err = checkout(ctx, dir, ref); err != nil {
+	if err = r.backend.checkout(ctx, dir, ref); err != nil {
 		return nil, err
 	}
 	return &Export{dir}, nil
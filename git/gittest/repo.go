@@ -3,6 +3,7 @@ package gittest
 import (
 	"context"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
@@ -12,6 +13,11 @@ import (
 	"github.com/weaveworks/flux/git"
 )
 
+// Backend is the git backend used by the repos made here; set
+// FLUX_GIT_BACKEND to run tests against a backend other than the
+// default.
+var Backend = git.Backend(os.Getenv("FLUX_GIT_BACKEND"))
+
 // Repo creates a new clone-able git repo, pre-populated with some kubernetes
 // files and a few commits. Also returns a cleanup func to clean up after.
 func Repo(t *testing.T) (*git.Repo, func()) {
@@ -55,7 +61,7 @@ func Repo(t *testing.T) (*git.Repo, func()) {
 
 	mirror := git.NewRepo(git.Remote{
 		URL: "file://" + gitDir,
-	})
+	}, Backend)
 	return mirror, func() {
 		mirror.Clean()
 		cleanup()
@@ -2,8 +2,11 @@ package gittest
 
 import (
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -66,6 +69,261 @@ func TestCommit(t *testing.T) {
 	}
 }
 
+func TestCommitAndPushBranch(t *testing.T) {
+	checkout, repo, cleanup := CheckoutWithConfig(t, TestConfig)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before, err := repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the same change in two checkouts; the second time, the
+	// branch already has it, so it's left alone.
+	var revs []string
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			checkout, err = repo.Clone(ctx, TestConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer checkout.Clean()
+		}
+		path := filepath.Join(checkout.ManifestDirs()[0], "helloworld-deploy.yaml")
+		if err := ioutil.WriteFile(path, []byte("PROPOSED CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := checkout.CommitAndPushBranch(ctx, "flux/proposed", git.CommitAction{Message: "Proposed change"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+		if err := repo.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if revs[0] != revs[1] {
+		t.Errorf("expected the branch to be left alone when it has the changes, but it went from %s to %s", revs[0], revs[1])
+	}
+
+	branchRev, err := repo.Revision(ctx, "flux/proposed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branchRev != revs[0] {
+		t.Errorf("expected branch at %s, got %s", revs[0], branchRev)
+	}
+	after, err := repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("expected master to be unchanged at %s, got %s", before, after)
+	}
+}
+
+// When someone else pushes in between cloning and pushing, the commit
+// should be rebased onto theirs and pushed again, with its note
+func TestCommitAndPush_Rebase(t *testing.T) {
+	config := TestConfig
+	config.PushAttempts = 3
+	checkout, repo, cleanup := CheckoutWithConfig(t, config)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	other, err := repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Clean()
+	if err := ioutil.WriteFile(filepath.Join(other.ManifestDirs()[0], "semver-deploy.yaml"), []byte("OTHER CHANGE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.CommitAndPush(ctx, git.CommitAction{Message: "Other change"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	otherRev, err := other.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(checkout.ManifestDirs()[0], "helloworld-deploy.yaml"), []byte("OUR CHANGE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectedNote := Note{Comment: "Rebased"}
+	if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "Our change"}, &expectedNote); err != nil {
+		t.Fatal(err)
+	}
+	if attempts := checkout.PushAttempts(); attempts != 2 {
+		t.Errorf("expected 2 push attempts, got %d", attempts)
+	}
+
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	commits, err := repo.CommitsBefore(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) < 2 || commits[0].Message != "Our change" || commits[1].Revision != otherRev {
+		t.Fatalf("expected our commit on top of the other commit, got %+v", commits)
+	}
+
+	fresh, err := repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Clean()
+	for file, expected := range map[string]string{
+		"semver-deploy.yaml":     "OTHER CHANGE",
+		"helloworld-deploy.yaml": "OUR CHANGE",
+	} {
+		contents, err := ioutil.ReadFile(filepath.Join(fresh.ManifestDirs()[0], file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != expected {
+			t.Errorf("expected %s to contain %q, got %q", file, expected, contents)
+		}
+	}
+	var note Note
+	ok, err := fresh.GetNote(ctx, commits[0].Revision, &note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || note != expectedNote {
+		t.Errorf("expected note %+v on the rebased commit, got %+v (found: %v)", expectedNote, note, ok)
+	}
+}
+
+// When someone else pushes a change that conflicts, the push should
+// fail rather than be retried
+func TestCommitAndPush_RebaseConflict(t *testing.T) {
+	config := TestConfig
+	config.PushAttempts = 3
+	checkout, repo, cleanup := CheckoutWithConfig(t, config)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	other, err := repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Clean()
+	if err := ioutil.WriteFile(filepath.Join(other.ManifestDirs()[0], "helloworld-deploy.yaml"), []byte("OTHER CHANGE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.CommitAndPush(ctx, git.CommitAction{Message: "Other change"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(checkout.ManifestDirs()[0], "helloworld-deploy.yaml"), []byte("OUR CHANGE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "Our change"}, nil); err == nil {
+		t.Fatal("expected an error from pushing a conflicting change")
+	}
+	if attempts := checkout.PushAttempts(); attempts != 1 {
+		t.Errorf("expected 1 push attempt, got %d", attempts)
+	}
+}
+
+func TestCheckout_Submodules(t *testing.T) {
+	repo, cleanup := Repo(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newer versions of git refuse to clone submodules from the local
+	// filesystem, unless told otherwise
+	home, err := ioutil.TempDir("", "flux-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[protocol \"file\"]\n\tallow = always\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	// A repo of shared manifests, next to the upstream repo, so it
+	// can be referred to with a relative URL
+	upstreamDir := strings.TrimPrefix(repo.Origin().URL, "file://")
+	sharedFiles := filepath.Join(filepath.Dir(upstreamDir), "shared-files")
+	sharedDir := filepath.Join(filepath.Dir(upstreamDir), "shared.git")
+	if err := os.Mkdir(sharedFiles, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sharedFiles, "base.yaml"), []byte("SHARED"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	working := filepath.Join(filepath.Dir(upstreamDir), "working")
+	for _, args := range [][]string{
+		{"-C", sharedFiles, "init"},
+		{"-C", sharedFiles, "add", "--all"},
+		{"-C", sharedFiles, "-c", "user.name=example", "-c", "user.email=example@example.com", "commit", "-m", "Shared"},
+		{"clone", "--bare", sharedFiles, sharedDir},
+		{"clone", repo.Origin().URL, working},
+		{"-C", working, "submodule", "add", "../shared.git", "shared"},
+		{"-C", working, "-c", "user.name=example", "-c", "user.email=example@example.com", "commit", "-m", "Add submodule"},
+		{"-C", working, "push", "origin", "HEAD:master"},
+	} {
+		if err := execCommand("git", args...); err != nil {
+			t.Fatalf("git %v: %s", args, err)
+		}
+	}
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	config := TestConfig
+	config.Submodules = true
+	checkout, err := repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkout.Clean()
+
+	if subs := checkout.Submodules(); !reflect.DeepEqual(subs, []string{"shared"}) {
+		t.Errorf("expected submodules [shared], got %v", subs)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(checkout.Dir(), "shared", "base.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "SHARED" {
+		t.Errorf("expected the file from the submodule, got %q", contents)
+	}
+	if !checkout.InSubmodule("shared/base.yaml") || checkout.InSubmodule("helloworld-deploy.yaml") || checkout.InSubmodule("shared-files") {
+		t.Error("expected only shared/base.yaml to be in a submodule")
+	}
+
+	// Without the option, the submodule is left alone
+	plain, err := repo.Clone(ctx, TestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Clean()
+	if len(plain.Submodules()) > 0 {
+		t.Errorf("expected no submodules, got %v", plain.Submodules())
+	}
+	if _, err := os.Stat(filepath.Join(plain.Dir(), "shared", "base.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected no files from the submodule, got %v", err)
+	}
+}
+
 func TestCheckout(t *testing.T) {
 	repo, cleanup := Repo(t)
 	defer cleanup()
@@ -177,3 +435,99 @@ func TestCheckout(t *testing.T) {
 	close(sd)
 	sg.Wait()
 }
+
+func TestReadOnlyCheckout(t *testing.T) {
+	repo, cleanup := Repo(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	readonly := git.NewRepo(repo.Origin(), git.ReadOnly, Backend)
+	defer readonly.Clean()
+	if err := readonly.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	checkout, err := readonly.Clone(ctx, TestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkout.Clean()
+
+	for file := range testfiles.Files {
+		path := filepath.Join(checkout.Dir(), file)
+		if err := ioutil.WriteFile(path, []byte("FIRST CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "Changed file"}, nil); err != git.ErrReadOnly {
+		t.Errorf("expected read-only error from commit, got %v", err)
+	}
+	head, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout.MoveSyncTagAndPush(ctx, head, "Sync pointer"); err != git.ErrReadOnly {
+		t.Errorf("expected read-only error from moving the sync tag, got %v", err)
+	}
+}
+
+func TestSignedCommit(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not available")
+	}
+	gpgHome, err := ioutil.TempDir("", "flux-gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gpgHome)
+	if prev, ok := os.LookupEnv("GNUPGHOME"); ok {
+		defer os.Setenv("GNUPGHOME", prev)
+	} else {
+		defer os.Unsetenv("GNUPGHOME")
+	}
+	os.Setenv("GNUPGHOME", gpgHome)
+	signingKey := "flux@example.com"
+	if err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", signingKey, "default", "default", "never").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := TestConfig
+	config.SigningKey = signingKey
+	checkout, _, cleanup := CheckoutWithConfig(t, config)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	unsigned, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file := range testfiles.Files {
+		path := filepath.Join(checkout.Dir(), file)
+		if err := ioutil.WriteFile(path, []byte("FIRST CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "Signed change"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout.MoveSyncTagAndPush(ctx, signed, "Sync pointer"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkout.VerifyCommit(ctx, signed); err != nil {
+		t.Errorf("expected commit to have a valid signature, got %v", err)
+	}
+	if err := checkout.VerifyCommit(ctx, unsigned); err == nil {
+		t.Error("expected unsigned commit to fail verification")
+	}
+}
@@ -0,0 +1,1069 @@
+package git
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	gogit "gopkg.in/src-d/go-git.v4"
+	gogitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+var installLocalTransport sync.Once
+
+// newGoGitBackend constructs a go-git backend. The first time, it
+// makes go-git serve fetches and pushes between repos in the local
+// filesystem (e.g., from the mirror to working clones) in-process,
+// rather than by running git-upload-pack and git-receive-pack. That's
+// a global setting in go-git, so it's only made when the backend is
+// used.
+func newGoGitBackend(sshKey string) goGitBackend {
+	installLocalTransport.Do(func() {
+		client.InstallProtocol("file", localTransport{server.NewServer(localLoader{})})
+	})
+	return goGitBackend{sshKey: sshKey}
+}
+
+// localTransport is go-git's in-process server, except that it copes
+// with pushes that only delete refs (e.g., removing the write check
+// tag), which come without a packfile, and with fetches into repos
+// that have commits the server doesn't (e.g., one that's about to be
+// rebased); go-git's server expects a packfile, and to have every
+// commit the client has.
+type localTransport struct {
+	transport.Transport
+}
+
+func (t localTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	session, err := t.Transport.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	return knownHavesSession{session, ep}, nil
+}
+
+type knownHavesSession struct {
+	transport.UploadPackSession
+	ep *transport.Endpoint
+}
+
+func (s knownHavesSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	st, err := localLoader{}.Load(s.ep)
+	if err != nil {
+		return nil, err
+	}
+	var haves []plumbing.Hash
+	for _, h := range req.Haves {
+		if st.HasEncodedObject(h) == nil {
+			haves = append(haves, h)
+		}
+	}
+	req.Haves = haves
+	return s.UploadPackSession.UploadPack(ctx, req)
+}
+
+func (t localTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	session, err := t.Transport.NewReceivePackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	return deleteOnlySession{session, ep}, nil
+}
+
+type deleteOnlySession struct {
+	transport.ReceivePackSession
+	ep *transport.Endpoint
+}
+
+func (s deleteOnlySession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error) {
+	if req.Packfile != nil {
+		return s.ReceivePackSession.ReceivePack(ctx, req)
+	}
+	st, err := localLoader{}.Load(s.ep)
+	if err != nil {
+		return nil, err
+	}
+	status := packp.NewReportStatus()
+	status.UnpackStatus = "ok"
+	for _, cmd := range req.Commands {
+		cmdStatus := &packp.CommandStatus{ReferenceName: cmd.Name, Status: "ok"}
+		if cmd.New != plumbing.ZeroHash {
+			// Only deletes can come without a packfile
+			cmdStatus.Status = "packfile expected"
+		} else if err := st.RemoveReference(cmd.Name); err != nil {
+			cmdStatus.Status = err.Error()
+		}
+		status.CommandStatuses = append(status.CommandStatuses, cmdStatus)
+	}
+	return status, nil
+}
+
+// localLoader opens repos in the local filesystem, bare or not, for
+// the in-process file transport.
+type localLoader struct{}
+
+func (localLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	dir := ep.Path
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		dir = filepath.Join(dir, ".git")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config")); err != nil {
+		return nil, transport.ErrRepositoryNotFound
+	}
+	return filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault()), nil
+}
+
+// goGitBackend carries out git operations with go-git, a pure-Go
+// implementation of git, rather than running the git executable.
+// Signing and verifying commits are left to the git executable
+// (through the embedded execBackend), since those use the GPG
+// keyring, as is listing the history whose commits are verified; as are rebasing and updating submodules, which go-git
+// doesn't do well enough. go-git doesn't do sparse checkouts, so
+// working clones always have all the files.
+type goGitBackend struct {
+	execBackend
+	// Private key for SSH remotes; if empty, go-git's default (the
+	// SSH agent) is used
+	sshKey string
+}
+
+// auth gives the means of authenticating to the remote at the URL
+// given: the HTTPS credentials in the context, or the SSH key.
+func (b goGitBackend) auth(ctx context.Context, url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	switch ep.Protocol {
+	case "http", "https":
+		if creds := credentialsFrom(ctx); creds != nil {
+			return &githttp.BasicAuth{Username: creds.Username, Password: creds.Password}, nil
+		}
+	case "ssh":
+		if b.sshKey != "" {
+			user := ep.User
+			if user == "" {
+				user = "git"
+			}
+			keys, err := gitssh.NewPublicKeysFromFile(user, b.sshKey, "")
+			if err != nil {
+				return nil, err
+			}
+			return keys, nil
+		}
+	}
+	return nil, nil
+}
+
+// remote gets the remote with the name given or, if there's no such
+// remote, an anonymous remote with the name as its URL, as git does.
+func (b goGitBackend) remote(repo *gogit.Repository, upstream string) (*gogit.Remote, error) {
+	remote, err := repo.Remote(upstream)
+	switch {
+	case err == nil:
+		return remote, nil
+	case err != gogit.ErrRemoteNotFound:
+		return nil, err
+	}
+	return gogit.NewRemote(repo.Storer, &gogitconfig.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{upstream},
+	}), nil
+}
+
+func (b goGitBackend) pushRefSpecs(ctx context.Context, repo *gogit.Repository, upstream string, refspecs ...string) error {
+	remote, err := b.remote(repo, upstream)
+	if err != nil {
+		return err
+	}
+	auth, err := b.auth(ctx, remote.Config().URLs[0])
+	if err != nil {
+		return err
+	}
+	var specs []gogitconfig.RefSpec
+	for _, s := range refspecs {
+		specs = append(specs, gogitconfig.RefSpec(s))
+	}
+	err = remote.PushContext(ctx, &gogit.PushOptions{RemoteName: remote.Config().Name, RefSpecs: specs, Auth: auth})
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+func (b goGitBackend) config(ctx context.Context, workingDir, user, email string) error {
+	return b.setConfig(ctx, workingDir, map[string]string{
+		"user.name":  user,
+		"user.email": email,
+	})
+}
+
+func (b goGitBackend) setConfig(ctx context.Context, workingDir string, items map[string]string) error {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return errors.Wrap(err, "setting git config")
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return errors.Wrap(err, "setting git config")
+	}
+	for k, v := range items {
+		i, j := strings.Index(k, "."), strings.LastIndex(k, ".")
+		if i < 0 {
+			return fmt.Errorf("setting git config: key does not contain a section: %s", k)
+		}
+		section := cfg.Raw.Section(k[:i])
+		if i == j {
+			section.SetOption(k[j+1:], v)
+		} else {
+			section.Subsection(k[i+1:j]).SetOption(k[j+1:], v)
+		}
+	}
+	if err := repo.Storer.SetConfig(cfg); err != nil {
+		return errors.Wrap(err, "setting git config")
+	}
+	return nil
+}
+
+func (b goGitBackend) clone(ctx context.Context, workingDir, repoURL, repoBranch string, sparse []string) (string, error) {
+	auth, err := b.auth(ctx, repoURL)
+	if err != nil {
+		return "", errors.Wrap(err, "git clone")
+	}
+	opts := &gogit.CloneOptions{URL: repoURL, Auth: auth, Tags: gogit.AllTags}
+	if repoBranch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(repoBranch)
+	}
+	if _, err := gogit.PlainCloneContext(ctx, workingDir, false, opts); err != nil {
+		return "", errors.Wrap(err, "git clone")
+	}
+	return workingDir, nil
+}
+
+func (b goGitBackend) mirror(ctx context.Context, workingDir, repoURL string, depth int, configs ...string) (string, error) {
+	repo, err := gogit.PlainInit(workingDir, true)
+	if err != nil {
+		return "", errors.Wrap(err, "git clone --mirror")
+	}
+	remote, err := repo.CreateRemote(&gogitconfig.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{repoURL},
+		Fetch: []gogitconfig.RefSpec{"+refs/*:refs/*"},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "git clone --mirror")
+	}
+	items := map[string]string{"remote.origin.mirror": "true"}
+	for _, c := range configs {
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) == 2 {
+			items[kv[0]] = kv[1]
+		}
+	}
+	if err := b.setConfig(ctx, workingDir, items); err != nil {
+		return "", err
+	}
+	if err := b.fetchRefSpecs(ctx, repo, "origin", nil, depth); err != nil && !isNoMatchingRefs(err) {
+		return "", errors.Wrap(err, "git clone --mirror")
+	}
+
+	// Point HEAD where the origin's HEAD points, as `git clone
+	// --mirror` does. If that can't be found out, HEAD is left
+	// pointing at master.
+	auth, err := b.auth(ctx, repoURL)
+	if err != nil {
+		return workingDir, nil
+	}
+	refs, err := remote.List(&gogit.ListOptions{Auth: auth})
+	if err != nil {
+		return workingDir, nil
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			head := plumbing.NewSymbolicReference(plumbing.HEAD, ref.Target())
+			if err := repo.Storer.SetReference(head); err != nil {
+				return "", errors.Wrap(err, "git clone --mirror")
+			}
+		}
+	}
+	return workingDir, nil
+}
+
+func (b goGitBackend) checkout(ctx context.Context, workingDir, ref string) error {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	opts := &gogit.CheckoutOptions{}
+	branch := plumbing.NewBranchReferenceName(ref)
+	if _, err := repo.Reference(branch, false); err == nil {
+		opts.Branch = branch
+	} else {
+		hash, err := resolveCommit(repo, ref)
+		if err != nil {
+			return err
+		}
+		opts.Hash = hash
+	}
+	return wt.Checkout(opts)
+}
+
+func (b goGitBackend) checkPush(ctx context.Context, workingDir, upstream string) error {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return err
+	}
+	head, err := resolveCommit(repo, "HEAD")
+	if err != nil {
+		return errors.Wrap(err, "tag for write check")
+	}
+	tag := plumbing.NewTagReferenceName(CheckPushTag)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(tag, head)); err != nil {
+		return errors.Wrap(err, "tag for write check")
+	}
+	if err := b.pushRefSpecs(ctx, repo, upstream, "+"+tag.String()+":"+tag.String()); err != nil {
+		return errors.Wrap(err, "attempt to push tag")
+	}
+	return b.pushRefSpecs(ctx, repo, upstream, ":"+tag.String())
+}
+
+func (b goGitBackend) commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
+	if commitAction.SigningKey != "" {
+		return b.execBackend.commit(ctx, workingDir, commitAction)
+	}
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return errors.Wrap(err, "git commit")
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "git commit")
+	}
+	committer, err := signature(repo)
+	if err != nil {
+		return errors.Wrap(err, "git commit")
+	}
+	author := committer
+	if commitAction.Author != "" {
+		author = parseAuthor(commitAction.Author, committer)
+	}
+	if _, err := wt.Commit(commitAction.Message, &gogit.CommitOptions{
+		All:       true,
+		Author:    author,
+		Committer: committer,
+	}); err != nil {
+		return errors.Wrap(err, "git commit")
+	}
+	return nil
+}
+
+func (b goGitBackend) push(ctx context.Context, workingDir, upstream string, refs []string) error {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err == nil {
+		var specs []string
+		for _, ref := range refs {
+			if strings.Contains(ref, ":") {
+				specs = append(specs, ref) // already a refspec
+				continue
+			}
+			name := ref
+			if !strings.HasPrefix(name, "refs/") {
+				name = plumbing.NewBranchReferenceName(ref).String()
+			}
+			specs = append(specs, name+":"+name)
+		}
+		err = b.pushRefSpecs(ctx, repo, upstream, specs...)
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
+	}
+	return nil
+}
+
+func (b goGitBackend) fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err == nil {
+		err = b.fetchRefSpecs(ctx, repo, upstream, refspec, 0)
+	}
+	// As with git, it's not an error if a ref isn't there to fetch
+	if err != nil && !isNoMatchingRefs(err) {
+		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
+	}
+	return nil
+}
+
+func (b goGitBackend) fetchRefSpecs(ctx context.Context, repo *gogit.Repository, upstream string, refspecs []string, depth int) error {
+	remote, err := b.remote(repo, upstream)
+	if err != nil {
+		return err
+	}
+	auth, err := b.auth(ctx, remote.Config().URLs[0])
+	if err != nil {
+		return err
+	}
+	var specs []gogitconfig.RefSpec
+	for _, s := range refspecs {
+		specs = append(specs, gogitconfig.RefSpec(s))
+	}
+	err = remote.FetchContext(ctx, &gogit.FetchOptions{RemoteName: remote.Config().Name, RefSpecs: specs, Auth: auth, Tags: gogit.AllTags, Depth: depth})
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+func (b goGitBackend) refExists(ctx context.Context, workingDir, ref string) (bool, error) {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return false, err
+	}
+	_, err = resolveCommit(repo, ref)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+func (b goGitBackend) getNotesRef(ctx context.Context, workingDir, ref string) (string, error) {
+	return expandNotesRef(ref), nil
+}
+
+func (b goGitBackend) addNote(ctx context.Context, workingDir, rev, notesRef string, note interface{}) error {
+	content, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return err
+	}
+	hash, err := resolveCommit(repo, rev)
+	if err != nil {
+		return err
+	}
+	parent, tree, err := notesTree(repo, notesRef)
+	if err != nil {
+		return err
+	}
+
+	var entries []object.TreeEntry
+	if tree != nil {
+		if _, err := noteFile(tree, hash.String()); err == nil {
+			return fmt.Errorf("Cannot add notes. Found existing notes for object %s.", hash)
+		}
+		entries = append(entries, tree.Entries...)
+	}
+	blob, err := storeBlob(repo, append(content, '\n'))
+	if err != nil {
+		return err
+	}
+	entries = append(entries, object.TreeEntry{Name: hash.String(), Mode: filemode.Regular, Hash: blob})
+	sortTreeEntries(entries)
+	treeHash, err := storeObject(repo, &object.Tree{Entries: entries})
+	if err != nil {
+		return err
+	}
+
+	sig, err := signature(repo)
+	if err != nil {
+		return err
+	}
+	commit := &object.Commit{
+		Author:    *sig,
+		Committer: *sig,
+		Message:   "Notes added by 'git notes add'\n",
+		TreeHash:  treeHash,
+	}
+	if parent != nil {
+		commit.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+	commitHash, err := storeObject(repo, commit)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(expandNotesRef(notesRef)), commitHash))
+}
+
+func (b goGitBackend) getNote(ctx context.Context, workingDir, notesRef, rev string, note interface{}) (bool, error) {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return false, err
+	}
+	_, tree, err := notesTree(repo, notesRef)
+	if err != nil || tree == nil {
+		return false, err
+	}
+	hash, err := resolveCommit(repo, rev)
+	if err != nil {
+		return false, err
+	}
+	file, err := noteFile(tree, hash.String())
+	switch {
+	case err == object.ErrFileNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(content), note); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b goGitBackend) noteRevList(ctx context.Context, workingDir, notesRef string) (map[string]struct{}, error) {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	_, tree, err := notesTree(repo, notesRef)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]struct{}{}
+	if tree == nil {
+		return result, nil
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		// Notes may be in subdirectories ("fanout"), named by the
+		// start of the revision
+		result[strings.Replace(f.Name, "/", "", -1)] = struct{}{}
+		return nil
+	})
+	return result, err
+}
+
+func (b goGitBackend) refRevision(ctx context.Context, path, ref string) (string, error) {
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	hash, err := resolveCommit(repo, ref)
+	if err == plumbing.ErrReferenceNotFound {
+		// Use git's wording, since callers look for it
+		return "", fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree.", ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+func (b goGitBackend) onelinelog(ctx context.Context, path, refspec string, subdirs []string) ([]Commit, error) {
+	if err := checkPaths(subdirs); err != nil {
+		return nil, err
+	}
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	from, to := "", refspec
+	if i := strings.Index(refspec, ".."); i >= 0 {
+		from, to = refspec[:i], refspec[i+2:]
+	}
+
+	var exclude *object.Commit
+	if from != "" {
+		hash, err := resolveCommit(repo, from)
+		if err != nil {
+			return nil, err
+		}
+		if exclude, err = repo.CommitObject(hash); err != nil {
+			return nil, err
+		}
+	}
+	hash, err := resolveCommit(repo, to)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	walked, err := revWalk(repo, head, exclude)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*object.Commit
+	for _, c := range walked {
+		if len(subdirs) > 0 {
+			touches, err := touchesPaths(c, subdirs)
+			if err != nil {
+				return nil, err
+			}
+			if !touches {
+				continue
+			}
+		}
+		commits = append(commits, c)
+	}
+
+	result := make([]Commit, len(commits))
+	for i, c := range commits {
+		result[i] = Commit{Revision: c.Hash.String(), Message: strings.SplitN(c.Message, "\n", 2)[0]}
+	}
+	return result, nil
+}
+
+// revWalk returns the commits reachable from `head` but not from
+// `exclude` (if not nil), newest first, as `git log exclude..head`
+// does. Like git, it walks back from both at once, in order of commit
+// time, marking what's reachable from `exclude` as uninteresting; and
+// it stops once only uninteresting commits are left to visit, i.e.,
+// around the merge-base, rather than looking at all of history.
+func revWalk(repo *gogit.Repository, head, exclude *object.Commit) ([]*object.Commit, error) {
+	var (
+		queue         commitQueue
+		queued        = map[plumbing.Hash]*object.Commit{}
+		visited       = map[plumbing.Hash]bool{}
+		uninteresting = map[plumbing.Hash]bool{}
+		walked        []*object.Commit
+	)
+
+	// Marking a commit that has already been visited also marks its
+	// ancestors, since they may have been queued as interesting.
+	markUninteresting := func(hash plumbing.Hash) {
+		stack := []plumbing.Hash{hash}
+		for len(stack) > 0 {
+			h := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if uninteresting[h] {
+				continue
+			}
+			uninteresting[h] = true
+			if visited[h] {
+				stack = append(stack, queued[h].ParentHashes...)
+			}
+		}
+	}
+	enqueue := func(c *object.Commit) {
+		queued[c.Hash] = c
+		heap.Push(&queue, c)
+	}
+	stillInteresting := func() bool {
+		for _, c := range queue {
+			if !uninteresting[c.Hash] {
+				return true
+			}
+		}
+		return false
+	}
+
+	enqueue(head)
+	if exclude != nil {
+		markUninteresting(exclude.Hash)
+		if _, ok := queued[exclude.Hash]; !ok {
+			enqueue(exclude)
+		}
+	}
+
+	for stillInteresting() {
+		c := heap.Pop(&queue).(*object.Commit)
+		visited[c.Hash] = true
+		if !uninteresting[c.Hash] {
+			walked = append(walked, c)
+		}
+		for _, parent := range c.ParentHashes {
+			if uninteresting[c.Hash] {
+				markUninteresting(parent)
+			}
+			if _, ok := queued[parent]; ok {
+				continue
+			}
+			p, err := repo.CommitObject(parent)
+			if err == plumbing.ErrObjectNotFound {
+				// e.g., at the edge of a shallow clone
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			enqueue(p)
+		}
+	}
+
+	// Commits can be found to be uninteresting after they've been
+	// visited, if commit times are out of order
+	var result []*object.Commit
+	for _, c := range walked {
+		if !uninteresting[c.Hash] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// commitQueue is a heap of commits, newest (by commit time) first.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int            { return len(q) }
+func (q commitQueue) Less(i, j int) bool  { return q[i].Committer.When.After(q[j].Committer.When) }
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+func (b goGitBackend) moveTagAndPush(ctx context.Context, path, tag, ref, msg, signingKey, upstream string) error {
+	if signingKey != "" {
+		return b.execBackend.moveTagAndPush(ctx, path, tag, ref, msg, signingKey, upstream)
+	}
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	hash, err := resolveCommit(repo, ref)
+	if err != nil {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	tagger, err := signature(repo)
+	if err != nil {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	if err := repo.DeleteTag(tag); err != nil && err != gogit.ErrTagNotFound {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	if _, err := repo.CreateTag(tag, hash, &gogit.CreateTagOptions{Tagger: tagger, Message: msg}); err != nil {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	name := plumbing.NewTagReferenceName(tag).String()
+	if err := b.pushRefSpecs(ctx, repo, upstream, "+"+name+":"+name); err != nil {
+		return errors.Wrap(err, "pushing tag to origin")
+	}
+	return nil
+}
+
+func (b goGitBackend) changed(ctx context.Context, path, ref string, subPaths []string) ([]string, error) {
+	if err := checkPaths(subPaths); err != nil {
+		return nil, err
+	}
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	trees := make([]*object.Tree, 2)
+	for i, rev := range []string{ref, "HEAD"} {
+		hash, err := resolveCommit(repo, rev)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if trees[i], err = commit.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(trees[0], trees[1])
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]bool{}
+	for _, c := range changes {
+		// Only files that are still there count
+		if c.To.Name != "" && underPaths(c.To.Name, subPaths) {
+			files[c.To.Name] = true
+		}
+	}
+
+	// .. and then anything changed in the working tree
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range status {
+		switch {
+		case s.Worktree == gogit.Deleted || s.Staging == gogit.Deleted:
+			delete(files, name)
+		case s.Worktree == gogit.Untracked:
+		case s.Worktree != gogit.Unmodified || s.Staging != gogit.Unmodified:
+			if underPaths(name, subPaths) {
+				files[name] = true
+			}
+		}
+	}
+
+	var result []string
+	for name := range files {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (b goGitBackend) check(ctx context.Context, workingDir string, subdirs []string) bool {
+	repo, err := gogit.PlainOpen(workingDir)
+	if err != nil {
+		return true // as with git, an error counts as changes
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return true
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return true
+	}
+	for name, s := range status {
+		if s.Worktree != gogit.Unmodified && s.Worktree != gogit.Untracked && underPaths(name, subdirs) {
+			return true
+		}
+	}
+	return false
+}
+
+// ---
+
+func isNoMatchingRefs(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "couldn't find remote ref")
+}
+
+// resolveCommit finds the commit a revision (a ref, a hash, or an
+// expression like `HEAD~1`) refers to. Unlike go-git's
+// ResolveRevision, it follows annotated tags to the commit.
+func resolveCommit(repo *gogit.Repository, rev string) (plumbing.Hash, error) {
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		ref, err := storer.ResolveReference(repo.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, rev)))
+		if err != nil {
+			continue
+		}
+		if tag, err := repo.TagObject(ref.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			return commit.Hash, nil
+		}
+		return ref.Hash(), nil
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return *hash, nil
+}
+
+// signature gives the identity in the repo's config, for commits
+// and tags.
+func signature(repo *gogit.Repository) (*object.Signature, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	user := cfg.Raw.Section("user")
+	return &object.Signature{
+		Name:  user.Option("name"),
+		Email: user.Option("email"),
+		When:  time.Now(),
+	}, nil
+}
+
+// parseAuthor makes a signature from an author given as `Name
+// <email>`; if it's just a name, the committer's email is used.
+func parseAuthor(author string, committer *object.Signature) *object.Signature {
+	sig := *committer
+	sig.Name = author
+	if i, j := strings.Index(author, "<"), strings.LastIndex(author, ">"); i >= 0 && j > i {
+		sig.Name = strings.TrimSpace(author[:i])
+		sig.Email = author[i+1 : j]
+	}
+	return &sig
+}
+
+// checkPaths rejects absolute paths, as git does.
+func checkPaths(paths []string) error {
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			return fmt.Errorf("%s: '%s' is outside repository", p, p)
+		}
+	}
+	return nil
+}
+
+// underPaths says whether the file given is in one of the paths, or
+// there are no paths to be in.
+func underPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.Trim(p, "/")
+		if p == "" || p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesPaths says whether a commit changes anything in the paths
+// given. As with `git log -- <paths>`, a merge counts only if it
+// differs from every parent there; and a root commit counts if it
+// has anything there.
+func touchesPaths(c *object.Commit, paths []string) (bool, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return false, err
+	}
+	if c.NumParents() == 0 {
+		touches := false
+		err := tree.Files().ForEach(func(f *object.File) error {
+			if underPaths(f.Name, paths) {
+				touches = true
+				return storer.ErrStop
+			}
+			return nil
+		})
+		return touches, err
+	}
+
+	touches := true
+	err = c.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if underPaths(change.From.Name, paths) || underPaths(change.To.Name, paths) {
+				return nil
+			}
+		}
+		touches = false
+		return storer.ErrStop
+	})
+	return touches, err
+}
+
+// expandNotesRef gives the full name of a notes ref, as `git notes
+// --ref` would.
+func expandNotesRef(ref string) string {
+	switch {
+	case strings.HasPrefix(ref, "refs/notes/"):
+		return ref
+	case strings.HasPrefix(ref, "notes/"):
+		return "refs/" + ref
+	default:
+		return "refs/notes/" + ref
+	}
+}
+
+// notesTree gets the latest commit of the notes ref given, and its
+// tree; or nils, if there are no notes yet.
+func notesTree(repo *gogit.Repository, notesRef string) (*object.Commit, *object.Tree, error) {
+	ref, err := repo.Reference(plumbing.ReferenceName(expandNotesRef(notesRef)), true)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	return commit, tree, nil
+}
+
+// noteFile finds the note for a revision in a notes tree, which may
+// have it at the top level, or in subdirectories named for the start
+// of the revision.
+func noteFile(tree *object.Tree, rev string) (*object.File, error) {
+	for _, path := range []string{
+		rev,
+		rev[:2] + "/" + rev[2:],
+		rev[:2] + "/" + rev[2:4] + "/" + rev[4:],
+	} {
+		file, err := tree.File(path)
+		if err != object.ErrFileNotFound {
+			return file, err
+		}
+	}
+	return nil, object.ErrFileNotFound
+}
+
+// sortTreeEntries puts tree entries in the order git expects, in
+// which a directory sorts as though its name ends with a slash.
+func sortTreeEntries(entries []object.TreeEntry) {
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return key(entries[i]) < key(entries[j])
+	})
+}
+
+func storeBlob(repo *gogit.Repository, content []byte) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+func storeObject(repo *gogit.Repository, o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
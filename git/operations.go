@@ -9,6 +9,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"context"
@@ -20,13 +22,17 @@ import (
 const trace = false
 
 // Env vars that are allowed to be inherited from the os
-var allowedEnvVars = []string{"http_proxy", "https_proxy", "no_proxy", "HOME"}
+var allowedEnvVars = []string{"http_proxy", "https_proxy", "no_proxy", "HOME", "GNUPGHOME"}
 
 func config(ctx context.Context, workingDir, user, email string) error {
-	for k, v := range map[string]string{
+	return setConfig(ctx, workingDir, map[string]string{
 		"user.name":  user,
 		"user.email": email,
-	} {
+	})
+}
+
+func setConfig(ctx context.Context, workingDir string, items map[string]string) error {
+	for k, v := range items {
 		if err := execGitCmd(ctx, workingDir, nil, "config", k, v); err != nil {
 			return errors.Wrap(err, "setting git config")
 		}
@@ -34,22 +40,65 @@ func config(ctx context.Context, workingDir, user, email string) error {
 	return nil
 }
 
-func clone(ctx context.Context, workingDir, repoURL, repoBranch string) (path string, err error) {
+// sshCommand gives the command for git to use for SSH connections,
+// so that it uses the private key at the path given (and only that).
+func sshCommand(keyPath string) string {
+	return fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", keyPath)
+}
+
+// clone makes a working clone of the repo at the URL given. If any
+// sparse checkout patterns are given, only the files matching them
+// are checked out.
+func clone(ctx context.Context, workingDir, repoURL, repoBranch string, sparse []string) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone"}
 	if repoBranch != "" {
 		args = append(args, "--branch", repoBranch)
 	}
+	if len(sparse) > 0 {
+		args = append(args, "--no-checkout")
+	}
 	args = append(args, repoURL, repoPath)
 	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return "", errors.Wrap(err, "git clone")
 	}
+	if len(sparse) > 0 {
+		if err := sparseCheckout(ctx, repoPath, sparse); err != nil {
+			return "", errors.Wrap(err, "sparse checkout")
+		}
+	}
 	return repoPath, nil
 }
 
-func mirror(ctx context.Context, workingDir, repoURL string) (path string, err error) {
+// sparseCheckout populates the working tree of a clone made with
+// `--no-checkout`, with only the files matching the patterns given.
+func sparseCheckout(ctx context.Context, workingDir string, patterns []string) error {
+	if err := execGitCmd(ctx, workingDir, nil, "config", "core.sparseCheckout", "true"); err != nil {
+		return err
+	}
+	info := filepath.Join(workingDir, ".git", "info")
+	if err := os.MkdirAll(info, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(info, "sparse-checkout"), []byte(strings.Join(patterns, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return execGitCmd(ctx, workingDir, nil, "read-tree", "-mu", "HEAD")
+}
+
+// mirror makes a bare mirror of the repo at the URL given. Any config
+// items given (as "key=value") are set in the mirror, and are in
+// effect for the initial clone as well. If depth is more than zero,
+// the history of each ref is truncated to that many commits.
+func mirror(ctx context.Context, workingDir, repoURL string, depth int, configs ...string) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone", "--mirror"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	for _, c := range configs {
+		args = append(args, "--config", c)
+	}
 	args = append(args, repoURL, repoPath)
 	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return "", errors.Wrap(err, "git clone --mirror")
@@ -76,27 +125,67 @@ func checkPush(ctx context.Context, workingDir, upstream string) error {
 }
 
 func commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
-	commitAuthor := commitAction.Author
-	if commitAuthor != "" {
-		if err := execGitCmd(ctx,
-			workingDir, nil,
-			"commit",
-			"--no-verify", "-a", "--author", commitAuthor, "-m", commitAction.Message,
-		); err != nil {
-			return errors.Wrap(err, "git commit")
-		}
-		return nil
+	args := []string{"commit", "--no-verify", "-a", "-m", commitAction.Message}
+	if commitAction.Author != "" {
+		args = append(args, "--author", commitAction.Author)
+	}
+	if commitAction.SigningKey != "" {
+		args = append(args, fmt.Sprintf("--gpg-sign=%s", commitAction.SigningKey))
 	}
-	if err := execGitCmd(ctx,
-		workingDir, nil,
-		"commit",
-		"--no-verify", "-a", "-m", commitAction.Message,
-	); err != nil {
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return errors.Wrap(err, "git commit")
 	}
 	return nil
 }
 
+// rebase rebases the commits on the current branch onto the upstream
+// ref given, signing them with the key given, if it's not empty. If
+// the rebase can't be done without conflicts, it's abandoned, leaving
+// the branch as it was.
+func rebase(ctx context.Context, workingDir, upstream, signingKey string) error {
+	args := []string{"rebase"}
+	if signingKey != "" {
+		args = append(args, fmt.Sprintf("--gpg-sign=%s", signingKey))
+	}
+	args = append(args, upstream)
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
+		execGitCmd(ctx, workingDir, nil, "rebase", "--abort")
+		return errors.Wrap(err, "git rebase")
+	}
+	return nil
+}
+
+// updateSubmodules initialises and checks out the submodules of the
+// working clone, recursively, and returns their paths relative to the
+// top of the working clone. Since the working clone is cloned from a
+// local mirror, relative submodule URLs are resolved against the
+// upstream URL given instead; and the configs given (`key=value`,
+// e.g., for authentication) are passed on to the submodule clones.
+func updateSubmodules(ctx context.Context, workingDir, upstream string, configs []string) ([]string, error) {
+	args := []string{"-c", "remote.origin.url=" + upstream}
+	for _, c := range configs {
+		args = append(args, "-c", c)
+	}
+	args = append(args, "submodule", "update", "--init", "--recursive")
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
+		return nil, errors.Wrap(err, "git submodule update")
+	}
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, workingDir, out, "submodule", "--quiet", "foreach", "--recursive", "echo $displaypath"); err != nil {
+		return nil, errors.Wrap(err, "listing submodules")
+	}
+	return splitList(out.String()), nil
+}
+
+// verifyCommit checks that the commit given has a good signature,
+// from a key in the GPG keyring.
+func verifyCommit(ctx context.Context, workingDir, commit string) error {
+	if err := execGitCmd(ctx, workingDir, nil, "verify-commit", commit); err != nil {
+		return errors.Wrapf(err, "verifying signature of commit %s", commit)
+	}
+	return nil
+}
+
 // push the refs given to the upstream repo
 func push(ctx context.Context, workingDir, upstream string, refs []string) error {
 	args := append([]string{"push", upstream}, refs...)
@@ -209,6 +298,39 @@ func onelinelog(ctx context.Context, path, refspec string, subdirs []string) ([]
 	return splitLog(out.String())
 }
 
+// topoLog lists the commits in from..to, parents before children,
+// marking those that descend from `from`.
+func topoLog(ctx context.Context, path, from, to string) ([]HistoryCommit, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, path, out, "log", "--topo-order", "--reverse", "--format=%H%x09%P%x09%s", from+".."+to); err != nil {
+		return nil, err
+	}
+	fromRev, err := refRevision(ctx, path, from)
+	if err != nil {
+		return nil, err
+	}
+
+	descendants := map[string]bool{fromRev: true}
+	lines := splitList(out.String())
+	commits := make([]HistoryCommit, len(lines))
+	for i, line := range lines {
+		// the subject may be empty, and trimmed from the last line
+		fields := append(strings.SplitN(line, "\t", 3), "", "")
+		commits[i].Revision = fields[0]
+		commits[i].Message = fields[2]
+		// Parents come before children, so whether each parent
+		// descends from `from` is already known
+		for _, parent := range strings.Fields(fields[1]) {
+			if descendants[parent] {
+				descendants[fields[0]] = true
+				commits[i].OnAncestryPath = true
+				break
+			}
+		}
+	}
+	return commits, nil
+}
+
 func splitLog(s string) ([]Commit, error) {
 	lines := splitList(s)
 	commits := make([]Commit, len(lines))
@@ -229,8 +351,12 @@ func splitList(s string) []string {
 }
 
 // Move the tag to the ref given and push that tag upstream
-func moveTagAndPush(ctx context.Context, path string, tag, ref, msg, upstream string) error {
-	if err := execGitCmd(ctx, path, nil, "tag", "--force", "-a", "-m", msg, tag, ref); err != nil {
+func moveTagAndPush(ctx context.Context, path string, tag, ref, msg, signingKey, upstream string) error {
+	args := []string{"tag", "--force", "-a", "-m", msg, tag, ref}
+	if signingKey != "" {
+		args = []string{"tag", "--force", "--local-user", signingKey, "-m", msg, tag, ref}
+	}
+	if err := execGitCmd(ctx, path, nil, args...); err != nil {
 		return errors.Wrap(err, "moving tag "+tag)
 	}
 	if err := execGitCmd(ctx, path, nil, "push", "--force", upstream, "tag", tag); err != nil {
@@ -270,6 +396,10 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 		c.Dir = dir
 	}
 	c.Env = env()
+	creds := credentialsFrom(ctx)
+	if creds != nil {
+		c.Env = append(c.Env, creds.env()...)
+	}
 	c.Stdout = ioutil.Discard
 	if out != nil {
 		c.Stdout = out
@@ -281,6 +411,9 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 	if err != nil {
 		msg := findErrorMessage(errOut)
 		if msg != "" {
+			if creds != nil {
+				msg = creds.redact(msg)
+			}
 			err = errors.New(msg)
 		}
 	}
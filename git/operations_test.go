@@ -4,10 +4,19 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
 
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 )
@@ -18,6 +27,10 @@ const (
 
 var (
 	noteIdCounter = 1
+
+	// The backend under test; set FLUX_GIT_BACKEND to run these tests
+	// against a backend other than the default.
+	testBackend = newBackend(Backend(os.Getenv("FLUX_GIT_BACKEND")), "")
 )
 
 type Note struct {
@@ -42,7 +55,7 @@ func TestListNotes_2Notes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	notes, err := noteRevList(context.Background(), newDir, testNoteRef)
+	notes, err := testBackend.noteRevList(context.Background(), newDir, testNoteRef)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -53,7 +66,7 @@ func TestListNotes_2Notes(t *testing.T) {
 	}
 	for rev := range notes {
 		var note Note
-		ok, err := getNote(context.Background(), newDir, testNoteRef, rev, &note)
+		ok, err := testBackend.getNote(context.Background(), newDir, testNoteRef, rev, &note)
 		if err != nil {
 			t.Error(err)
 		}
@@ -75,7 +88,7 @@ func TestListNotes_0Notes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	notes, err := noteRevList(context.Background(), newDir, testNoteRef)
+	notes, err := testBackend.noteRevList(context.Background(), newDir, testNoteRef)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,7 +101,7 @@ func TestListNotes_0Notes(t *testing.T) {
 func testNote(dir, rev string) (string, error) {
 	id := fmt.Sprintf("%v", noteIdCounter)
 	noteIdCounter += 1
-	err := addNote(context.Background(), dir, rev, testNoteRef, &Note{ID: id})
+	err := testBackend.addNote(context.Background(), dir, rev, testNoteRef, &Note{ID: id})
 	return id, err
 }
 
@@ -103,7 +116,7 @@ func TestChangedFiles_SlashPath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = changed(context.Background(), newDir, "HEAD", []string{nestedDir})
+	_, err = testBackend.changed(context.Background(), newDir, "HEAD", []string{nestedDir})
 	if err == nil {
 		t.Fatal("Should have errored")
 	}
@@ -120,7 +133,7 @@ func TestChangedFiles_UnslashPath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = changed(context.Background(), newDir, "HEAD", []string{nestedDir})
+	_, err = testBackend.changed(context.Background(), newDir, "HEAD", []string{nestedDir})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -137,7 +150,7 @@ func TestChangedFiles_NoPath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = changed(context.Background(), newDir, "HEAD", nil)
+	_, err = testBackend.changed(context.Background(), newDir, "HEAD", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,7 +173,7 @@ func TestOnelinelog_NoGitpath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", nil)
+	commits, err := testBackend.onelinelog(context.Background(), newDir, "HEAD~2..HEAD", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -188,7 +201,7 @@ func TestOnelinelog_WithGitpath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", []string{"dev"})
+	commits, err := testBackend.onelinelog(context.Background(), newDir, "HEAD~2..HEAD", []string{"dev"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -198,6 +211,171 @@ func TestOnelinelog_WithGitpath(t *testing.T) {
 	}
 }
 
+// The go-git backend walks history itself, rather than running `git
+// log`; it should give the same commits, in the same order.
+func TestOnelinelog_BackendsAgree(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	if err := createRepo(newDir, []string{"dev", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interleave the commits on a branch with those on the main
+	// line, by commit time, then merge the branch
+	start := time.Now().Add(time.Hour)
+	commitAt := func(i int, args ...string) {
+		when := fmt.Sprintf("@%d +0000", start.Add(time.Duration(i)*time.Minute).Unix())
+		cmd := exec.Command("git", append([]string{"-C", newDir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+when, "GIT_COMMITTER_DATE="+when)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	if err := execCommand("git", "-C", newDir, "branch", "side"); err != nil {
+		t.Fatal(err)
+	}
+	commitAt(1, "commit", "--allow-empty", "-m", "main 1")
+	commitAt(3, "commit", "--allow-empty", "-m", "main 2")
+	if err := execCommand("git", "-C", newDir, "checkout", "side"); err != nil {
+		t.Fatal(err)
+	}
+	commitAt(2, "commit", "--allow-empty", "-m", "side 1")
+	commitAt(4, "commit", "--allow-empty", "-m", "side 2")
+	if err := execCommand("git", "-C", newDir, "checkout", "-"); err != nil {
+		t.Fatal(err)
+	}
+	commitAt(5, "merge", "--no-ff", "-m", "merge side", "side")
+
+	ctx := context.Background()
+	for _, refspec := range []string{"HEAD", "HEAD~1..HEAD", "side..HEAD", "HEAD..side", "HEAD~2..side", "HEAD..HEAD"} {
+		expected, err := execBackend{}.onelinelog(ctx, newDir, refspec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := goGitBackend{}.onelinelog(ctx, newDir, refspec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected %v, got %v", refspec, expected, got)
+		}
+	}
+}
+
+// The history between two revisions comes parents first, even when
+// the commit dates say otherwise; and only commits that descend from
+// the start are on the ancestry path.
+func TestTopoLog(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	if err := createRepo(newDir, []string{"dev"}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(time.Hour)
+	commitAt := func(i int, args ...string) string {
+		when := fmt.Sprintf("@%d +0000", start.Add(time.Duration(i)*time.Minute).Unix())
+		cmd := exec.Command("git", append([]string{"-C", newDir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+when, "GIT_COMMITTER_DATE="+when)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+		rev, err := refRevision(context.Background(), newDir, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+
+	from, err := refRevision(context.Background(), newDir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a branch from before `from`, merged after it
+	if err := execCommand("git", "-C", newDir, "checkout", "-b", "side", "HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	side := commitAt(1, "commit", "--allow-empty", "-m", "side")
+	if err := execCommand("git", "-C", newDir, "checkout", "-"); err != nil {
+		t.Fatal(err)
+	}
+	// a child dated before its parent
+	parent := commitAt(10, "commit", "--allow-empty", "-m", "parent")
+	child := commitAt(5, "commit", "--allow-empty", "-m", "child")
+	merge := commitAt(20, "merge", "--no-ff", "-m", "merge side", "side")
+
+	commits, err := testBackend.topoLog(context.Background(), newDir, from, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := map[string]int{}
+	onPath := map[string]bool{}
+	for i, c := range commits {
+		index[c.Revision] = i
+		onPath[c.Revision] = c.OnAncestryPath
+	}
+	if len(commits) != 4 {
+		t.Fatalf("expected 4 commits, got %v", commits)
+	}
+	if !(index[parent] < index[child] && index[child] < index[merge] && index[side] < index[merge]) {
+		t.Errorf("expected parents before children, got %v", commits)
+	}
+	expected := map[string]bool{side: false, parent: true, child: true, merge: true}
+	if !reflect.DeepEqual(expected, onPath) {
+		t.Errorf("expected ancestry path %v, got %v", expected, onPath)
+	}
+}
+
+// Pushes without a packfile can only delete refs
+func TestLocalTransport_DeleteOnly(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(dir, []string{"dev"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	head, err := refRevision(ctx, dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"deleted", "kept"} {
+		if err := execCommand("git", "-C", dir, "tag", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ep, err := transport.NewEndpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := localTransport{server.NewServer(localLoader{})}.NewReceivePackSession(ep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := packp.NewReferenceUpdateRequest()
+	req.Commands = []*packp.Command{
+		{Name: plumbing.NewTagReferenceName("deleted"), Old: plumbing.NewHash(head), New: plumbing.ZeroHash},
+		{Name: plumbing.NewTagReferenceName("kept"), Old: plumbing.NewHash(head), New: plumbing.NewHash(strings.Repeat("1", 40))},
+	}
+	status, err := session.ReceivePack(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := status.CommandStatuses[0].Status; s != "ok" {
+		t.Errorf("expected the delete to succeed, got %q", s)
+	}
+	if s := status.CommandStatuses[1].Status; s == "ok" {
+		t.Error("expected the update without a packfile to be rejected")
+	}
+	if ok, _ := refExists(ctx, dir, "refs/tags/deleted"); ok {
+		t.Error("expected the deleted tag to be gone")
+	}
+	if rev, _ := refRevision(ctx, dir, "kept"); rev != head {
+		t.Errorf("expected the kept tag to be unchanged at %s, got %s", head, rev)
+	}
+}
+
 func TestCheckPush(t *testing.T) {
 	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
 	defer upstreamCleanup()
@@ -208,14 +386,57 @@ func TestCheckPush(t *testing.T) {
 	cloneDir, cloneCleanup := testfiles.TempDir(t)
 	defer cloneCleanup()
 
-	working, err := clone(context.Background(), cloneDir, upstreamDir, "master")
+	working, err := testBackend.clone(context.Background(), cloneDir, upstreamDir, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testBackend.checkPush(context.Background(), working, upstreamDir)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = checkPush(context.Background(), working, upstreamDir)
+}
+
+func TestClone_Sparse(t *testing.T) {
+	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
+	defer upstreamCleanup()
+	if err := createRepo(upstreamDir, []string{"dev", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cloneDir, cloneCleanup := testfiles.TempDir(t)
+	defer cloneCleanup()
+
+	// Sparse checkouts are done only by running git
+	working, err := clone(context.Background(), cloneDir, upstreamDir, "master", sparsePatterns([]string{"dev"}))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if _, err := os.Stat(filepath.Join(working, "dev")); err != nil {
+		t.Errorf("expected dev/ to be checked out: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(working, "prod")); !os.IsNotExist(err) {
+		t.Errorf("expected prod/ not to be checked out, got %v", err)
+	}
+}
+
+func TestSparsePatterns(t *testing.T) {
+	for _, c := range []struct {
+		paths    []string
+		patterns []string
+	}{
+		{nil, nil},
+		{[]string{"."}, nil},
+		{[]string{"dev", ""}, nil},
+		{[]string{"dev"}, []string{"/dev", "/.flux.yaml"}},
+		{[]string{"clusters/dev/", "clusters/prod"}, []string{
+			"/clusters/dev", "/clusters/.flux.yaml", "/.flux.yaml", "/clusters/prod",
+		}},
+	} {
+		patterns := sparsePatterns(c.paths)
+		if !reflect.DeepEqual(patterns, c.patterns) {
+			t.Errorf("paths %v: expected patterns %v, got %v", c.paths, c.patterns, patterns)
+		}
+	}
 }
 
 // ---
@@ -229,7 +450,7 @@ func createRepo(dir string, subdirs []string) error {
 	if err = execCommand("git", "-C", dir, "init"); err != nil {
 		return err
 	}
-	if err := config(context.Background(), dir, "operations_test_user", "example@example.com"); err != nil {
+	if err := testBackend.config(context.Background(), dir, "operations_test_user", "example@example.com"); err != nil {
 		return err
 	}
 
@@ -51,10 +51,17 @@ type Remote struct {
 
 type Repo struct {
 	// As supplied to constructor
-	origin   Remote
-	interval time.Duration
-	timeout  time.Duration
-	readonly bool
+	origin      Remote
+	interval    time.Duration
+	timeout     time.Duration
+	readonly    bool
+	sshKey      string
+	credentials *HTTPCredentials
+	backendName Backend
+	depth       int
+
+	// Constructed from the above
+	backend backend
 
 	// State
 	mu     sync.RWMutex
@@ -88,6 +95,24 @@ func (t Timeout) apply(r *Repo) {
 	r.timeout = time.Duration(t)
 }
 
+// SSHKey is the path to a private key to use when connecting to the
+// origin over SSH, rather than whichever key SSH would otherwise use.
+type SSHKey string
+
+func (k SSHKey) apply(r *Repo) {
+	r.sshKey = string(k)
+}
+
+// MirrorDepth limits the history fetched into the mirror to the
+// given number of commits from the tip of each ref, as with `git
+// clone --depth`; commits pushed later are fetched as usual. Zero
+// means no limit.
+type MirrorDepth int
+
+func (d MirrorDepth) apply(r *Repo) {
+	r.depth = int(d)
+}
+
 var ReadOnly optionFunc = func(r *Repo) {
 	r.readonly = true
 }
@@ -110,6 +135,7 @@ func NewRepo(origin Remote, opts ...Option) *Repo {
 	for _, opt := range opts {
 		opt.apply(r)
 	}
+	r.backend = newBackend(r.backendName, r.sshKey)
 	return r
 }
 
@@ -120,6 +146,12 @@ func (r *Repo) Origin() Remote {
 	return r.origin
 }
 
+// IsReadOnly says whether the repo was constructed as read-only, in
+// which case nothing will be pushed to it.
+func (r *Repo) IsReadOnly() bool {
+	return r.readonly
+}
+
 // Dir returns the local directory into which the repo has been
 // cloned, if it has been cloned.
 func (r *Repo) Dir() string {
@@ -202,7 +234,7 @@ func (r *Repo) Revision(ctx context.Context, ref string) (string, error) {
 	if err := r.errorIfNotReady(); err != nil {
 		return "", err
 	}
-	return refRevision(ctx, r.dir, ref)
+	return r.backend.refRevision(ctx, r.dir, ref)
 }
 
 func (r *Repo) CommitsBefore(ctx context.Context, ref string, paths ...string) ([]Commit, error) {
@@ -211,7 +243,7 @@ func (r *Repo) CommitsBefore(ctx context.Context, ref string, paths ...string) (
 	if err := r.errorIfNotReady(); err != nil {
 		return nil, err
 	}
-	return onelinelog(ctx, r.dir, ref, paths)
+	return r.backend.onelinelog(ctx, r.dir, ref, paths)
 }
 
 func (r *Repo) CommitsBetween(ctx context.Context, ref1, ref2 string, paths ...string) ([]Commit, error) {
@@ -220,7 +252,19 @@ func (r *Repo) CommitsBetween(ctx context.Context, ref1, ref2 string, paths ...s
 	if err := r.errorIfNotReady(); err != nil {
 		return nil, err
 	}
-	return onelinelog(ctx, r.dir, ref1+".."+ref2, paths)
+	return r.backend.onelinelog(ctx, r.dir, ref1+".."+ref2, paths)
+}
+
+// History gives the commits after ref1, up to and including ref2, in
+// topological order: each commit comes after its parents, whatever
+// their dates. Each is marked with whether it descends from ref1.
+func (r *Repo) History(ctx context.Context, ref1, ref2 string) ([]HistoryCommit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.errorIfNotReady(); err != nil {
+		return nil, err
+	}
+	return r.backend.topoLog(ctx, r.dir, ref1, ref2)
 }
 
 // step attempts to advance the repo state machine, and returns `true`
@@ -245,8 +289,8 @@ func (r *Repo) step(bg context.Context) bool {
 			panic(err)
 		}
 
-		ctx, cancel := context.WithTimeout(bg, r.timeout)
-		dir, err = mirror(ctx, rootdir, url)
+		ctx, cancel := context.WithTimeout(withCredentials(bg, r.credentials), r.timeout)
+		dir, err = r.backend.mirror(ctx, rootdir, url, r.depth, r.mirrorConfig()...)
 		cancel()
 		if err == nil {
 			r.mu.Lock()
@@ -267,8 +311,8 @@ func (r *Repo) step(bg context.Context) bool {
 
 	case RepoCloned:
 		if !r.readonly {
-			ctx, cancel := context.WithTimeout(bg, r.timeout)
-			err := checkPush(ctx, dir, url)
+			ctx, cancel := context.WithTimeout(withCredentials(bg, r.credentials), r.timeout)
+			err := r.backend.checkPush(ctx, dir, url)
 			cancel()
 			if err != nil {
 				r.setUnready(RepoCloned, err)
@@ -289,6 +333,19 @@ func (r *Repo) step(bg context.Context) bool {
 	return false
 }
 
+// mirrorConfig gives the git config to set in the mirror, given the
+// options.
+func (r *Repo) mirrorConfig() []string {
+	var configs []string
+	if r.sshKey != "" {
+		configs = append(configs, "core.sshCommand="+sshCommand(r.sshKey))
+	}
+	if r.credentials != nil {
+		configs = append(configs, "credential.helper="+credentialHelper)
+	}
+	return configs
+}
+
 // Ready tries to advance the cloning process along as far as
 // possible, and returns an error if it is not able to get to a ready
 // state.
@@ -384,7 +441,7 @@ func (r *Repo) refreshLoop(shutdown <-chan struct{}) error {
 
 // fetch gets updated refs, and associated objects, from the upstream.
 func (r *Repo) fetch(ctx context.Context) error {
-	if err := fetch(ctx, r.dir, "origin"); err != nil {
+	if err := r.backend.fetch(withCredentials(ctx, r.credentials), r.dir, "origin"); err != nil {
 		return err
 	}
 	return nil
@@ -392,7 +449,7 @@ func (r *Repo) fetch(ctx context.Context) error {
 
 // workingClone makes a non-bare clone, at `ref` (probably a branch),
 // and returns the filesystem path to it.
-func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
+func (r *Repo) workingClone(ctx context.Context, ref string, sparse []string) (string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
@@ -402,5 +459,5 @@ func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return clone(ctx, working, r.dir, ref)
+	return r.backend.clone(ctx, working, r.dir, ref, sparse)
 }
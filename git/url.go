@@ -0,0 +1,34 @@
+package git
+
+import (
+	"strings"
+)
+
+// RepoHostAndPath gives the host and the path (e.g., org/repo) of a
+// repo, from its git URL, which may be scp-like
+// (git@host:org/repo.git) or a URL (https://host/org/repo.git,
+// ssh://git@host:22/org/repo). Any user and port are dropped, as is a
+// trailing `.git`, and the host is lower-cased; so the various URLs
+// for a repo give the same result. Either may be empty, if the URL
+// has no such part (e.g., a path in the local filesystem has no host).
+func RepoHostAndPath(repoURL string) (host, path string) {
+	u := strings.TrimSpace(repoURL)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else if i := strings.Index(u, ":"); i >= 0 {
+		// scp-like, e.g., git@github.com:org/repo
+		u = u[:i] + "/" + strings.TrimPrefix(u[i+1:], "/")
+	}
+	host = u
+	if i := strings.Index(u, "/"); i >= 0 {
+		host, path = u[:i], u[i+1:]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host), path
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"errors"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 var (
-	ErrReadOnly = errors.New("cannot make a working clone of a read-only git repo")
+	ErrReadOnly = errors.New("cannot push to a read-only git repo")
 )
 
+// The name of the files that configure manifest generation; these
+// are looked for in the directories above each path as well, so
+// must be included in sparse checkouts (see
+// cluster/kubernetes.GeneratorConfigFile).
+const generatorConfigFile = ".flux.yaml"
+
 // Config holds some values we use when working in the working clone of
 // a repo.
 type Config struct {
@@ -22,6 +30,23 @@ type Config struct {
 	UserEmail   string
 	SetAuthor   bool
 	SkipMessage string
+	// If not empty, commits and sync tags are signed with this GPG
+	// key
+	SigningKey string
+	// Check that commits are signed by a key in the GPG keyring
+	// before syncing them
+	VerifySignatures bool
+	// Check out only the files under Paths (and any generator config
+	// files above them) in working clones
+	SparseCheckout bool
+	// How many times to try pushing a commit, rebasing it on
+	// whatever has been pushed upstream in the meantime between
+	// attempts; zero means just the once
+	PushAttempts int
+	// Initialise any submodules in working clones. The files in
+	// submodules are read, but not changed, since changes can't be
+	// committed to the repo itself
+	Submodules bool
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -32,6 +57,13 @@ type Checkout struct {
 	config       Config
 	upstream     Remote
 	realNotesRef string // cache the notes ref, since we use it to push as well
+	readonly     bool
+	credentials  *HTTPCredentials
+	backend      backend
+	pushAttempts int // how many times the last commit was pushed
+	// config for authenticating submodule clones (`key=value`)
+	submoduleConfig []string
+	submodules      []string // paths of the submodules checked out
 }
 
 type Commit struct {
@@ -39,52 +71,118 @@ type Commit struct {
 	Message  string
 }
 
+// HistoryCommit is a commit in the history between two revisions, as
+// given by Repo.History.
+type HistoryCommit struct {
+	Commit
+	// Whether the commit descends from the start of the range (as
+	// well as being an ancestor of the end)
+	OnAncestryPath bool
+}
+
 // CommitAction - struct holding commit information
 type CommitAction struct {
-	Author  string
-	Message string
+	Author     string
+	Message    string
+	SigningKey string
 }
 
 // Clone returns a local working clone of the sync'ed `*Repo`, using
-// the config given.
+// the config given. If the repo is read-only, so is the clone: it can
+// be examined, but not pushed from.
 func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
-	if r.readonly {
-		return nil, ErrReadOnly
-	}
-
 	upstream := r.Origin()
-	repoDir, err := r.workingClone(ctx, conf.Branch)
+	var sparse []string
+	if conf.SparseCheckout {
+		sparse = sparsePatterns(conf.Paths)
+	}
+	repoDir, err := r.workingClone(ctx, conf.Branch, sparse)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := config(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
+	if err := r.backend.config(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
 		os.RemoveAll(repoDir)
 		return nil, err
 	}
+	// The working clone is cloned from the mirror, so doesn't get its
+	// config; but it does push to the origin, so needs the key.
+	if r.sshKey != "" {
+		if err := r.backend.setConfig(ctx, repoDir, map[string]string{"core.sshCommand": sshCommand(r.sshKey)}); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	}
+	if r.credentials != nil {
+		if err := r.backend.setConfig(ctx, repoDir, map[string]string{"credential.helper": credentialHelper}); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	}
 
 	// We'll need the notes ref for pushing it, so make sure we have
 	// it. This assumes we're syncing it (otherwise we'll likely get conflicts)
-	realNotesRef, err := getNotesRef(ctx, repoDir, conf.NotesRef)
+	realNotesRef, err := r.backend.getNotesRef(ctx, repoDir, conf.NotesRef)
 	if err != nil {
 		os.RemoveAll(repoDir)
 		return nil, err
 	}
 
 	r.mu.RLock()
-	if err := fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
+	if err := r.backend.fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
 	}
 	r.mu.RUnlock()
 
-	return &Checkout{
-		dir:          repoDir,
-		upstream:     upstream,
-		realNotesRef: realNotesRef,
-		config:       conf,
-	}, nil
+	co := &Checkout{
+		dir:             repoDir,
+		upstream:        upstream,
+		realNotesRef:    realNotesRef,
+		config:          conf,
+		readonly:        r.readonly,
+		credentials:     r.credentials,
+		backend:         r.backend,
+		submoduleConfig: r.mirrorConfig(),
+	}
+	if err := co.updateSubmodules(ctx); err != nil {
+		os.RemoveAll(repoDir)
+		return nil, err
+	}
+	return co, nil
+}
+
+// sparsePatterns gives the sparse checkout patterns that include the
+// paths given, and the generator config files (.flux.yaml) that may
+// apply to them, which can be in any directory above a path. If any
+// path is the top of the repo, there are no patterns, since the
+// whole repo is needed.
+func sparsePatterns(paths []string) []string {
+	var patterns []string
+	seen := map[string]bool{}
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if p == "." || p == "/" {
+			return nil
+		}
+		p = strings.Trim(p, "/")
+		add("/" + p)
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			if dir == "." {
+				add("/" + generatorConfigFile)
+				break
+			}
+			add("/" + dir + "/" + generatorConfigFile)
+		}
+	}
+	return patterns
 }
 
 // Clean a Checkout up (remove the clone)
@@ -115,62 +213,252 @@ func (c *Checkout) ManifestDirs() []string {
 }
 
 // CommitAndPush commits changes made in this checkout, along with any
-// extra data as a note, and pushes the commit and note to the remote repo.
+// extra data as a note, and pushes the commit and note to the remote
+// repo. If the push fails because there are new commits upstream, the
+// commit is rebased onto them and pushed again, up to
+// Config.PushAttempts times in all.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}) error {
-	if !check(ctx, c.dir, c.config.Paths) {
+	c.pushAttempts = 0
+	if err := c.commit(ctx, commitAction, note); err != nil {
+		return err
+	}
+	signingKey := commitAction.SigningKey
+	if signingKey == "" {
+		signingKey = c.config.SigningKey
+	}
+
+	for {
+		c.pushAttempts++
+		err := c.pushWithNotes(ctx, c.config.Branch)
+		if err == nil || c.pushAttempts >= c.config.PushAttempts {
+			return err
+		}
+		rebased, rebaseErr := c.rebase(ctx, signingKey, note)
+		if rebaseErr != nil {
+			return rebaseErr
+		}
+		if !rebased {
+			// Nothing new upstream, so the push failed for some
+			// other reason, and won't do any better next time
+			return err
+		}
+	}
+}
+
+// PushAttempts returns how many times CommitAndPush tried to push its
+// commit, the last time it was called.
+func (c *Checkout) PushAttempts() int {
+	return c.pushAttempts
+}
+
+// rebase fetches the branch from the upstream repo and, if it has
+// moved on since the commit just made, rebases the commit onto it and
+// adds the note to the rebased commit. It returns false if the branch
+// had not moved on.
+func (c *Checkout) rebase(ctx context.Context, signingKey string, note interface{}) (bool, error) {
+	parent, err := c.backend.refRevision(ctx, c.dir, "HEAD^")
+	if err != nil {
+		return false, err
+	}
+	upstreamBranch := "refs/remotes/origin/" + c.config.Branch
+	credsCtx := withCredentials(ctx, c.credentials)
+	if err := c.backend.fetch(credsCtx, c.dir, c.upstream.URL, "+refs/heads/"+c.config.Branch+":"+upstreamBranch); err != nil {
+		return false, err
+	}
+	head, err := c.backend.refRevision(ctx, c.dir, upstreamBranch)
+	if err != nil {
+		return false, err
+	}
+	if head == parent {
+		return false, nil
+	}
+
+	// Replace the notes with those upstream, which will have any
+	// added to the new commits; the note for the commit being
+	// rebased is added again afterwards.
+	if err := c.backend.fetch(credsCtx, c.dir, c.upstream.URL, "+"+c.realNotesRef+":"+c.realNotesRef); err != nil {
+		return false, err
+	}
+	if err := c.backend.rebase(ctx, c.dir, upstreamBranch, signingKey); err != nil {
+		return false, RebaseError(c.upstream.URL, err)
+	}
+	if note != nil {
+		rev, err := c.backend.refRevision(ctx, c.dir, "HEAD")
+		if err != nil {
+			return false, err
+		}
+		if err := c.backend.addNote(ctx, c.dir, rev, c.config.NotesRef, note); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// CommitAndPushBranch commits changes made in this checkout, along
+// with any extra data as a note, as CommitAndPush does; but pushes the
+// commit to the branch given, rather than to the branch being synced,
+// replacing whatever was there. If the branch already has the same
+// changes to the files under the configured paths, it's left as it
+// is. It returns the revision at the head of the branch.
+func (c *Checkout) CommitAndPushBranch(ctx context.Context, branch string, commitAction CommitAction, note interface{}) (string, error) {
+	if err := c.commit(ctx, commitAction, note); err != nil {
+		return "", err
+	}
+	// The branches in the upstream are those in the mirror this was
+	// cloned from, so may be a little out of date; at worst, the
+	// branch is pushed again.
+	upstreamBranch := "refs/remotes/origin/" + branch
+	ok, err := c.backend.refExists(ctx, c.dir, upstreamBranch)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		changed, err := c.backend.changed(ctx, c.dir, upstreamBranch, c.config.Paths)
+		if err != nil {
+			return "", err
+		}
+		if len(changed) == 0 {
+			return c.backend.refRevision(ctx, c.dir, upstreamBranch)
+		}
+	}
+	if err := c.pushWithNotes(ctx, "+refs/heads/"+c.config.Branch+":refs/heads/"+branch); err != nil {
+		return "", err
+	}
+	return c.HeadRevision(ctx)
+}
+
+// commit commits the changes made in this checkout, and adds the note
+// given (if not nil) to the commit.
+func (c *Checkout) commit(ctx context.Context, commitAction CommitAction, note interface{}) error {
+	if c.readonly {
+		return ErrReadOnly
+	}
+	if !c.backend.check(ctx, c.dir, c.config.Paths) {
 		return ErrNoChanges
 	}
 
 	commitAction.Message += c.config.SkipMessage
+	if commitAction.SigningKey == "" {
+		commitAction.SigningKey = c.config.SigningKey
+	}
 
-	if err := commit(ctx, c.dir, commitAction); err != nil {
+	if err := c.backend.commit(ctx, c.dir, commitAction); err != nil {
 		return err
 	}
 
 	if note != nil {
-		rev, err := refRevision(ctx, c.dir, "HEAD")
+		rev, err := c.backend.refRevision(ctx, c.dir, "HEAD")
 		if err != nil {
 			return err
 		}
-		if err := addNote(ctx, c.dir, rev, c.config.NotesRef, note); err != nil {
+		if err := c.backend.addNote(ctx, c.dir, rev, c.config.NotesRef, note); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	refs := []string{c.config.Branch}
-	ok, err := refExists(ctx, c.dir, c.realNotesRef)
+// pushWithNotes pushes the ref (or refspec) given to the upstream
+// repo, along with the notes, if there are any.
+func (c *Checkout) pushWithNotes(ctx context.Context, ref string) error {
+	refs := []string{ref}
+	ok, err := c.backend.refExists(ctx, c.dir, c.realNotesRef)
 	if ok {
 		refs = append(refs, c.realNotesRef)
 	} else if err != nil {
 		return err
 	}
 
-	if err := push(ctx, c.dir, c.upstream.URL, refs); err != nil {
+	if err := c.backend.push(withCredentials(ctx, c.credentials), c.dir, c.upstream.URL, refs); err != nil {
 		return PushError(c.upstream.URL, err)
 	}
 	return nil
 }
 
+// Origin returns the Remote the checkout pushes to.
+func (c *Checkout) Origin() Remote {
+	return c.upstream
+}
+
+// Branch returns the branch being synced, from which the checkout
+// was made.
+func (c *Checkout) Branch() string {
+	return c.config.Branch
+}
+
 // GetNote gets a note for the revision specified, or nil if there is no such note.
 func (c *Checkout) GetNote(ctx context.Context, rev string, note interface{}) (bool, error) {
-	return getNote(ctx, c.dir, c.realNotesRef, rev, note)
+	return c.backend.getNote(ctx, c.dir, c.realNotesRef, rev, note)
 }
 
 func (c *Checkout) HeadRevision(ctx context.Context) (string, error) {
-	return refRevision(ctx, c.dir, "HEAD")
+	return c.backend.refRevision(ctx, c.dir, "HEAD")
 }
 
 func (c *Checkout) SyncRevision(ctx context.Context) (string, error) {
-	return refRevision(ctx, c.dir, c.config.SyncTag)
+	return c.backend.refRevision(ctx, c.dir, c.config.SyncTag)
 }
 
 func (c *Checkout) MoveSyncTagAndPush(ctx context.Context, ref, msg string) error {
-	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, ref, msg, c.upstream.URL)
+	if c.readonly {
+		return ErrReadOnly
+	}
+	return c.backend.moveTagAndPush(withCredentials(ctx, c.credentials), c.dir, c.config.SyncTag, ref, msg, c.config.SigningKey, c.upstream.URL)
+}
+
+// VerifyCommit checks that the commit given is signed, by a key in
+// the GPG keyring.
+func (c *Checkout) VerifyCommit(ctx context.Context, rev string) error {
+	return c.backend.verifyCommit(ctx, c.dir, rev)
+}
+
+// Checkout checks out the revision given, e.g., to sync up to a
+// revision other than the head of the branch.
+func (c *Checkout) Checkout(ctx context.Context, rev string) error {
+	if err := c.backend.checkout(ctx, c.dir, rev); err != nil {
+		return err
+	}
+	return c.updateSubmodules(ctx)
+}
+
+// updateSubmodules checks out the submodules at the revisions
+// recorded in the current commit, if the config asks for submodules.
+func (c *Checkout) updateSubmodules(ctx context.Context) error {
+	if !c.config.Submodules {
+		return nil
+	}
+	paths, err := c.backend.updateSubmodules(withCredentials(ctx, c.credentials), c.dir, c.upstream.URL, c.submoduleConfig)
+	if err != nil {
+		return err
+	}
+	c.submodules = paths
+	return nil
+}
+
+// Submodules returns the paths, relative to the top of the repo, of
+// the submodules checked out. There are none unless the config asks
+// for submodules.
+func (c *Checkout) Submodules() []string {
+	return c.submodules
+}
+
+// InSubmodule says whether the path given, relative to the top of
+// the repo, is within a submodule, so its files cannot be changed
+// by committing to the repo.
+func (c *Checkout) InSubmodule(path string) bool {
+	path = filepath.Clean(path)
+	for _, sub := range c.submodules {
+		sub = filepath.Clean(sub)
+		if path == sub || strings.HasPrefix(path, sub+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
 
 // ChangedFiles does a git diff listing changed files
 func (c *Checkout) ChangedFiles(ctx context.Context, ref string) ([]string, error) {
-	list, err := changed(ctx, c.dir, ref, c.config.Paths)
+	list, err := c.backend.changed(ctx, c.dir, ref, c.config.Paths)
 	if err == nil {
 		for i, file := range list {
 			list[i] = filepath.Join(c.dir, file)
@@ -180,5 +468,5 @@ func (c *Checkout) ChangedFiles(ctx context.Context, ref string) ([]string, erro
 }
 
 func (c *Checkout) NoteRevList(ctx context.Context) (map[string]struct{}, error) {
-	return noteRevList(ctx, c.dir, c.realNotesRef)
+	return c.backend.noteRevList(ctx, c.dir, c.realNotesRef)
 }
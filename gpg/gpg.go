@@ -0,0 +1,63 @@
+// Package gpg imports the keys fluxd uses to sign commits, and to
+// verify the signatures on commits, into its GPG keyring.
+package gpg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ImportKeys imports the key(s) in the file given into the default
+// GPG keyring or, if given a directory, the keys in each file in it
+// (e.g., a mounted Kubernetes secret). It returns the paths of the
+// files imported.
+func ImportKeys(src string) ([]string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if err := importKey(src); err != nil {
+			return nil, err
+		}
+		return []string{src}, nil
+	}
+
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+	var imported []string
+	for _, f := range infos {
+		// Mounted secrets have hidden entries (e.g., `..data`)
+		// pointing at the real files; skip those.
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(src, f.Name())
+		// The entries may be symlinks, so look at what they point to
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		if err := importKey(path); err != nil {
+			return imported, err
+		}
+		imported = append(imported, path)
+	}
+	return imported, nil
+}
+
+func importKey(path string) error {
+	errOut := &bytes.Buffer{}
+	cmd := exec.Command("gpg", "--batch", "--import", path)
+	cmd.Stderr = errOut
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("importing GPG key from %s: %s: %s", path, err, strings.TrimSpace(errOut.String()))
+	}
+	return nil
+}
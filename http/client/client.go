@@ -15,7 +15,9 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/cluster"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/event"
 	transport "github.com/weaveworks/flux/http"
@@ -93,6 +95,18 @@ func (c *Client) SyncStatus(ctx context.Context, ref string) ([]string, error) {
 	return res, err
 }
 
+func (c *Client) SyncDryRun(ctx context.Context) ([]cluster.ResourceChange, error) {
+	var res []cluster.ResourceChange
+	err := c.Get(ctx, &res, transport.SyncDryRun)
+	return res, err
+}
+
+func (c *Client) ListResources(ctx context.Context, namespace string) ([]v12.ResourceStatus, error) {
+	var res []v12.ResourceStatus
+	err := c.Get(ctx, &res, transport.ListResources, "namespace", namespace)
+	return res, err
+}
+
 func (c *Client) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID, error) {
 	var res job.ID
 	err := c.methodWithResp(ctx, "POST", &res, transport.UpdateManifests, spec)
@@ -55,6 +55,8 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.UpdateManifests).HandlerFunc(handle.UpdateManifests)
 	r.Get(transport.JobStatus).HandlerFunc(handle.JobStatus)
 	r.Get(transport.SyncStatus).HandlerFunc(handle.SyncStatus)
+	r.Get(transport.SyncDryRun).HandlerFunc(handle.SyncDryRun)
+	r.Get(transport.ListResources).HandlerFunc(handle.ListResources)
 	r.Get(transport.Export).HandlerFunc(handle.Export)
 	r.Get(transport.GitRepoConfig).HandlerFunc(handle.GitRepoConfig)
 
@@ -95,6 +97,25 @@ func (s HTTPServer) SyncStatus(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, commits)
 }
 
+func (s HTTPServer) SyncDryRun(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.server.SyncDryRun(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, changes)
+}
+
+func (s HTTPServer) ListResources(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	res, err := s.server.ListResources(r.Context(), namespace)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
+
 func (s HTTPServer) ListImagesWithOptions(w http.ResponseWriter, r *http.Request) {
 	var opts v10.ListImagesOptions
 	queryValues := r.URL.Query()
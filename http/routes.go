@@ -8,6 +8,8 @@ const (
 	UpdateManifests         = "UpdateManifests"
 	JobStatus               = "JobStatus"
 	SyncStatus              = "SyncStatus"
+	SyncDryRun              = "SyncDryRun"
+	ListResources           = "ListResources"
 	Export                  = "Export"
 	GitRepoConfig           = "GitRepoConfig"
 
@@ -24,5 +26,6 @@ var (
 	RegisterDaemonV9  = "RegisterDaemonV9"
 	RegisterDaemonV10 = "RegisterDaemonV10"
 	RegisterDaemonV11 = "RegisterDaemonV11"
+	RegisterDaemonV12 = "RegisterDaemonV12"
 	LogEvent          = "LogEvent"
 )
@@ -37,6 +37,8 @@ func NewAPIRouter() *mux.Router {
 	r.NewRoute().Name(UpdateManifests).Methods("POST").Path("/v9/update-manifests")
 	r.NewRoute().Name(JobStatus).Methods("GET").Path("/v6/jobs").Queries("id", "{id}")
 	r.NewRoute().Name(SyncStatus).Methods("GET").Path("/v6/sync").Queries("ref", "{ref}")
+	r.NewRoute().Name(SyncDryRun).Methods("GET").Path("/v12/sync/dry-run")
+	r.NewRoute().Name(ListResources).Methods("GET").Path("/v12/resources")
 	r.NewRoute().Name(Export).Methods("HEAD", "GET").Path("/v6/export")
 	r.NewRoute().Name(GitRepoConfig).Methods("POST").Path("/v9/git-repo-config")
 
@@ -57,6 +59,7 @@ func UpstreamRoutes(r *mux.Router) {
 	r.NewRoute().Name(RegisterDaemonV9).Methods("GET").Path("/v9/daemon")
 	r.NewRoute().Name(RegisterDaemonV10).Methods("GET").Path("/v10/daemon")
 	r.NewRoute().Name(RegisterDaemonV11).Methods("GET").Path("/v11/daemon")
+	r.NewRoute().Name(RegisterDaemonV12).Methods("GET").Path("/v12/daemon")
 	r.NewRoute().Name(LogEvent).Methods("POST").Path("/v6/events")
 }
 
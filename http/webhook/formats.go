@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GitHub (and hosts sending the same payloads, e.g., Gitea) sign the
+// payload with the secret, in X-Hub-Signature-256 or, from older
+// versions, X-Hub-Signature.
+func parseGitHub(r *http.Request, body, secret []byte) (*push, error) {
+	signature := r.Header.Get("X-Hub-Signature-256")
+	if signature == "" {
+		signature = r.Header.Get("X-Hub-Signature")
+	}
+	if err := checkSignature(signature, body, secret); err != nil {
+		return nil, err
+	}
+	if r.Header.Get("X-GitHub-Event") != "push" {
+		return nil, nil
+	}
+
+	var payload struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+			SSHURL   string `json:"ssh_url"`
+			GitURL   string `json:"git_url"`
+			HTMLURL  string `json:"html_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	repo := payload.Repository
+	return &push{
+		URLs:     []string{repo.CloneURL, repo.SSHURL, repo.GitURL, repo.HTMLURL},
+		Branches: []string{branchFromRef(payload.Ref)},
+	}, nil
+}
+
+// GitLab sends the secret token as-is, in X-Gitlab-Token.
+func parseGitLab(r *http.Request, body, secret []byte) (*push, error) {
+	if err := checkToken(r.Header.Get("X-Gitlab-Token"), secret); err != nil {
+		return nil, err
+	}
+	if r.Header.Get("X-Gitlab-Event") != "Push Hook" {
+		return nil, nil
+	}
+
+	var payload struct {
+		Ref     string `json:"ref"`
+		Project struct {
+			GitSSHURL  string `json:"git_ssh_url"`
+			GitHTTPURL string `json:"git_http_url"`
+			WebURL     string `json:"web_url"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	project := payload.Project
+	return &push{
+		URLs:     []string{project.GitSSHURL, project.GitHTTPURL, project.WebURL},
+		Branches: []string{branchFromRef(payload.Ref)},
+	}, nil
+}
+
+// Bitbucket Cloud signs the payload with the secret, in
+// X-Hub-Signature. A single push can update several branches.
+func parseBitbucket(r *http.Request, body, secret []byte) (*push, error) {
+	if err := checkSignature(r.Header.Get("X-Hub-Signature"), body, secret); err != nil {
+		return nil, err
+	}
+	if r.Header.Get("X-Event-Key") != "repo:push" {
+		return nil, nil
+	}
+
+	var payload struct {
+		Repository struct {
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"repository"`
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	p := &push{URLs: []string{payload.Repository.Links.HTML.Href}}
+	for _, change := range payload.Push.Changes {
+		// `new` is null when a branch is deleted
+		if change.New != nil && change.New.Type == "branch" {
+			p.Branches = append(p.Branches, change.New.Name)
+		}
+	}
+	return p, nil
+}
+
+// The generic format is for anything that can make an HTTP request,
+// e.g., a CI job or a server-side git hook. It expects the secret as
+// a bearer token, and a payload like
+//
+//	{"url": "git@example.com:org/repo", "branch": "master"}
+func parseGeneric(r *http.Request, body, secret []byte) (*push, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := checkToken(token, secret); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		URL    string `json:"url"`
+		Branch string `json:"branch"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	return &push{
+		URLs:     []string{payload.URL},
+		Branches: []string{payload.Branch},
+	}, nil
+}
@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// registryParseFunc checks that a request is authentic, using the
+// secret, and parses the images pushed from its body; or returns
+// nil if it's a kind of event other than a push.
+type registryParseFunc func(r *http.Request, body, secret []byte) ([]image.Name, error)
+
+// The formats of registry payload accepted, by path
+var registryFormats = map[string]registryParseFunc{
+	"dockerhub": parseDockerHub,
+	"quay":      parseQuay,
+	"harbor":    parseHarbor,
+	"gcr":       parseGCR,
+	"generic":   parseGenericImage,
+}
+
+// RegistryHandler serves webhooks at the path
+// /hook/registry/<format>, where the format is one of dockerhub,
+// quay, harbor, gcr or generic.
+type RegistryHandler struct {
+	secret []byte
+	notify func(image.Name)
+	logger log.Logger
+}
+
+// NewRegistryHandler constructs a handler for registry webhooks that
+// are authenticated with the secret given, and calls `notify` with
+// each image pushed.
+func NewRegistryHandler(secret []byte, notify func(image.Name), logger log.Logger) *RegistryHandler {
+	return &RegistryHandler{
+		secret: secret,
+		notify: notify,
+		logger: logger,
+	}
+}
+
+func (h *RegistryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(r.URL.Path, "/hook/registry/")
+	parse, ok := registryFormats[format]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	names, err := parse(r, body, h.secret)
+	switch {
+	case err == errUnauthorized:
+		h.logger.Log("format", format, "err", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		h.logger.Log("format", format, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case names == nil:
+		fmt.Fprintln(w, "ignored event")
+		return
+	}
+
+	seen := map[image.Name]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		h.logger.Log("format", format, "msg", "notified of image push", "image", name.String())
+		h.notify(name)
+	}
+	fmt.Fprintf(w, "notified of %d image(s)\n", len(seen))
+}
+
+// parseImageName parses an image name, with or without a tag or
+// digest.
+func parseImageName(s string) (image.Name, error) {
+	if i := strings.Index(s, "@"); i >= 0 {
+		s = s[:i]
+	}
+	ref, err := image.ParseRef(s)
+	if err != nil {
+		return image.Name{}, errBadPayload
+	}
+	return ref.Name, nil
+}
+
+// tokenFromQuery gets the token given in the query string of the
+// webhook URL, for registries that can't be told to send a secret
+// any other way.
+func tokenFromQuery(r *http.Request) string {
+	return r.URL.Query().Get("token")
+}
+
+// Docker Hub doesn't sign payloads or send custom headers, so the
+// secret is given in the URL, as `?token=<secret>`.
+func parseDockerHub(r *http.Request, body, secret []byte) ([]image.Name, error) {
+	if err := checkToken(tokenFromQuery(r), secret); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Repository.RepoName == "" {
+		return nil, errBadPayload
+	}
+	name, err := parseImageName(payload.Repository.RepoName)
+	if err != nil {
+		return nil, err
+	}
+	return []image.Name{name}, nil
+}
+
+// Quay doesn't sign payloads either, so the secret is given in the
+// URL, as `?token=<secret>`. Only "Push to Repository" notifications
+// have `updated_tags`.
+func parseQuay(r *http.Request, body, secret []byte) ([]image.Name, error) {
+	if err := checkToken(tokenFromQuery(r), secret); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		DockerURL   string   `json:"docker_url"`
+		UpdatedTags []string `json:"updated_tags"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	if payload.UpdatedTags == nil {
+		return nil, nil
+	}
+	if payload.DockerURL == "" {
+		return nil, errBadPayload
+	}
+	name, err := parseImageName(payload.DockerURL)
+	if err != nil {
+		return nil, err
+	}
+	return []image.Name{name}, nil
+}
+
+// Harbor sends the "auth header" configured for the webhook as-is,
+// in Authorization; this must be the secret, optionally as a bearer
+// token. Harbor 2 sends PUSH_ARTIFACT events, and Harbor 1 pushImage
+// events, both with the URL of each image pushed.
+func parseHarbor(r *http.Request, body, secret []byte) ([]image.Name, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := checkToken(token, secret); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	if payload.Type != "PUSH_ARTIFACT" && payload.Type != "pushImage" {
+		return nil, nil
+	}
+	names := []image.Name{}
+	for _, res := range payload.EventData.Resources {
+		name, err := parseImageName(res.ResourceURL)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// GCR (and Artifact Registry) publish notifications to Pub/Sub,
+// which can push them to fluxd wrapped in an envelope. The
+// subscription's push endpoint must include the secret as
+// `?token=<secret>`. Deletions are ignored.
+func parseGCR(r *http.Request, body, secret []byte) ([]image.Name, error) {
+	if err := checkToken(tokenFromQuery(r), secret); err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		Message struct {
+			Data string `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, errBadPayload
+	}
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		return nil, errBadPayload
+	}
+	var payload struct {
+		Action string `json:"action"`
+		Digest string `json:"digest"`
+		Tag    string `json:"tag"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, errBadPayload
+	}
+	if payload.Action != "INSERT" {
+		return nil, nil
+	}
+	// `tag` is absent if the image was pushed by digest only
+	ref := payload.Tag
+	if ref == "" {
+		ref = payload.Digest
+	}
+	if ref == "" {
+		return nil, errBadPayload
+	}
+	name, err := parseImageName(ref)
+	if err != nil {
+		return nil, err
+	}
+	return []image.Name{name}, nil
+}
+
+// The generic format is for anything that can make an HTTP request,
+// e.g., a CI job that has just pushed an image. It expects the
+// secret as a bearer token, and a payload like
+//
+//	{"image": "quay.io/org/app:v1.2.3"}
+func parseGenericImage(r *http.Request, body, secret []byte) ([]image.Name, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := checkToken(token, secret); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Image string `json:"image"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Image == "" {
+		return nil, errBadPayload
+	}
+	name, err := parseImageName(payload.Image)
+	if err != nil {
+		return nil, err
+	}
+	return []image.Name{name}, nil
+}
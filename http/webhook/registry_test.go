@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func setupRegistry() (*RegistryHandler, *[]string) {
+	var notified []string
+	h := NewRegistryHandler([]byte(secret), func(name image.Name) {
+		notified = append(notified, name.String())
+	}, log.NewNopLogger())
+	return h, &notified
+}
+
+func checkNotified(t *testing.T, what string, rec int, notified []string, expected ...string) {
+	if rec != http.StatusOK {
+		t.Errorf("%s: expected 200, got %d", what, rec)
+		return
+	}
+	if len(notified) != len(expected) {
+		t.Errorf("%s: expected notifications %v, got %v", what, expected, notified)
+		return
+	}
+	for i := range expected {
+		if notified[i] != expected[i] {
+			t.Errorf("%s: expected notifications %v, got %v", what, expected, notified)
+			return
+		}
+	}
+}
+
+func TestDockerHub(t *testing.T) {
+	h, notified := setupRegistry()
+	body := `{"push_data": {"tag": "latest"}, "repository": {"repo_name": "org/app", "namespace": "org", "name": "app"}}`
+
+	rec := post(h, "/hook/registry/dockerhub?token="+secret, body, nil)
+	checkNotified(t, "dockerhub", rec.Code, *notified, "org/app")
+
+	rec = post(h, "/hook/registry/dockerhub?token=wrong", body, nil)
+	if rec.Code != http.StatusUnauthorized || len(*notified) != 1 {
+		t.Errorf("expected 401 and no notification for a bad token, got %d and %v", rec.Code, *notified)
+	}
+}
+
+func TestQuay(t *testing.T) {
+	h, notified := setupRegistry()
+
+	rec := post(h, "/hook/registry/quay?token="+secret, `{"repository": "org/app", "docker_url": "quay.io/org/app", "updated_tags": ["v1", "latest"]}`, nil)
+	checkNotified(t, "push", rec.Code, *notified, "quay.io/org/app")
+
+	// e.g., a build notification
+	rec = post(h, "/hook/registry/quay?token="+secret, `{"repository": "org/app", "docker_url": "quay.io/org/app", "build_id": "abc"}`, nil)
+	checkNotified(t, "build", rec.Code, *notified, "quay.io/org/app")
+}
+
+func TestHarbor(t *testing.T) {
+	h, notified := setupRegistry()
+	body := `{"type": "PUSH_ARTIFACT", "event_data": {"resources": [{"tag": "v1", "resource_url": "harbor.example.com/project/app:v1"}, {"tag": "latest", "resource_url": "harbor.example.com/project/app:latest"}]}}`
+
+	rec := post(h, "/hook/registry/harbor", body, map[string]string{"Authorization": secret})
+	checkNotified(t, "push", rec.Code, *notified, "harbor.example.com/project/app")
+
+	rec = post(h, "/hook/registry/harbor", `{"type": "PULL_ARTIFACT", "event_data": {"resources": [{"resource_url": "harbor.example.com/project/other:v1"}]}}`, map[string]string{"Authorization": "Bearer " + secret})
+	checkNotified(t, "pull", rec.Code, *notified, "harbor.example.com/project/app")
+
+	rec = post(h, "/hook/registry/harbor", body, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+}
+
+func TestGCR(t *testing.T) {
+	h, notified := setupRegistry()
+	envelope := func(data string) string {
+		return `{"message": {"data": "` + base64.StdEncoding.EncodeToString([]byte(data)) + `", "messageId": "1"}, "subscription": "projects/p/subscriptions/flux"}`
+	}
+
+	rec := post(h, "/hook/registry/gcr?token="+secret, envelope(`{"action": "INSERT", "digest": "gcr.io/project/app@sha256:6ec1", "tag": "gcr.io/project/app:v1"}`), nil)
+	checkNotified(t, "tagged", rec.Code, *notified, "gcr.io/project/app")
+
+	rec = post(h, "/hook/registry/gcr?token="+secret, envelope(`{"action": "INSERT", "digest": "localhost:5000/project/other@sha256:6ec1"}`), nil)
+	checkNotified(t, "digest", rec.Code, *notified, "gcr.io/project/app", "localhost:5000/project/other")
+
+	rec = post(h, "/hook/registry/gcr?token="+secret, envelope(`{"action": "DELETE", "tag": "gcr.io/project/app:v1"}`), nil)
+	checkNotified(t, "delete", rec.Code, *notified, "gcr.io/project/app", "localhost:5000/project/other")
+
+	rec = post(h, "/hook/registry/gcr?token="+secret, `{"message": {"data": "not base64!"}}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad payload, got %d", rec.Code)
+	}
+}
+
+func TestGenericImage(t *testing.T) {
+	h, notified := setupRegistry()
+
+	rec := post(h, "/hook/registry/generic", `{"image": "quay.io/org/app:v1.2.3"}`, map[string]string{"Authorization": "Bearer " + secret})
+	checkNotified(t, "generic", rec.Code, *notified, "quay.io/org/app")
+
+	for _, body := range []string{`{}`, `{"image": "/bad"}`, `{`} {
+		rec = post(h, "/hook/registry/generic", body, map[string]string{"Authorization": "Bearer " + secret})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for a bad payload, got %d", body, rec.Code)
+		}
+	}
+	rec = post(h, "/hook/registry/generic", `{"image": "org/app"}`, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+	rec = post(h, "/hook/registry/unknown", `{}`, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown format, got %d", rec.Code)
+	}
+}
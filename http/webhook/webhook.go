@@ -0,0 +1,194 @@
+// Package webhook receives notifications of pushes from git hosts
+// and image registries, so that fluxd can fetch from the repo, or
+// look for new images, straight away rather than waiting for the
+// next poll.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// The largest payload accepted; GitHub's limit is 25MB.
+const maxPayloadSize = 25 << 20
+
+var (
+	errUnauthorized = errors.New("missing or incorrect signature or token")
+	errBadPayload   = errors.New("unable to parse payload")
+)
+
+// Notifier is told when there are new commits to fetch; *git.Repo
+// implements it.
+type Notifier interface {
+	Notify()
+}
+
+// GitSource is a git repo and branch fluxd syncs from, and the repo
+// to notify when there's a push to that branch.
+type GitSource struct {
+	URL    string
+	Branch string
+	Repo   Notifier
+}
+
+// push is what's needed from a push payload: the URLs by which the
+// repo is known, and the branches pushed to.
+type push struct {
+	URLs     []string
+	Branches []string
+}
+
+// parseFunc checks that a request is authentic, using the secret,
+// and parses the push from its body; or returns nil if it's a kind
+// of event other than a push.
+type parseFunc func(r *http.Request, body, secret []byte) (*push, error)
+
+// The formats of payload accepted, by path
+var formats = map[string]parseFunc{
+	"github":    parseGitHub,
+	"gitlab":    parseGitLab,
+	"bitbucket": parseBitbucket,
+	"generic":   parseGeneric,
+}
+
+// Handler serves webhooks at the path /hook/git/<format>, where the
+// format is one of github, gitlab, bitbucket or generic.
+type Handler struct {
+	secret  []byte
+	sources []GitSource
+	logger  log.Logger
+}
+
+// NewHandler constructs a handler for webhooks that are
+// authenticated with the secret given, and notify the sources given.
+func NewHandler(secret []byte, sources []GitSource, logger log.Logger) *Handler {
+	return &Handler{
+		secret:  secret,
+		sources: sources,
+		logger:  logger,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(r.URL.Path, "/hook/git/")
+	parse, ok := formats[format]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := parse(r, body, h.secret)
+	switch {
+	case err == errUnauthorized:
+		h.logger.Log("format", format, "err", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		h.logger.Log("format", format, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case p == nil:
+		fmt.Fprintln(w, "ignored event")
+		return
+	}
+
+	var notified int
+	for _, src := range h.sources {
+		if p.matches(src) {
+			src.Repo.Notify()
+			notified++
+		}
+	}
+	if notified == 0 {
+		h.logger.Log("format", format, "msg", "push does not match any git source", "urls", strings.Join(p.URLs, ", "), "branches", strings.Join(p.Branches, ", "))
+	} else {
+		h.logger.Log("format", format, "msg", "notified of push", "sources", notified)
+	}
+	fmt.Fprintf(w, "notified %d git source(s)\n", notified)
+}
+
+// matches says whether the push was to the repo and branch of the
+// source.
+func (p *push) matches(src GitSource) bool {
+	var repo, branch bool
+	for _, u := range p.URLs {
+		repo = repo || u != "" && normalizeURL(u) == normalizeURL(src.URL)
+	}
+	for _, b := range p.Branches {
+		branch = branch || b == src.Branch
+	}
+	return repo && branch
+}
+
+// normalizeURL reduces a git URL to host/path, so that the various
+// URLs for a repo (e.g., git@github.com:org/repo.git and
+// https://github.com/org/repo) compare equal.
+func normalizeURL(u string) string {
+	host, path := git.RepoHostAndPath(u)
+	return host + "/" + path
+}
+
+// branchFromRef gives the branch a ref refers to, or "" if it's not
+// a branch.
+func branchFromRef(ref string) string {
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	return ""
+}
+
+// checkSignature checks a signature of the form `<algorithm>=<hex
+// HMAC of the body>`, as sent by GitHub and Bitbucket.
+func checkSignature(signature string, body, secret []byte) error {
+	var hashFunc func() hash.Hash
+	switch {
+	case strings.HasPrefix(signature, "sha256="):
+		hashFunc = sha256.New
+	case strings.HasPrefix(signature, "sha1="):
+		hashFunc = sha1.New
+	default:
+		return errUnauthorized
+	}
+	given, err := hex.DecodeString(signature[strings.Index(signature, "=")+1:])
+	if err != nil {
+		return errUnauthorized
+	}
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(body)
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// checkToken checks a token sent as-is.
+func checkToken(token string, secret []byte) error {
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+		return errUnauthorized
+	}
+	return nil
+}
@@ -237,6 +237,9 @@ type Info struct {
 	ImageID string `json:",omitempty"`
 	// the time at which the image pointed at was created
 	CreatedAt time.Time `json:",omitempty"`
+	// the labels given in the image's config, e.g.,
+	// org.opencontainers.image.created
+	Labels map[string]string `json:",omitempty"`
 	// the last time this image manifest was fetched
 	LastFetched time.Time `json:",omitempty"`
 }
@@ -303,6 +306,95 @@ func NewerByCreated(lhs, rhs *Info) bool {
 	return lhs.CreatedAt.After(rhs.CreatedAt)
 }
 
+// NewerByLabel returns a func which returns true if lhs image should
+// be sorted before rhs with regard to the value of the label given,
+// descending. The two values are compared as timestamps (RFC3339) if
+// both are, or otherwise as versions (e.g., build numbers) if both
+// are, or otherwise as strings. Images without the label are sorted
+// after those with it; and images with the same value, by their
+// creation date.
+//
+// Comparing pairs of mixed values this way is not transitive, so to
+// sort more than two images, use SortByLabel.
+func NewerByLabel(label string) func(lhs, rhs *Info) bool {
+	return func(lhs, rhs *Info) bool {
+		return newerByLabel(label, labelValueComparison(lhs.Labels[label], rhs.Labels[label]))(lhs, rhs)
+	}
+}
+
+// SortByLabel orders the given image infos by the value of the label
+// given, descending, as NewerByLabel does; but the values are
+// compared the same way throughout, according to whether _all_ of
+// them are timestamps, or versions, so that the order is well
+// defined.
+func SortByLabel(infos []Info, label string) {
+	var values []string
+	for _, info := range infos {
+		if v, ok := info.Labels[label]; ok {
+			values = append(values, v)
+		}
+	}
+	Sort(infos, newerByLabel(label, labelValueComparison(values...)))
+}
+
+func newerByLabel(label string, compare func(a, b string) int) func(lhs, rhs *Info) bool {
+	return func(lhs, rhs *Info) bool {
+		lv, lok := lhs.Labels[label]
+		rv, rok := rhs.Labels[label]
+		if lok != rok {
+			return lok
+		}
+		if cmp := compare(lv, rv); cmp != 0 {
+			return cmp > 0
+		}
+		return NewerByCreated(lhs, rhs)
+	}
+}
+
+// labelValueComparison gives a func for comparing label values, which
+// compares them as timestamps if all the values given are
+// timestamps, or otherwise as versions if all of them are versions,
+// or otherwise as strings.
+func labelValueComparison(values ...string) func(a, b string) int {
+	timestamps := true
+	for _, v := range values {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			timestamps = false
+			break
+		}
+	}
+	if timestamps {
+		return func(a, b string) int {
+			at, _ := time.Parse(time.RFC3339, a)
+			bt, _ := time.Parse(time.RFC3339, b)
+			switch {
+			case at.After(bt):
+				return 1
+			case bt.After(at):
+				return -1
+			}
+			return 0
+		}
+	}
+
+	versions := true
+	for _, v := range values {
+		if _, err := semver.NewVersion(v); err != nil {
+			versions = false
+			break
+		}
+	}
+	if versions {
+		return func(a, b string) int {
+			av, _ := semver.NewVersion(a)
+			bv, _ := semver.NewVersion(b)
+			return av.Compare(bv)
+		}
+	}
+
+	return strings.Compare
+}
+
 // NewerBySemver returns true if lhs image should be sorted
 // before rhs with regard to their semver order descending.
 func NewerBySemver(lhs, rhs *Info) bool {
@@ -153,6 +153,7 @@ func TestImageInfoSerialisation(t *testing.T) {
 	info.Digest = "sha256:digest"
 	info.ImageID = "sha256:layerID"
 	info.LastFetched = t1
+	info.Labels = map[string]string{"org.opencontainers.image.revision": "abc123"}
 	bytes, err := json.Marshal(info)
 	if err != nil {
 		t.Fatal(err)
@@ -233,6 +234,71 @@ func TestImage_OrderBySemverTagDesc(t *testing.T) {
 	assert.Equal(t, tags(expected), tags(imgs))
 }
 
+func TestImage_OrderByLabel(t *testing.T) {
+	withLabel := func(ref, value string) Info {
+		info := mustMakeInfo(ref, testTime) // reproducible builds all have the same creation date
+		if value != "" {
+			info.Labels = map[string]string{"build": value}
+		}
+		return info
+	}
+	aa := withLabel("my/image:aa", "10")
+	bb := withLabel("my/image:bb", "9")
+	cc := withLabel("my/image:cc", "2019-01-02T15:04:05Z")
+	dd := withLabel("my/image:dd", "2019-01-02T15:04:05+01:00")
+	ee := withLabel("my/image:ee", "")
+	ff := withLabel("my/image:ff", "10")
+
+	imgs := []Info{aa, bb, ee, ff}
+	Sort(imgs, NewerByLabel("build"))
+	assert.Equal(t, tags([]Info{aa, ff, bb, ee}), tags(imgs))
+
+	imgs = []Info{dd, cc, ee}
+	Sort(imgs, NewerByLabel("build"))
+	assert.Equal(t, tags([]Info{cc, dd, ee}), tags(imgs))
+
+	// stable?
+	reverse(imgs)
+	Sort(imgs, NewerByLabel("build"))
+	assert.Equal(t, tags([]Info{cc, dd, ee}), tags(imgs))
+}
+
+// When the label values are of mixed kinds, they are all compared the
+// same way, so the order doesn't depend on the order they started in.
+func TestImage_SortByLabelMixed(t *testing.T) {
+	withLabel := func(ref, value string) Info {
+		info := mustMakeInfo(ref, testTime)
+		info.Labels = map[string]string{"build": value}
+		return info
+	}
+	for _, c := range []struct {
+		values   []string
+		expected []string
+	}{
+		// all versions
+		{[]string{"9", "1.2.3", "10"}, []string{"10", "9", "1.2.3"}},
+		// timestamps and versions, so compared as strings
+		{[]string{"9", "2019-01-02T15:04:05Z", "10"}, []string{"9", "2019-01-02T15:04:05Z", "10"}},
+		// timestamps, versions and text
+		{[]string{"2019-01-02T15:04:05Z", "10", "beta", "9", "2018-12-31T00:00:00Z"}, []string{"beta", "9", "2019-01-02T15:04:05Z", "2018-12-31T00:00:00Z", "10"}},
+	} {
+		var imgs []Info
+		for i, v := range c.values {
+			imgs = append(imgs, withLabel(fmt.Sprintf("my/image:%d", i), v))
+		}
+		for i := 0; i < len(imgs); i++ {
+			// rotate the starting order
+			imgs = append(imgs[1:], imgs[0])
+			SortByLabel(imgs, "build")
+			var got []string
+			for _, img := range imgs {
+				got = append(got, img.Labels["build"])
+			}
+			assert.Equal(t, c.expected, got)
+		}
+	}
+}
+
 func tags(imgs []Info) []string {
 	var vs []string
 	for _, i := range imgs {
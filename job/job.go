@@ -33,6 +33,22 @@ type Result struct {
 	Revision string        `json:"revision,omitempty"`
 	Spec     *update.Spec  `json:"spec,omitempty"`
 	Result   update.Result `json:"result,omitempty"`
+	// PullRequest refers to the pull request proposing the commit,
+	// if it was not pushed to the branch being synced.
+	PullRequest string `json:"pullRequest,omitempty"`
+	// PushAttempts is how many times the commit was pushed before it
+	// went through; more than once means it had to be rebased on
+	// commits pushed in the meantime.
+	PushAttempts int `json:"pushAttempts,omitempty"`
+}
+
+// Note is what's recorded about a commit made by a job: as a git note
+// on the commit, and, once it's synced, with the sync state if that's
+// kept outside the repo.
+type Note struct {
+	JobID  ID            `json:"jobID"`
+	Spec   update.Spec   `json:"spec"`
+	Result update.Result `json:"result"`
 }
 
 // Status holds the possible states of a job; either,
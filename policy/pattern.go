@@ -47,6 +47,15 @@ type RegexpPattern struct {
 	regexp	*regexp.Regexp
 }
 
+// LabelOrderPattern matches as the pattern it wraps, but orders
+// images by the value of an image label (e.g., a build number, or
+// org.opencontainers.image.created) rather than as that pattern
+// would.
+type LabelOrderPattern struct {
+	Pattern
+	Label string
+}
+
 // NewPattern instantiates a Pattern according to the prefix
 // it finds. The prefix can be either `glob:` (default if omitted),
 // `semver:` or `regexp:`.
@@ -124,3 +133,7 @@ func (r RegexpPattern) Newer(a, b *image.Info) bool {
 func (r RegexpPattern) Valid() bool {
 	return r.regexp != nil
 }
+
+func (l LabelOrderPattern) Newer(a, b *image.Info) bool {
+	return image.NewerByLabel(l.Label)(a, b)
+}
@@ -36,15 +36,37 @@ func Tag(policy Policy) bool {
 	return strings.HasPrefix(string(policy), "tag.")
 }
 
+// SortLabelPrefix gives the policy naming the image label by which
+// to order the images for a container, instead of the order given by
+// its tag pattern.
+func SortLabelPrefix(container string) Policy {
+	return Policy("sort_label." + container)
+}
+
+func SortLabel(policy Policy) bool {
+	return strings.HasPrefix(string(policy), "sort_label.")
+}
+
+// GetTagPattern gives the pattern that the images for a container
+// must match, and that orders them.
 func GetTagPattern(policies Set, container string) Pattern {
 	if policies == nil {
 		return PatternAll
 	}
-	pattern, ok := policies.Get(TagPrefix(container))
-	if !ok {
-		return PatternAll
+	pattern := PatternAll
+	if p, ok := policies.Get(TagPrefix(container)); ok {
+		pattern = NewPattern(p)
+	}
+	return WithSortLabel(policies, container, pattern)
+}
+
+// WithSortLabel gives the pattern given, ordering by the image label
+// named in the container's sort label policy, if there is one.
+func WithSortLabel(policies Set, container string, pattern Pattern) Pattern {
+	if label, ok := policies.Get(SortLabelPrefix(container)); ok && label != "" {
+		return LabelOrderPattern{Pattern: pattern, Label: label}
 	}
-	return NewPattern(pattern)
+	return pattern
 }
 
 type Updates map[flux.ResourceID]Update
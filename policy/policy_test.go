@@ -81,6 +81,17 @@ func Test_GetTagPattern(t *testing.T) {
 			},
 			want: NewPattern("master-*"),
 		},
+		{
+			name: "Sort label",
+			args: args{
+				policies: Set{
+					Policy(fmt.Sprintf("tag.%s", container)):        "glob:master-*",
+					Policy(fmt.Sprintf("sort_label.%s", container)): "org.opencontainers.image.created",
+				},
+				container: container,
+			},
+			want: LabelOrderPattern{Pattern: NewPattern("master-*"), Label: "org.opencontainers.image.created"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
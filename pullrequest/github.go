@@ -0,0 +1,65 @@
+package pullrequest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitHub opens pull requests through the GitHub API.
+type GitHub struct {
+	// The base URL of the API. If empty, it's https://api.github.com
+	// for repos on github.com, and https://<host>/api/v3 (i.e.,
+	// GitHub Enterprise) for repos elsewhere.
+	APIURL string
+	// A token with permission to open pull requests on the repo
+	Token  string
+	Client *http.Client
+}
+
+type gitHubPull struct {
+	HTMLURL string `json:"html_url"`
+}
+
+func (g *GitHub) Open(ctx context.Context, req Request) (string, error) {
+	host, path, err := repoPath(req.RepoURL)
+	if err != nil {
+		return "", err
+	}
+	api := g.APIURL
+	switch {
+	case api != "":
+	case host == "github.com":
+		api = "https://api.github.com"
+	default:
+		api = "https://" + host + "/api/v3"
+	}
+	api = strings.TrimSuffix(api, "/") + "/repos/" + path + "/pulls"
+	header := http.Header{"Authorization": {"token " + g.Token}}
+
+	owner := path[:strings.Index(path, "/")]
+	query := url.Values{
+		"head":  {owner + ":" + req.Head},
+		"base":  {req.Base},
+		"state": {"open"},
+	}
+	var existing []gitHubPull
+	if err := doJSON(ctx, g.Client, "GET", api+"?"+query.Encode(), header, nil, &existing); err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		return existing[0].HTMLURL, nil
+	}
+
+	var created gitHubPull
+	if err := doJSON(ctx, g.Client, "POST", api, header, map[string]string{
+		"title": req.Title,
+		"head":  req.Head,
+		"base":  req.Base,
+		"body":  req.Description,
+	}, &created); err != nil {
+		return "", err
+	}
+	return created.HTMLURL, nil
+}
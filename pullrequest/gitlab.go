@@ -0,0 +1,60 @@
+package pullrequest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLab opens merge requests through the GitLab API.
+type GitLab struct {
+	// The base URL of the API. If empty, it's https://<host>/api/v4,
+	// where the host is that of the repo.
+	APIURL string
+	// A token with permission to open merge requests on the repo
+	Token  string
+	Client *http.Client
+}
+
+type gitLabMergeRequest struct {
+	WebURL string `json:"web_url"`
+}
+
+func (g *GitLab) Open(ctx context.Context, req Request) (string, error) {
+	host, path, err := repoPath(req.RepoURL)
+	if err != nil {
+		return "", err
+	}
+	api := g.APIURL
+	if api == "" {
+		api = "https://" + host + "/api/v4"
+	}
+	api = strings.TrimSuffix(api, "/") + "/projects/" + url.PathEscape(path) + "/merge_requests"
+	header := http.Header{"Private-Token": {g.Token}}
+
+	query := url.Values{
+		"source_branch": {req.Head},
+		"target_branch": {req.Base},
+		"state":         {"opened"},
+	}
+	var existing []gitLabMergeRequest
+	if err := doJSON(ctx, g.Client, "GET", api+"?"+query.Encode(), header, nil, &existing); err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		return existing[0].WebURL, nil
+	}
+
+	var created gitLabMergeRequest
+	if err := doJSON(ctx, g.Client, "POST", api, header, map[string]interface{}{
+		"title":                req.Title,
+		"source_branch":        req.Head,
+		"target_branch":        req.Base,
+		"description":          req.Description,
+		"remove_source_branch": true,
+	}, &created); err != nil {
+		return "", err
+	}
+	return created.WebURL, nil
+}
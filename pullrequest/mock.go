@@ -0,0 +1,37 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Mock is a Provider that only records the pull requests opened,
+// for tests.
+type Mock struct {
+	mu     sync.Mutex
+	opened []Request
+}
+
+func (m *Mock) Open(ctx context.Context, req Request) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.opened {
+		if r.RepoURL == req.RepoURL && r.Head == req.Head && r.Base == req.Base {
+			return mockRef(i), nil
+		}
+	}
+	m.opened = append(m.opened, req)
+	return mockRef(len(m.opened) - 1), nil
+}
+
+// Opened gives the pull requests opened so far.
+func (m *Mock) Opened() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.opened...)
+}
+
+func mockRef(i int) string {
+	return fmt.Sprintf("mock/%d", i+1)
+}
@@ -0,0 +1,84 @@
+// Package pullrequest opens pull requests (merge requests, as some
+// git hosts call them), so that fluxd can propose changes to a git
+// repo rather than pushing them to the branch it syncs.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// Request describes a pull request to open.
+type Request struct {
+	RepoURL     string // the repo, as given to fluxd
+	Base        string // the branch to merge into
+	Head        string // the branch with the changes
+	Title       string
+	Description string
+}
+
+// Provider opens pull requests on a git host.
+type Provider interface {
+	// Open opens a pull request or, if there is already an open
+	// pull request from the head branch to the base branch, finds
+	// that. Either way, it returns a reference to the pull request
+	// (e.g., its URL).
+	Open(ctx context.Context, req Request) (string, error)
+}
+
+// repoPath gives the host and the path (e.g., org/repo) of a repo,
+// from its git URL, or an error if it doesn't have both.
+func repoPath(repoURL string) (host, path string, err error) {
+	host, path = git.RepoHostAndPath(repoURL)
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("cannot find the host and path of the repo in %q", repoURL)
+	}
+	return host, path, nil
+}
+
+// doJSON makes an API request, with a JSON body if `in` is not nil,
+// and decodes the JSON response into `out`.
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,107 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRepoPath(t *testing.T) {
+	for u, expected := range map[string][2]string{
+		"git@github.com:org/repo.git":             {"github.com", "org/repo"},
+		"https://github.com/org/repo":             {"github.com", "org/repo"},
+		"ssh://git@gitlab.example.com:2222/a/b/c": {"gitlab.example.com", "a/b/c"},
+	} {
+		host, path, err := repoPath(u)
+		if err != nil {
+			t.Errorf("%s: %s", u, err)
+			continue
+		}
+		if host != expected[0] || path != expected[1] {
+			t.Errorf("%s: expected %v, got %s and %s", u, expected, host, path)
+		}
+	}
+	if _, _, err := repoPath("/local/repo"); err == nil {
+		t.Error("expected an error for a URL without a host")
+	}
+}
+
+// fakeHost serves the list and create endpoints for pull requests,
+// recording what's created.
+func fakeHost(t *testing.T, path, authHeader, token, urlField string, existing bool) (*httptest.Server, *map[string]interface{}) {
+	created := map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != path {
+			t.Errorf("expected request to %s, got %s", path, r.URL.EscapedPath())
+		}
+		if r.Header.Get(authHeader) != token {
+			t.Errorf("expected %s: %s, got %q", authHeader, token, r.Header.Get(authHeader))
+		}
+		switch r.Method {
+		case "GET":
+			pulls := []map[string]string{}
+			if existing {
+				pulls = append(pulls, map[string]string{urlField: "existing"})
+			}
+			json.NewEncoder(w).Encode(pulls)
+		case "POST":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{urlField: "created"})
+		}
+	}))
+	return server, &created
+}
+
+func TestGitHub(t *testing.T) {
+	req := Request{RepoURL: "git@github.com:org/repo", Base: "master", Head: "flux/update", Title: "Update"}
+
+	server, created := fakeHost(t, "/repos/org/repo/pulls", "Authorization", "token s3cr3t", "html_url", false)
+	defer server.Close()
+	gh := &GitHub{APIURL: server.URL, Token: "s3cr3t"}
+	ref, err := gh.Open(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "created" || (*created)["head"] != "flux/update" || (*created)["base"] != "master" {
+		t.Errorf("expected pull request to be created, got %q and %v", ref, *created)
+	}
+
+	server, created = fakeHost(t, "/repos/org/repo/pulls", "Authorization", "token s3cr3t", "html_url", true)
+	defer server.Close()
+	gh.APIURL = server.URL
+	ref, err = gh.Open(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "existing" || len(*created) != 0 {
+		t.Errorf("expected existing pull request, got %q and %v", ref, *created)
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	server, created := fakeHost(t, "/projects/group%2Frepo/merge_requests", "Private-Token", "s3cr3t", "web_url", false)
+	defer server.Close()
+	gl := &GitLab{APIURL: server.URL, Token: "s3cr3t"}
+	ref, err := gl.Open(context.Background(), Request{RepoURL: "https://gitlab.com/group/repo.git", Base: "master", Head: "flux/update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "created" || (*created)["source_branch"] != "flux/update" || (*created)["target_branch"] != "master" {
+		t.Errorf("expected merge request to be created, got %q and %v", ref, *created)
+	}
+}
+
+func TestMock(t *testing.T) {
+	m := &Mock{}
+	req := Request{RepoURL: "git@github.com:org/repo", Base: "master", Head: "flux/update"}
+	ref1, _ := m.Open(context.Background(), req)
+	ref2, _ := m.Open(context.Background(), req)
+	req.Head = "flux/other"
+	ref3, _ := m.Open(context.Background(), req)
+	if ref1 != ref2 || ref1 == ref3 || len(m.Opened()) != 2 {
+		t.Errorf("expected one pull request per head branch, got %q, %q, %q and %v", ref1, ref2, ref3, m.Opened())
+	}
+}
@@ -7,6 +7,7 @@ package registry
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -53,8 +54,6 @@ func contains(strs []string, str string) bool {
 // AWS, there will be a cost incurred).
 
 func ImageCredsWithAWSAuth(lookup func() ImageCreds, logger log.Logger, config AWSRegistryConfig) (func() ImageCreds, error) {
-	awsCreds := NoCredentials()
-
 	if len(config.Regions) == 0 {
 		// this forces the AWS SDK to load config, so we can get the default region
 		sess := session.Must(session.NewSessionWithOptions(session.Options{
@@ -80,17 +79,6 @@ func ImageCredsWithAWSAuth(lookup func() ImageCreds, logger log.Logger, config A
 		"include-ids", strings.Join(config.AccountIDs, ", "),
 		"exclude-ids", strings.Join(config.BlockIDs, ", "))
 
-	// this has the expiry time from the last request made per region. We request new tokens whenever
-	//  - we don't have credentials for the particular registry URL
-	//  - the credentials have expired
-	// and when we do, we get new tokens for all account IDs in the
-	// region that we've seen. This means that credentials are
-	// fetched, and expire, per region.
-	regionExpire := map[string]time.Time{}
-	// we can get an error when refreshing the credentials; to avoid
-	// spamming the log, keep track of failed refreshes.
-	regionEmbargo := map[string]time.Time{}
-
 	// should this registry be scanned?
 	var shouldScan func(string, string) bool
 	if len(config.AccountIDs) == 0 {
@@ -105,51 +93,17 @@ func ImageCredsWithAWSAuth(lookup func() ImageCreds, logger log.Logger, config A
 		}
 	}
 
-	ensureCreds := func(domain, region, accountID string, now time.Time) error {
-		// if we had an error getting a token before, don't try again
-		// until the embargo has passed
-		if embargo, ok := regionEmbargo[region]; ok {
-			if embargo.After(now) {
-				return nil // i.e., fail silently
-			}
-			delete(regionEmbargo, region)
-		}
-
-		// if we don't have the entry at all, we need to get a
-		// token. NB we can't check the inverse and return early,
-		// since if the creds do exist, we need to check their expiry.
-		if c := awsCreds.credsFor(domain); c == (creds{}) {
-			goto refresh
-		}
-
-		// otherwise, check if the tokens have expired
-		if expiry, ok := regionExpire[region]; !ok || expiry.Before(now) {
-			goto refresh
-		}
-
-		// the creds exist and are before the use-by; nothing to be done.
-		return nil
-
-	refresh:
-		// unconditionally append the sought-after account, and let
-		// the AWS API figure out if it's a duplicate.
-		accountIDs := append(allAccountIDsInRegion(awsCreds.Hosts(), region), accountID)
-		logger.Log("info", "attempting to refresh auth tokens", "region", region, "account-ids", strings.Join(accountIDs, ", "))
-		regionCreds, expiry, err := fetchAWSCreds(region, accountIDs)
-		if err != nil {
-			regionEmbargo[region] = now.Add(embargoDuration)
-			logger.Log("error", "fetching credentials for AWS region", "region", region, "err", err, "embargo", embargoDuration)
-			return err
-		}
-		regionExpire[region] = expiry
-		awsCreds.Merge(regionCreds)
-		return nil
+	provider := &awsProvider{
+		logger:        logger,
+		creds:         NoCredentials(),
+		regionExpire:  map[string]time.Time{},
+		regionEmbargo: map[string]time.Time{},
 	}
 
-	return func() ImageCreds {
+	scan := func() ImageCreds {
 		imageCreds := lookup()
 
-		for name, creds := range imageCreds {
+		for name := range imageCreds {
 			domain := name.Domain
 			if strings.HasSuffix(domain, ecrHostSuffix) {
 				bits := strings.Split(domain, ".")
@@ -162,19 +116,91 @@ func ImageCredsWithAWSAuth(lookup func() ImageCreds, logger log.Logger, config A
 
 				if !shouldScan(region, accountID) {
 					delete(imageCreds, name)
-					continue
-				}
-				if err := ensureCreds(domain, region, accountID, time.Now()); err != nil {
-					logger.Log("warning", "unable to ensure credentials for ECR", "domain", domain, "err", err)
 				}
-				newCreds := NoCredentials()
-				newCreds.Merge(awsCreds)
-				newCreds.Merge(creds)
-				imageCreds[name] = newCreds
 			}
 		}
 		return imageCreds
-	}, nil
+	}
+	return ImageCredsWithProviders(scan, provider), nil
+}
+
+// awsProvider supplies credentials for ECR, from the AWS API.
+type awsProvider struct {
+	logger log.Logger
+
+	mu    sync.Mutex
+	creds Credentials
+	// this has the expiry time from the last request made per region. We request new tokens whenever
+	//  - we don't have credentials for the particular registry URL
+	//  - the credentials have expired
+	// and when we do, we get new tokens for all account IDs in the
+	// region that we've seen. This means that credentials are
+	// fetched, and expire, per region.
+	regionExpire map[string]time.Time
+	// we can get an error when refreshing the credentials; to avoid
+	// spamming the log, keep track of failed refreshes.
+	regionEmbargo map[string]time.Time
+}
+
+func (p *awsProvider) Handles(host string) bool {
+	return strings.HasSuffix(host, ecrHostSuffix) && len(strings.Split(host, ".")) == 6
+}
+
+func (p *awsProvider) Credentials(host string) (Credentials, error) {
+	bits := strings.Split(host, ".")
+	accountID := bits[0]
+	region := bits[3]
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.ensureCreds(host, region, accountID, time.Now()); err != nil {
+		p.logger.Log("warning", "unable to ensure credentials for ECR", "domain", host, "err", err)
+		return Credentials{}, err
+	}
+	creds := NoCredentials()
+	creds.Merge(p.creds)
+	return creds, nil
+}
+
+func (p *awsProvider) ensureCreds(domain, region, accountID string, now time.Time) error {
+	// if we had an error getting a token before, don't try again
+	// until the embargo has passed
+	if embargo, ok := p.regionEmbargo[region]; ok {
+		if embargo.After(now) {
+			return nil // i.e., fail silently
+		}
+		delete(p.regionEmbargo, region)
+	}
+
+	// if we don't have the entry at all, we need to get a
+	// token. NB we can't check the inverse and return early,
+	// since if the creds do exist, we need to check their expiry.
+	if c := p.creds.credsFor(domain); c.isZero() {
+		goto refresh
+	}
+
+	// otherwise, check if the tokens have expired
+	if expiry, ok := p.regionExpire[region]; !ok || expiry.Before(now) {
+		goto refresh
+	}
+
+	// the creds exist and are before the use-by; nothing to be done.
+	return nil
+
+refresh:
+	// unconditionally append the sought-after account, and let
+	// the AWS API figure out if it's a duplicate.
+	accountIDs := append(allAccountIDsInRegion(p.creds.Hosts(), region), accountID)
+	p.logger.Log("info", "attempting to refresh auth tokens", "region", region, "account-ids", strings.Join(accountIDs, ", "))
+	regionCreds, expiry, err := fetchAWSCreds(region, accountIDs)
+	if err != nil {
+		p.regionEmbargo[region] = now.Add(embargoDuration)
+		p.logger.Log("error", "fetching credentials for AWS region", "region", region, "err", err, "embargo", embargoDuration)
+		return err
+	}
+	p.regionExpire[region] = expiry
+	p.creds.Merge(regionCreds)
+	return nil
 }
 
 func allAccountIDsInRegion(hosts []string, region string) []string {
@@ -16,6 +16,23 @@ type azureCloudConfig struct {
 	AADClientSecret string `json:"aadClientSecret"`
 }
 
+// AzureCredentialProvider supplies credentials for Azure Container
+// Registry, using the client ID and secret in azure.json, when it's
+// mounted into the container.
+type AzureCredentialProvider struct{}
+
+func (AzureCredentialProvider) Handles(host string) bool {
+	return hostIsAzureContainerRegistry(host)
+}
+
+func (AzureCredentialProvider) Credentials(host string) (Credentials, error) {
+	cred, err := getAzureCloudConfigAADToken(host)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{m: map[string]creds{host: cred}}, nil
+}
+
 // Fetch Azure Active Directory clientid/secret pair from azure.json, usable for container registry authentication.
 //
 // Note: azure.json is populated by AKS/AKS-Engine script kubernetesconfigs.sh. The file is then passed to kubelet via
@@ -63,3 +63,33 @@ func (k *repoKey) Key() string {
 		k.fullRepositoryPath,
 	}, "|")
 }
+
+type prefixedKey struct {
+	prefix string
+	Keyer
+}
+
+func (k prefixedKey) Key() string {
+	return k.prefix + "|" + k.Keyer.Key()
+}
+
+type prefixedClient struct {
+	next   Client
+	prefix string
+}
+
+// PrefixKeys wraps a Client so that all its keys have the prefix
+// given. This keeps apart entries that would otherwise clash, e.g.,
+// image metadata cached by daemons looking for images for different
+// platforms.
+func PrefixKeys(c Client, prefix string) Client {
+	return &prefixedClient{next: c, prefix: prefix}
+}
+
+func (c *prefixedClient) GetKey(k Keyer) ([]byte, time.Time, error) {
+	return c.next.GetKey(prefixedKey{c.prefix, k})
+}
+
+func (c *prefixedClient) SetKey(k Keyer, deadline time.Time, v []byte) error {
+	return c.next.SetKey(prefixedKey{c.prefix, k}, deadline, v)
+}
@@ -0,0 +1,244 @@
+/*
+This package implements an image DB cache in the memory of the
+process, so that no memcached is needed.
+
+As with the memcached implementation, items are given an expiry based
+on their refresh deadline, with a minimum duration, so that they are
+only removed if they have not been refreshed in good time (e.g.,
+because the image is no longer used).
+
+The cache can optionally be saved to a file, periodically and when
+stopped, and loaded from it when started, so that a restart doesn't
+mean fetching all the image metadata again.
+*/
+package local
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	// The minimum expiry given to an entry.
+	MinExpiry = time.Hour
+	// How often to remove expired entries, and save the cache to its
+	// file, if no interval is given
+	DefaultSaveInterval = time.Minute
+
+	// Just to version in case we need to change format later.
+	fileVersion = 1
+)
+
+type entry struct {
+	Value    []byte
+	Deadline time.Time
+	Expiry   time.Time
+}
+
+// What's written to the file
+type snapshot struct {
+	Version int
+	Entries map[string]entry
+}
+
+// Config defines how a Client should be constructed.
+type Config struct {
+	// If not empty, the cache is loaded from and saved to this file
+	Path string
+	// How often to remove expired entries, and save to the file if
+	// there is one
+	SaveInterval time.Duration
+	Logger       log.Logger
+}
+
+// Client is a cache.Client that keeps the entries in memory.
+type Client struct {
+	mu      sync.RWMutex
+	entries map[string]entry
+	dirty   bool
+
+	path   string
+	logger log.Logger
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// NewClient constructs a Client, loading the entries saved in the
+// file given in the config, if there is one. A missing or unreadable
+// file is not an error; it just means starting with an empty cache.
+func NewClient(config Config) *Client {
+	c := &Client{
+		entries: map[string]entry{},
+		path:    config.Path,
+		logger:  config.Logger,
+		quit:    make(chan struct{}),
+	}
+	if c.logger == nil {
+		c.logger = log.NewNopLogger()
+	}
+	if c.path != "" {
+		if err := c.load(); err != nil && !os.IsNotExist(err) {
+			c.logger.Log("err", errors.Wrapf(err, "loading image cache from %s; starting afresh", c.path))
+		}
+	}
+
+	interval := config.SaveInterval
+	if interval <= 0 {
+		interval = DefaultSaveInterval
+	}
+	c.wait.Add(1)
+	go c.loop(interval)
+	return c
+}
+
+// GetKey gets the value and its refresh deadline from the cache.
+func (c *Client) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	c.mu.RLock()
+	e, ok := c.entries[k.Key()]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(e.Expiry) {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	return e.Value, e.Deadline, nil
+}
+
+// SetKey sets the value and its refresh deadline at a key. NB the
+// entry expires _later_ than the deadline, to give us a grace period
+// in which to refresh the value.
+func (c *Client) SetKey(k cache.Keyer, refreshDeadline time.Time, v []byte) error {
+	now := time.Now()
+	expiry := refreshDeadline.Sub(now) * 2
+	if expiry < MinExpiry {
+		expiry = MinExpiry
+	}
+	c.mu.Lock()
+	c.entries[k.Key()] = entry{
+		Value:    v,
+		Deadline: refreshDeadline,
+		Expiry:   now.Add(expiry),
+	}
+	c.dirty = true
+	c.mu.Unlock()
+	return nil
+}
+
+// Stop the client, saving the cache to its file if it has one.
+func (c *Client) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+// loop removes expired entries, and saves the cache to its file if
+// it has one, every interval until the client is stopped.
+func (c *Client) loop(interval time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.expire()
+			c.saveAndLog()
+		case <-c.quit:
+			c.saveAndLog()
+			return
+		}
+	}
+}
+
+func (c *Client) saveAndLog() {
+	if c.path == "" {
+		return
+	}
+	if err := c.save(); err != nil {
+		c.logger.Log("err", errors.Wrapf(err, "saving image cache to %s", c.path))
+	}
+}
+
+// expire removes the entries that have expired.
+func (c *Client) expire() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.After(e.Expiry) {
+			delete(c.entries, k)
+			c.dirty = true
+		}
+	}
+}
+
+func (c *Client) load() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var s snapshot
+	if err := gob.NewDecoder(f).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != fileVersion {
+		return errors.Errorf("unknown cache file version %d", s.Version)
+	}
+	if s.Entries != nil {
+		c.mu.Lock()
+		c.entries = s.Entries
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// save writes the cache to its file, if there have been changes
+// since it was last saved.
+func (c *Client) save() error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	entries := make(map[string]entry, len(c.entries))
+	for k, e := range c.entries {
+		entries[k] = e
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := writeSnapshot(c.path, snapshot{Version: fileVersion, Entries: entries}); err != nil {
+		// Try again next time
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// writeSnapshot replaces the file at the path given all at once, so
+// it's never left half-written.
+func writeSnapshot(path string, s snapshot) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,123 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type testKey string
+
+func (t testKey) Key() string {
+	return string(t)
+}
+
+func TestClient_ReadWrite(t *testing.T) {
+	c := NewClient(Config{})
+	defer c.Stop()
+
+	if _, _, err := c.GetKey(testKey("missing")); err != cache.ErrNotCached {
+		t.Errorf("expected ErrNotCached, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Minute).Round(time.Second)
+	if err := c.SetKey(testKey("key"), deadline, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	val, gotDeadline, err := c.GetKey(testKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "value" || !gotDeadline.Equal(deadline) {
+		t.Errorf("expected %q with deadline %s, got %q with deadline %s", "value", deadline, val, gotDeadline)
+	}
+
+	// Past its refresh deadline, the entry is still there to be used
+	// until it's refreshed; but once it has expired, it's gone
+	past := time.Now().Add(-time.Minute)
+	c.SetKey(testKey("stale"), past, []byte("stale"))
+	if _, _, err := c.GetKey(testKey("stale")); err != nil {
+		t.Errorf("expected a stale entry to be returned, got %v", err)
+	}
+	c.mu.Lock()
+	e := c.entries["stale"]
+	e.Expiry = past
+	c.entries["stale"] = e
+	c.mu.Unlock()
+	if _, _, err := c.GetKey(testKey("stale")); err != cache.ErrNotCached {
+		t.Errorf("expected ErrNotCached for an expired entry, got %v", err)
+	}
+	c.expire()
+	if _, ok := c.entries["stale"]; ok {
+		t.Error("expected the expired entry to be removed")
+	}
+}
+
+// Expired entries are removed even when there's no file to save to,
+// so the cache doesn't grow without bound.
+func TestClient_ExpireWithoutPath(t *testing.T) {
+	c := NewClient(Config{SaveInterval: 10 * time.Millisecond})
+	defer c.Stop()
+
+	past := time.Now().Add(-time.Minute)
+	c.SetKey(testKey("stale"), past, []byte("stale"))
+	c.mu.Lock()
+	e := c.entries["stale"]
+	e.Expiry = past
+	c.entries["stale"] = e
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.RLock()
+		_, ok := c.entries["stale"]
+		c.mu.RUnlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the expired entry to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_Persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache")
+
+	deadline := time.Now().Add(time.Minute).Round(time.Second)
+	c := NewClient(Config{Path: path, SaveInterval: time.Hour})
+	if err := c.SetKey(testKey("key"), deadline, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+
+	c = NewClient(Config{Path: path})
+	defer c.Stop()
+	val, gotDeadline, err := c.GetKey(testKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "value" || !gotDeadline.Equal(deadline) {
+		t.Errorf("expected %q with deadline %s, got %q with deadline %s", "value", deadline, val, gotDeadline)
+	}
+
+	// A file that can't be read is ignored
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c = NewClient(Config{Path: path})
+	defer c.Stop()
+	if _, _, err := c.GetKey(testKey("key")); err != cache.ErrNotCached {
+		t.Errorf("expected ErrNotCached after loading a bad file, got %v", err)
+	}
+}
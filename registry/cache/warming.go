@@ -91,14 +91,24 @@ func (w *Warmer) Loop(logger log.Logger, stop <-chan struct{}, wg *sync.WaitGrou
 
 	// NB the implicit contract here is that the prioritised
 	// image has to have been running the last time we
-	// requested the credentials.
+	// requested the credentials. The name may be given in a
+	// different form than that used in the cluster (e.g., from a
+	// registry webhook), so failing an exact match, an image with
+	// the same canonical name will do.
 	priorityWarm := func(name image.Name) {
 		logger.Log("priority", name.String())
 		if creds, ok := imageCreds[name]; ok {
 			w.warm(ctx, time.Now(), logger, name, creds)
-		} else {
-			logger.Log("priority", name.String(), "err", "no creds available")
+			return
+		}
+		canonical := name.CanonicalName()
+		for running, creds := range imageCreds {
+			if running.CanonicalName() == canonical {
+				w.warm(ctx, time.Now(), logger, running, creds)
+				return
+			}
 		}
+		logger.Log("priority", name.String(), "err", "no creds available")
 	}
 
 	// This loop acts keeps a kind of priority queue, whereby image
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"time"
@@ -76,6 +77,7 @@ type Remote struct {
 	transport http.RoundTripper
 	repo      image.CanonicalName
 	base      string
+	platform  Platform
 }
 
 // Adapt to docker distribution `reference.Named`.
@@ -114,6 +116,38 @@ func (a *Remote) Manifest(ctx context.Context, ref string) (ImageEntry, error) {
 	var manifestDigest digest.Digest
 	digestOpt := client.ReturnContentDigest(&manifestDigest)
 	manifest, fetchErr := manifests.Get(ctx, digest.Digest(ref), digestOpt, distribution.WithTagOption{ref})
+	platform := a.platform.orDefault()
+
+	// The image config gives the platform, as well as the creation
+	// time; it's referred to in the same way by Docker schema2 and
+	// OCI manifests.
+	fromConfig := func(info image.Info, configDigest digest.Digest) (ImageEntry, error) {
+		configBytes, err := repository.Blobs(ctx).Get(ctx, configDigest)
+		if err != nil {
+			return ImageEntry{}, err
+		}
+
+		var config struct {
+			Arch    string    `json:"architecture"`
+			Created time.Time `json:"created"`
+			OS      string    `json:"os"`
+			Variant string    `json:"variant"`
+			Config  struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"config"`
+		}
+		if err = json.Unmarshal(configBytes, &config); err != nil {
+			return ImageEntry{}, err
+		}
+		if !platform.matches(config.OS, config.Arch, config.Variant) {
+			return excluded(fmt.Sprintf("image is for %s, not %s", Platform{OS: config.OS, Arch: config.Arch, Variant: config.Variant}, platform)), nil
+		}
+		// This _is_ what Docker uses as its Image ID.
+		info.ImageID = configDigest.String()
+		info.CreatedAt = config.Created
+		info.Labels = config.Config.Labels
+		return ImageEntry{Info: info}, nil
+	}
 
 interpret:
 	if fetchErr != nil {
@@ -133,48 +167,53 @@ interpret:
 			Created time.Time `json:"created"`
 			OS      string    `json:"os"`
 			Arch    string    `json:"architecture"`
+			Config  struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"config"`
 		}
 
 		if err = json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err != nil {
 			return ImageEntry{}, err
 		}
+		if !platform.matches(v1.OS, v1.Arch, "") {
+			return excluded(fmt.Sprintf("image is for %s, not %s", Platform{OS: v1.OS, Arch: v1.Arch}, platform)), nil
+		}
 		// This is not the ImageID that Docker uses, but assumed to
 		// identify the image as it's the topmost layer.
 		info.ImageID = v1.ID
 		info.CreatedAt = v1.Created
+		info.Labels = v1.Config.Labels
 	case *schema2.DeserializedManifest:
-		var man schema2.Manifest = deserialised.Manifest
-		configBytes, err := repository.Blobs(ctx).Get(ctx, man.Config.Digest)
-		if err != nil {
-			return ImageEntry{}, err
-		}
-
-		var config struct {
-			Arch    string    `json:"architecture"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
-		}
-		if err = json.Unmarshal(configBytes, &config); err != nil {
-			return ImageEntry{}, err
-		}
-		// This _is_ what Docker uses as its Image ID.
-		info.ImageID = man.Config.Digest.String()
-		info.CreatedAt = config.Created
+		return fromConfig(info, deserialised.Manifest.Config.Digest)
+	case *ociManifest:
+		return fromConfig(info, deserialised.Config.Digest)
 	case *manifestlist.DeserializedManifestList:
 		var list manifestlist.ManifestList = deserialised.ManifestList
-		// TODO(michael): is it valid to just pick the first one that matches?
-		for _, m := range list.Manifests {
-			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
-				manifest, fetchErr = manifests.Get(ctx, m.Digest, digestOpt)
-				goto interpret
-			}
+		platforms := make([]platformDescriptor, len(list.Manifests))
+		for i, m := range list.Manifests {
+			platforms[i] = platformDescriptor{OS: m.Platform.OS, Arch: m.Platform.Architecture, Variant: m.Platform.Variant}
 		}
-		entry := ImageEntry{}
-		entry.ExcludedReason = "no suitable manifest (linux amd64) in manifestlist"
-		return entry, nil
+		if i, ok := platform.selectManifest(platforms); ok {
+			manifest, fetchErr = manifests.Get(ctx, list.Manifests[i].Digest, digestOpt)
+			goto interpret
+		}
+		return excluded(fmt.Sprintf("no image for %s in manifest list", platform)), nil
+	case *ociIndex:
+		if i, ok := platform.selectManifest(deserialised.platforms()); ok {
+			manifest, fetchErr = manifests.Get(ctx, deserialised.Manifests[i].Digest, digestOpt)
+			goto interpret
+		}
+		return excluded(fmt.Sprintf("no image for %s in image index", platform)), nil
 	default:
 		t := reflect.TypeOf(manifest)
 		return ImageEntry{}, errors.New("unknown manifest type: " + t.String())
 	}
 	return ImageEntry{Info: info}, nil
 }
+
+// excluded gives an entry for an image that can't be used, and why.
+func excluded(reason string) ImageEntry {
+	entry := ImageEntry{}
+	entry.ExcludedReason = reason
+	return entry
+}
@@ -25,6 +25,9 @@ type RemoteClientFactory struct {
 	// hosts with which to tolerate insecure connections (e.g., with
 	// TLS_INSECURE_SKIP_VERIFY, or as a fallback, using HTTP).
 	InsecureHosts []string
+	// the platform for which to choose images, when there are builds
+	// for several; if not given, DefaultPlatform
+	Platform Platform
 
 	mu               sync.Mutex
 	challengeManager challenge.Manager
@@ -141,7 +144,7 @@ func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credenti
 
 	// For the API base we want only the scheme and host.
 	registryURL.Path = ""
-	client := &Remote{transport: tx, repo: repo, base: registryURL.String()}
+	client := &Remote{transport: tx, repo: repo, base: registryURL.String(), platform: f.Platform}
 	return NewInstrumentedClient(client), nil
 }
 
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+type blob struct {
+	mediaType string
+	content   string
+}
+
+// fakeRegistry serves manifests (by tag or digest) and blobs (by
+// digest) for the repo weaveworks/helloworld.
+type fakeRegistry struct {
+	manifests map[string]blob
+	blobs     map[string]string
+}
+
+func (r *fakeRegistry) addManifest(mediaType, content string, tags ...string) digest.Digest {
+	d := digest.FromString(content)
+	r.manifests[d.String()] = blob{mediaType, content}
+	for _, tag := range tags {
+		r.manifests[tag] = blob{mediaType, content}
+	}
+	return d
+}
+
+func (r *fakeRegistry) addConfig(os, arch string) digest.Digest {
+	content := fmt.Sprintf(`{"architecture": %q, "os": %q, "created": "2019-01-02T15:04:05Z", "config": {"Labels": {"arch": %q}}}`, arch, os, arch)
+	d := digest.FromString(content)
+	r.blobs[d.String()] = content
+	return d
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const prefix = "/v2/weaveworks/helloworld/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	switch {
+	case strings.HasPrefix(path, "manifests/"):
+		m, ok := r.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromString(m.content).String())
+		fmt.Fprint(w, m.content)
+	case strings.HasPrefix(path, "blobs/"):
+		b, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		w.Header().Set("Docker-Content-Digest", digest.FromString(b).String())
+		if req.Method != http.MethodHead {
+			fmt.Fprint(w, b)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func imageManifest(mediaType string, config digest.Digest) string {
+	return fmt.Sprintf(`{"schemaVersion": 2, "mediaType": %q, "config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": %q, "size": 1}, "layers": []}`, mediaType, config)
+}
+
+func platformList(mediaType string, entries map[string]digest.Digest) string {
+	var manifests []string
+	for platform, d := range entries {
+		p, _ := ParsePlatform(platform)
+		manifests = append(manifests, fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "size": 1, "platform": {"os": %q, "architecture": %q, "variant": %q}}`, d, p.OS, p.Arch, p.Variant))
+	}
+	return fmt.Sprintf(`{"schemaVersion": 2, "mediaType": %q, "manifests": [%s]}`, mediaType, strings.Join(manifests, ", "))
+}
+
+func TestRemoteManifestPlatforms(t *testing.T) {
+	reg := &fakeRegistry{manifests: map[string]blob{}, blobs: map[string]string{}}
+	amd64Config, arm64Config := reg.addConfig("linux", "amd64"), reg.addConfig("linux", "arm64")
+
+	amd64 := reg.addManifest(mediaTypeOCIManifest, imageManifest(mediaTypeOCIManifest, amd64Config), "amd64-only")
+	arm64 := reg.addManifest(mediaTypeOCIManifest, imageManifest(mediaTypeOCIManifest, arm64Config))
+	reg.addManifest("application/vnd.docker.distribution.manifest.v2+json", imageManifest("application/vnd.docker.distribution.manifest.v2+json", arm64Config), "arm64-only")
+	reg.addManifest(mediaTypeOCIIndex, platformList(mediaTypeOCIIndex, map[string]digest.Digest{
+		"linux/amd64":    amd64,
+		"linux/arm64/v8": arm64,
+	}), "oci-index")
+	reg.addManifest("application/vnd.docker.distribution.manifest.list.v2+json", platformList("application/vnd.docker.distribution.manifest.list.v2+json", map[string]digest.Digest{
+		"linux/amd64": amd64,
+	}), "manifest-list")
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	name, err := image.ParseRef("example.com/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		platform Platform
+		tag      string
+		imageID  digest.Digest
+		excluded string
+	}{
+		{Platform{}, "oci-index", amd64Config, ""},
+		{Platform{}, "manifest-list", amd64Config, ""},
+		{Platform{}, "amd64-only", amd64Config, ""},
+		{Platform{}, "arm64-only", "", "image is for linux/arm64, not linux/amd64"},
+		{Platform{OS: "linux", Arch: "arm64"}, "oci-index", arm64Config, ""},
+		{Platform{OS: "linux", Arch: "arm64", Variant: "v8"}, "oci-index", arm64Config, ""},
+		{Platform{OS: "linux", Arch: "arm64"}, "manifest-list", "", "no image for linux/arm64 in manifest list"},
+		{Platform{OS: "linux", Arch: "arm64"}, "arm64-only", arm64Config, ""},
+		{Platform{OS: "linux", Arch: "arm", Variant: "v7"}, "oci-index", "", "no image for linux/arm/v7 in image index"},
+	} {
+		remote := &Remote{transport: http.DefaultTransport, repo: name.CanonicalName(), base: server.URL, platform: c.platform}
+		entry, err := remote.Manifest(context.Background(), c.tag)
+		if err != nil {
+			t.Errorf("%s for %s: %s", c.tag, c.platform, err)
+			continue
+		}
+		assert.Equal(t, c.excluded, entry.ExcludedReason, "%s for %s", c.tag, c.platform)
+		assert.Equal(t, c.imageID.String(), entry.ImageID, "%s for %s", c.tag, c.platform)
+		if c.excluded == "" {
+			assert.Equal(t, c.platform.orDefault().Arch, entry.Labels["arch"], "%s for %s", c.tag, c.platform)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for s, expected := range map[string]Platform{
+		"linux/amd64":  {OS: "linux", Arch: "amd64"},
+		"linux/arm/v7": {OS: "linux", Arch: "arm", Variant: "v7"},
+	} {
+		p, err := ParsePlatform(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p)
+		assert.Equal(t, s, p.String())
+	}
+	for _, s := range []string{"", "linux", "linux/", "/amd64", "linux/arm/v7/extra"} {
+		if _, err := ParsePlatform(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/ryanuber/go-glob"
+)
+
+// How long to let a credential helper run before giving up on it
+const credentialHelperTimeout = 30 * time.Second
+
+// CredentialHelper supplies credentials for the registry hosts that
+// match a glob, by running a command in the same way as Docker runs
+// its credential helpers: the command is given the argument `get`
+// and the host on stdin, and prints
+//
+//	{"ServerURL": "<host>", "Username": "<username>", "Secret": "<password>"}
+//
+// This means existing credential helpers (e.g., from a cloud
+// platform) can be used, as can a script that fetches short-lived
+// tokens from elsewhere (e.g., Vault).
+type CredentialHelper struct {
+	hostGlob string
+	command  []string
+	ttl      time.Duration
+	logger   log.Logger
+
+	mu     sync.Mutex
+	cached map[string]helperResult
+	// held while running the helper for a host, so it's run only
+	// once at a time for each host, without holding up other hosts
+	hostLocks map[string]*sync.Mutex
+}
+
+// helperResult is the outcome of running a credential helper for a
+// host, which is kept until it expires.
+type helperResult struct {
+	creds  creds
+	err    error
+	expiry time.Time
+}
+
+// NewCredentialHelper constructs a credential helper for the hosts
+// matching the glob, which runs the command given (and its
+// arguments, if any), and reuses its result (including any failure)
+// for the duration `ttl`.
+func NewCredentialHelper(hostGlob string, command []string, ttl time.Duration, logger log.Logger) *CredentialHelper {
+	return &CredentialHelper{
+		hostGlob:  hostGlob,
+		command:   command,
+		ttl:       ttl,
+		logger:    logger,
+		cached:    map[string]helperResult{},
+		hostLocks: map[string]*sync.Mutex{},
+	}
+}
+
+// ParseCredentialHelper constructs a credential helper from a spec
+// given as `<host-glob>=<command>`, where the command can include
+// arguments separated by spaces; e.g.,
+//
+//	*.registry.example.com=/usr/local/bin/registry-token --role flux
+func ParseCredentialHelper(spec string, ttl time.Duration, logger log.Logger) (*CredentialHelper, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("expected credential helper as <host-glob>=<command>, got %q", spec)
+	}
+	command := strings.Fields(parts[1])
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command given for credential helper for %q", parts[0])
+	}
+	return NewCredentialHelper(parts[0], command, ttl, logger), nil
+}
+
+func (h *CredentialHelper) String() string {
+	return fmt.Sprintf("%s=%s", h.hostGlob, strings.Join(h.command, " "))
+}
+
+func (h *CredentialHelper) Handles(host string) bool {
+	return glob.Glob(h.hostGlob, host)
+}
+
+func (h *CredentialHelper) Credentials(host string) (Credentials, error) {
+	hostLock := h.hostLock(host)
+	hostLock.Lock()
+	defer hostLock.Unlock()
+
+	now := time.Now()
+	h.mu.Lock()
+	result, ok := h.cached[host]
+	h.mu.Unlock()
+	if !ok || !result.expiry.After(now) {
+		cred, err := h.run(host)
+		if err != nil {
+			h.logger.Log("err", err, "host", host, "helper", h.command[0], "retry-after", h.ttl)
+		}
+		result = helperResult{creds: cred, err: err, expiry: now.Add(h.ttl)}
+		h.mu.Lock()
+		h.cached[host] = result
+		h.mu.Unlock()
+	}
+	if result.err != nil {
+		return Credentials{}, result.err
+	}
+	return Credentials{m: map[string]creds{host: result.creds}}, nil
+}
+
+func (h *CredentialHelper) hostLock(host string) *sync.Mutex {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.hostLocks[host]
+	if !ok {
+		l = &sync.Mutex{}
+		h.hostLocks[host] = l
+	}
+	return l
+}
+
+func (h *CredentialHelper) run(host string) (creds, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, h.command[1:]...), "get")
+	cmd := exec.CommandContext(ctx, h.command[0], args...)
+	cmd.Stdin = strings.NewReader(host)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return creds{}, fmt.Errorf("running credential helper: %s: %s", err, bytes.TrimSpace(exitErr.Stderr))
+		}
+		return creds{}, errors.Wrap(err, "running credential helper")
+	}
+
+	var response struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &response); err != nil {
+		return creds{}, errors.Wrap(err, "parsing output of credential helper")
+	}
+	// Docker uses this username to mean the secret is an identity
+	// token, to be exchanged for an access token with OAuth2
+	if response.Username == "<token>" {
+		return creds{}, errors.New("credential helper returned an identity token, which is not supported")
+	}
+	return creds{
+		registry:   host,
+		provenance: "credential helper " + h.command[0],
+		username:   response.Username,
+		password:   response.Secret,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeHelper writes a credential helper script that records each
+// time it's run, and returns the path of the script and of the
+// record.
+func writeHelper(t *testing.T, script string) (string, string, func()) {
+	dir, err := ioutil.TempDir("", "flux-credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper, record := filepath.Join(dir, "helper"), filepath.Join(dir, "runs")
+	script = "#!/bin/sh\necho \"$@ $(cat)\" >> " + record + "\n" + script
+	if err := ioutil.WriteFile(helper, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return helper, record, func() { os.RemoveAll(dir) }
+}
+
+func runs(t *testing.T, record string) []string {
+	bs, err := ioutil.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(bs)), "\n")
+}
+
+func TestCredentialHelper(t *testing.T) {
+	helper, record, cleanup := writeHelper(t, `echo '{"ServerURL": "registry.example.com", "Username": "flux", "Secret": "s3cr3t"}'`)
+	defer cleanup()
+
+	h, err := ParseCredentialHelper("*.example.com="+helper+" --role flux", time.Minute, log.NewNopLogger())
+	assert.NoError(t, err)
+	assert.True(t, h.Handles("registry.example.com"))
+	assert.False(t, h.Handles("registry.example.org"))
+
+	for i := 0; i < 2; i++ {
+		cs, err := h.Credentials("registry.example.com")
+		assert.NoError(t, err)
+		cred := cs.credsFor("registry.example.com")
+		assert.Equal(t, "flux", cred.username)
+		assert.Equal(t, "s3cr3t", cred.password)
+	}
+	// the credentials are reused until they expire
+	assert.Equal(t, []string{"--role flux get registry.example.com"}, runs(t, record))
+
+	h.cached["registry.example.com"] = helperResult{expiry: time.Now().Add(-time.Second)}
+	_, err = h.Credentials("registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(runs(t, record)))
+}
+
+func TestCredentialHelperFailure(t *testing.T) {
+	for _, script := range []string{
+		`echo "credentials not found in native keychain"; exit 1`,
+		`echo 'not JSON'`,
+		`echo '{"Username": "<token>", "Secret": "refresh-token"}'`,
+	} {
+		helper, record, cleanup := writeHelper(t, script)
+		h := NewCredentialHelper("*", []string{helper}, time.Minute, log.NewNopLogger())
+		for i := 0; i < 2; i++ {
+			_, err := h.Credentials("registry.example.com")
+			assert.Error(t, err, script)
+		}
+		// a failure is reused too, to avoid running the helper
+		// over and over
+		assert.Equal(t, 1, len(runs(t, record)), script)
+		cleanup()
+	}
+}
+
+// While the helper is running for one host, it can still be run for
+// others.
+func TestCredentialHelperConcurrentHosts(t *testing.T) {
+	// the record of runs is next to the script, and says which host
+	// it was run for
+	helper, record, cleanup := writeHelper(t, `case "$(tail -n1 "$(dirname "$0")/runs")" in *slow*) sleep 2;; esac
+echo '{"Username": "flux", "Secret": "s3cr3t"}'`)
+	defer cleanup()
+
+	h := NewCredentialHelper("*", []string{helper}, time.Minute, log.NewNopLogger())
+	slow := make(chan error)
+	go func() {
+		_, err := h.Credentials("slow.example.com")
+		slow <- err
+	}()
+	for {
+		if bs, _ := ioutil.ReadFile(record); strings.Contains(string(bs), "slow") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	_, err := h.Credentials("fast.example.com")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second, "expected the helper for another host not to wait")
+	assert.NoError(t, <-slow)
+}
+
+func TestParseCredentialHelper(t *testing.T) {
+	for _, spec := range []string{"", "*.example.com", "=helper", "*.example.com=", "*.example.com= "} {
+		if _, err := ParseCredentialHelper(spec, time.Minute, log.NewNopLogger()); err == nil {
+			t.Errorf("expected error parsing %q", spec)
+		}
+	}
+}
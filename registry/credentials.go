@@ -15,12 +15,27 @@ import (
 type creds struct {
 	username, password   string
 	registry, provenance string
+	// if a provider is given, the credentials are fetched from it
+	// when they are needed, rather than being given here
+	provider CredentialProvider
+}
+
+// isZero says whether the creds are empty. The fields are compared
+// one by one, rather than comparing with creds{}, since a provider
+// may be of a type that can't be compared.
+func (c creds) isZero() bool {
+	return c.username == "" && c.password == "" &&
+		c.registry == "" && c.provenance == "" &&
+		c.provider == nil
 }
 
 func (c creds) String() string {
-	if (creds{}) == c {
+	if c.isZero() {
 		return "<zero creds>"
 	}
+	if c.provider != nil {
+		return fmt.Sprintf("<registry creds for %s, from a provider>", c.registry)
+	}
 	return fmt.Sprintf("<registry creds for %s@%s, from %s>", c.username, c.registry, c.provenance)
 }
 
@@ -132,26 +147,60 @@ func ImageCredsWithDefaults(lookup func() ImageCreds, configPath string) (func()
 	}, nil
 }
 
+// CredentialProvider supplies credentials for image registry hosts
+// that don't have them otherwise, e.g., by asking a cloud platform
+// for a short-lived token.
+type CredentialProvider interface {
+	// Handles says whether the provider supplies credentials for the
+	// registry host.
+	Handles(host string) bool
+	// Credentials fetches credentials for the registry host. This is
+	// done each time they are needed, so a provider may want to keep
+	// them until they expire.
+	Credentials(host string) (Credentials, error)
+}
+
+// ImageCredsWithProviders wraps the lookup so that images from a
+// registry host with no credentials given are fetched using those of
+// the first provider that handles the host, if any. The provider is
+// asked for them only when they are used.
+func ImageCredsWithProviders(lookup func() ImageCreds, providers ...CredentialProvider) func() ImageCreds {
+	return func() ImageCreds {
+		imageCreds := lookup()
+		for name, cs := range imageCreds {
+			host := name.CanonicalName().Domain
+			if _, found := cs.m[host]; found {
+				continue
+			}
+			for _, provider := range providers {
+				if provider.Handles(host) {
+					newCreds := NoCredentials()
+					newCreds.Merge(cs)
+					newCreds.m[host] = creds{registry: host, provider: provider}
+					imageCreds[name] = newCreds
+					break
+				}
+			}
+		}
+		return imageCreds
+	}
+}
+
 // ---
 
 // credsFor yields an authenticator for a specific host.
 func (cs Credentials) credsFor(host string) creds {
-	if cred, found := cs.m[host]; found {
+	cred, found := cs.m[host]
+	if !found || cred.provider == nil {
 		return cred
 	}
-	if host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") {
-		if cred, err := GetGCPOauthToken(host); err == nil {
-			return cred
-		}
+	// Any problem is left to the provider to report; without
+	// credentials, the registry may still allow anonymous access.
+	provided, err := cred.provider.Credentials(host)
+	if err != nil {
+		return creds{}
 	}
-
-    if hostIsAzureContainerRegistry(host) {
-        if cred, err := getAzureCloudConfigAADToken(host); err == nil {
-            return cred
-        }
-    }
-
-	return creds{}
+	return provided.m[host]
 }
 
 // Hosts returns all of the hosts available in these credentials.
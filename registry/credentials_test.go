@@ -3,10 +3,13 @@ package registry
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
 )
 
 var (
@@ -118,3 +121,75 @@ func TestStringShouldNotLeakPasswords(t *testing.T) {
 	assert.Equal(t, "{map[localhost:5000:<registry creds for testuser@localhost:5000, from test>]}", fmt.Sprintf("%v", c)) // In comparison standard String() method typically yields: "{map[localhost:5000:{testuser testpassword localhost:5000 test}]}".
 	assert.Equal(t, "testpassword", c.credsFor("localhost:5000").password, "Password is incorrect")                        // Actual password is left untouched.
 }
+
+type fakeProvider struct {
+	suffix   string
+	username string
+	fetched  int
+}
+
+func (p *fakeProvider) Handles(host string) bool {
+	return strings.HasSuffix(host, p.suffix)
+}
+
+func (p *fakeProvider) Credentials(host string) (Credentials, error) {
+	p.fetched++
+	return Credentials{m: map[string]creds{host: {registry: host, username: p.username, password: pass}}}, nil
+}
+
+func TestImageCredsWithProviders(t *testing.T) {
+	secret, err := ParseCredentials("secret", []byte(fmt.Sprintf(tmpl, "secret.example.com", okCreds)))
+	assert.NoError(t, err)
+	lookup := func() ImageCreds {
+		imageCreds := ImageCreds{}
+		for _, s := range []string{"secret.example.com/app", "one.example.com/app", "two.example.com/app", "other.io/app"} {
+			ref, err := image.ParseRef(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imageCreds[ref.Name] = secret
+		}
+		return imageCreds
+	}
+
+	first := &fakeProvider{suffix: "one.example.com", username: "first"}
+	second := &fakeProvider{suffix: ".example.com", username: "second"}
+	imageCreds := ImageCredsWithProviders(lookup, first, second)()
+	assert.Equal(t, 0, first.fetched+second.fetched, "credentials should not be fetched until used")
+
+	for name, cs := range imageCreds {
+		host := name.CanonicalName().Domain
+		expected := map[string]string{
+			"secret.example.com": user,
+			"one.example.com":    "first",
+			"two.example.com":    "second",
+			"other.io":           "",
+		}[host]
+		assert.Equal(t, expected, cs.credsFor(host).username, host)
+		// the credentials from the image pull secret are still there
+		assert.Equal(t, user, cs.credsFor("secret.example.com").username, host)
+	}
+	assert.Equal(t, 1, first.fetched)
+	assert.Equal(t, 1, second.fetched)
+}
+
+// A provider that can't be compared with ==
+type mapProvider map[string]string
+
+func (p mapProvider) Handles(host string) bool {
+	_, ok := p[host]
+	return ok
+}
+
+func (p mapProvider) Credentials(host string) (Credentials, error) {
+	return Credentials{m: map[string]creds{host: {registry: host, username: p[host], password: pass}}}, nil
+}
+
+func TestCredsWithUncomparableProvider(t *testing.T) {
+	provider := mapProvider{"registry.example.com": "provided"}
+	c := creds{registry: "registry.example.com", provider: provider}
+	assert.False(t, c.isZero())
+	assert.Equal(t, "<registry creds for registry.example.com, from a provider>", c.String())
+	assert.True(t, creds{}.isZero())
+	assert.Equal(t, "<zero creds>", creds{}.String())
+}
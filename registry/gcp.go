@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 const (
@@ -16,6 +17,23 @@ type gceToken struct {
 	TokenType   string `json:"token_type"`
 }
 
+// GCPCredentialProvider supplies credentials for Google Container
+// Registry, using a token for the default service account from the
+// metadata service, when running in GCP.
+type GCPCredentialProvider struct{}
+
+func (GCPCredentialProvider) Handles(host string) bool {
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io")
+}
+
+func (GCPCredentialProvider) Credentials(host string) (Credentials, error) {
+	cred, err := GetGCPOauthToken(host)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{m: map[string]creds{host: cred}}, nil
+}
+
 func GetGCPOauthToken(host string) (creds, error) {
 	request, err := http.NewRequest("GET", gcpDefaultTokenURL, nil)
 	if err != nil {
@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+// The version of docker/distribution we use predates its support for
+// OCI media types, so the manifests and indexes are decoded here.
+const (
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+)
+
+func init() {
+	// The only error is that the media type is already registered,
+	// which would mean docker/distribution has been updated to a
+	// version that decodes these itself; its types would then need
+	// handling in (*Remote).Manifest, so fail loudly rather than
+	// quietly fail to decode the manifests.
+	for mediaType, unmarshal := range map[string]distribution.UnmarshalFunc{
+		mediaTypeOCIManifest: unmarshalOCIManifest,
+		mediaTypeOCIIndex:    unmarshalOCIIndex,
+	} {
+		if err := distribution.RegisterManifestSchema(mediaType, unmarshal); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ociManifest is an OCI image manifest, which refers to the image
+// config and layers in the same way as a Docker schema2 manifest.
+type ociManifest struct {
+	Config distribution.Descriptor   `json:"config"`
+	Layers []distribution.Descriptor `json:"layers"`
+
+	canonical []byte
+}
+
+func (m *ociManifest) References() []distribution.Descriptor {
+	return append([]distribution.Descriptor{m.Config}, m.Layers...)
+}
+
+func (m *ociManifest) Payload() (string, []byte, error) {
+	return mediaTypeOCIManifest, m.canonical, nil
+}
+
+func unmarshalOCIManifest(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+	m := &ociManifest{canonical: b}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, distribution.Descriptor{}, err
+	}
+	if m.Config.Digest == "" {
+		return nil, distribution.Descriptor{}, errors.New("OCI image manifest has no config")
+	}
+	return m, descriptorOf(mediaTypeOCIManifest, b), nil
+}
+
+// ociIndexEntry is an entry in an OCI image index; usually, the
+// manifest of the image for a particular platform.
+type ociIndexEntry struct {
+	distribution.Descriptor
+	Platform *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// ociIndex is an OCI image index, which is the OCI equivalent of a
+// Docker manifest list.
+type ociIndex struct {
+	Manifests []ociIndexEntry `json:"manifests"`
+
+	canonical []byte
+}
+
+func (m *ociIndex) References() []distribution.Descriptor {
+	refs := make([]distribution.Descriptor, len(m.Manifests))
+	for i := range m.Manifests {
+		refs[i] = m.Manifests[i].Descriptor
+	}
+	return refs
+}
+
+func (m *ociIndex) Payload() (string, []byte, error) {
+	return mediaTypeOCIIndex, m.canonical, nil
+}
+
+// platforms gives the platform of each entry in the index. Entries
+// without a platform are given an empty one, so they won't be
+// selected; these are usually not images (e.g., attestations).
+func (m *ociIndex) platforms() []platformDescriptor {
+	platforms := make([]platformDescriptor, len(m.Manifests))
+	for i, e := range m.Manifests {
+		if e.Platform != nil {
+			platforms[i] = platformDescriptor{OS: e.Platform.OS, Arch: e.Platform.Architecture, Variant: e.Platform.Variant}
+		}
+	}
+	return platforms
+}
+
+func unmarshalOCIIndex(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+	m := &ociIndex{canonical: b}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, distribution.Descriptor{}, err
+	}
+	return m, descriptorOf(mediaTypeOCIIndex, b), nil
+}
+
+func descriptorOf(mediaType string, b []byte) distribution.Descriptor {
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+	}
+}
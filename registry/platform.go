@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Platform is the operating system and CPU architecture (and
+// optionally, the variant of the architecture, e.g., "v7" for arm)
+// that images must be built for, to be used. When an image tag has
+// builds for several platforms, the one for this platform is used.
+type Platform struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// DefaultPlatform is the platform used unless another is given.
+var DefaultPlatform = Platform{OS: "linux", Arch: "amd64"}
+
+// ParsePlatform parses a platform given as `<os>/<arch>` or
+// `<os>/<arch>/<variant>`, e.g., "linux/arm64" or "linux/arm/v7".
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+			break
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return Platform{OS: parts[0], Arch: parts[1]}, nil
+	case 3:
+		return Platform{OS: parts[0], Arch: parts[1], Variant: parts[2]}, nil
+	}
+	return Platform{}, fmt.Errorf("expected platform as <os>/<arch> or <os>/<arch>/<variant>, got %q", s)
+}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Arch
+	}
+	return p.OS + "/" + p.Arch + "/" + p.Variant
+}
+
+// orDefault gives the platform, or the default platform if it's the
+// zero value.
+func (p Platform) orDefault() Platform {
+	if p == (Platform{}) {
+		return DefaultPlatform
+	}
+	return p
+}
+
+// matches says whether an image built for the OS, architecture and
+// variant given can be used on this platform. An unknown OS or
+// architecture (e.g., from an image config that doesn't say) is
+// assumed to match; and so is a missing variant, since images are
+// often built for an architecture without saying which variant.
+func (p Platform) matches(os, arch, variant string) bool {
+	return (os == "" || os == p.OS) &&
+		(arch == "" || arch == p.Arch) &&
+		(variant == "" || p.Variant == "" || variant == p.Variant)
+}
+
+// platformDescriptor is the platform of an entry in a manifest list
+// or image index.
+type platformDescriptor struct {
+	OS, Arch, Variant string
+}
+
+// selectManifest chooses the entry of a manifest list or image index
+// for the platform, preferring an exact match of the variant, or
+// returns false if there is none.
+func (p Platform) selectManifest(entries []platformDescriptor) (int, bool) {
+	found := -1
+	for i, e := range entries {
+		if e.OS != p.OS || e.Arch != p.Arch || !p.matches(e.OS, e.Arch, e.Variant) {
+			continue
+		}
+		if e.Variant == p.Variant {
+			return i, true
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found, found >= 0
+}
@@ -41,6 +41,16 @@ func (rc *ReleaseContext) LoadManifests() (map[string]resource.Resource, error)
 func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate) error {
 	err := func() error {
 		for _, update := range updates {
+			if g, ok := rc.manifests.(cluster.GeneratedManifests); ok && g.IsGenerated(update.ManifestPath) {
+				// There's no file to edit; the generator config
+				// says how to make the change instead.
+				for _, container := range update.Updates {
+					if err := g.SetWorkloadContainerImage(update.ManifestPath, update.ResourceID, container.Container, container.Target); err != nil {
+						return err
+					}
+				}
+				continue
+			}
 			manifestBytes, err := ioutil.ReadFile(update.ManifestPath)
 			if err != nil {
 				return err
@@ -79,6 +89,15 @@ func (rc *ReleaseContext) SelectServices(results update.Result, prefilters, post
 	var toAskClusterAbout []flux.ResourceID
 	for _, s := range allDefined {
 		res := s.Filter(prefilters...)
+		if res.Error == "" && rc.repo.InSubmodule(s.Resource.Source()) {
+			// The manifest can't be changed by committing to the
+			// repo, so there's no point going further.
+			results[s.ResourceID] = update.ControllerResult{
+				Status: update.ReleaseStatusSkipped,
+				Error:  update.InSubmodule,
+			}
+			continue
+		}
 		if res.Error == "" {
 			// Give these a default value, in case we don't find them
 			// in the cluster.
@@ -0,0 +1,198 @@
+package release
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// promotion is a ReleaseContainersSpec worked out from a PromoteSpec,
+// which it otherwise stands in for.
+type promotion struct {
+	update.ReleaseContainersSpec
+	spec update.PromoteSpec
+	// results for the workloads that were not matched, so cannot be
+	// promoted
+	skipped update.Result
+}
+
+func (p promotion) CalculateRelease(rc update.ReleaseContext, logger log.Logger) ([]*update.ControllerUpdate, update.Result, error) {
+	updates, results, err := p.ReleaseContainersSpec.CalculateRelease(rc, logger)
+	for id, res := range p.skipped {
+		if _, ok := results[id]; !ok {
+			results[id] = res
+		}
+	}
+	return updates, results, err
+}
+
+func (p promotion) ReleaseType() update.ReleaseType {
+	return p.spec.ReleaseType()
+}
+
+func (p promotion) CommitMessage(result update.Result) string {
+	return p.spec.CommitMessage(result)
+}
+
+// Promotion works out the changes that will promote the images used
+// by the workloads defined under the path `spec.From` to the
+// matching workloads defined under `spec.To`. A workload matches if
+// it has the same ID, or failing that, the same kind and name; and
+// each container is given the image of the container with the same
+// name.
+func Promotion(rc *ReleaseContext, spec update.PromoteSpec) (Changes, error) {
+	for _, path := range []string{spec.From, spec.To} {
+		if path == "" || !isUnder(path, ".") {
+			return nil, fmt.Errorf("%q is not a path within the git repo", path)
+		}
+	}
+	if filepath.Clean(spec.From) == filepath.Clean(spec.To) {
+		return nil, fmt.Errorf("cannot promote from %q to itself", spec.From)
+	}
+
+	toDir := filepath.Join(rc.repo.Dir(), spec.To)
+	var synced bool
+	for _, dir := range rc.repo.ManifestDirs() {
+		if isUnder(toDir, dir) {
+			synced = true
+			break
+		}
+	}
+	if !synced {
+		return nil, fmt.Errorf("%q is not among the paths synced by this daemon, so cannot be promoted to", spec.To)
+	}
+
+	// One path may contain the other (e.g., when promoting from a
+	// directory to the top of the repo), in which case it's only the
+	// workloads outside the inner path that count.
+	sources, err := rc.workloadsUnder(spec.From, spec.To)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := rc.workloadsUnder(spec.To, spec.From)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []flux.ResourceID
+	all := len(spec.Workloads) == 0
+	for _, ws := range spec.Workloads {
+		if ws == update.ResourceSpecAll {
+			all = true
+			continue
+		}
+		id, err := ws.AsID()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sources[id]; !ok {
+			return nil, fmt.Errorf("workload %s is not defined under %q", id, spec.From)
+		}
+		selected = append(selected, id)
+	}
+	if all {
+		selected = nil
+		for id := range sources {
+			selected = append(selected, id)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].String() < selected[j].String() })
+
+	byKindName := map[string][]flux.ResourceID{}
+	for id := range targets {
+		byKindName[kindName(id)] = append(byKindName[kindName(id)], id)
+	}
+
+	containerSpecs := map[flux.ResourceID][]update.ContainerUpdate{}
+	promotedFrom := map[flux.ResourceID]flux.ResourceID{}
+	skipped := update.Result{}
+	for _, id := range selected {
+		target := id
+		if _, ok := targets[id]; !ok {
+			candidates := byKindName[kindName(id)]
+			switch len(candidates) {
+			case 0:
+				skipped[id] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
+					Error:  fmt.Sprintf("not defined under %q", spec.To),
+				}
+				continue
+			case 1:
+				target = candidates[0]
+			default:
+				return nil, fmt.Errorf("workload %s could be promoted to any of %d workloads under %q", id, len(candidates), spec.To)
+			}
+		}
+		if other, ok := promotedFrom[target]; ok {
+			return nil, fmt.Errorf("workloads %s and %s would both be promoted to %s", other, id, target)
+		}
+		promotedFrom[target] = id
+
+		targetContainers := map[string]bool{}
+		for _, c := range targets[target].Containers() {
+			targetContainers[c.Name] = true
+		}
+		for _, c := range sources[id].Containers() {
+			if targetContainers[c.Name] {
+				containerSpecs[target] = append(containerSpecs[target], update.ContainerUpdate{
+					Container: c.Name,
+					Target:    c.Image,
+				})
+			}
+		}
+	}
+
+	if len(containerSpecs) == 0 {
+		return nil, fmt.Errorf("no workloads under %q match those under %q", spec.To, spec.From)
+	}
+
+	return promotion{
+		ReleaseContainersSpec: update.ReleaseContainersSpec{
+			Kind:           spec.Kind,
+			ContainerSpecs: containerSpecs,
+			Force:          spec.Force,
+		},
+		spec:    spec,
+		skipped: skipped,
+	}, nil
+}
+
+// workloadsUnder loads the workloads defined in the manifests under
+// the path given, leaving out those under the path `except` if it is
+// within the first path. Both paths are relative to the top of the
+// repo.
+func (rc *ReleaseContext) workloadsUnder(path, except string) (map[flux.ResourceID]resource.Workload, error) {
+	resources, err := rc.manifests.LoadManifests(rc.repo.Dir(), []string{filepath.Join(rc.repo.Dir(), path)})
+	if err != nil {
+		return nil, err
+	}
+	nested := isUnder(except, path)
+	workloads := map[flux.ResourceID]resource.Workload{}
+	for _, res := range resources {
+		if nested && isUnder(res.Source(), except) {
+			continue
+		}
+		if wl, ok := res.(resource.Workload); ok {
+			workloads[res.ResourceID()] = wl
+		}
+	}
+	return workloads, nil
+}
+
+func kindName(id flux.ResourceID) string {
+	_, kind, name := id.Components()
+	return kind + "/" + name
+}
+
+// isUnder says whether path is the same as, or within, dir.
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
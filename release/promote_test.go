@@ -0,0 +1,131 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+const stagingHelloworld = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: staging
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000002
+      - name: sidecar
+        image: weaveworks/sidecar:master-a000002
+      - name: staging-only
+        image: weaveworks/debug:1
+`
+
+const stagingOther = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: staging-only
+  namespace: staging
+spec:
+  template:
+    spec:
+      containers:
+      - name: other
+        image: weaveworks/other:1
+`
+
+func Test_Promotion(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+	stagingDir := filepath.Join(checkout.Dir(), "staging")
+	if err := os.Mkdir(stagingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"helloworld-deploy.yaml": stagingHelloworld,
+		"other-deploy.yaml":      stagingOther,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(stagingDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := &ReleaseContext{
+		cluster:   mockCluster(hwSvc, lockedSvc),
+		manifests: mockManifests,
+		repo:      checkout,
+		registry:  mockRegistry,
+	}
+
+	// The staging workload matches the workload in the default
+	// namespace, by kind and name
+	spec := update.PromoteSpec{
+		From:      "staging",
+		To:        ".",
+		Workloads: []update.ResourceSpec{update.ResourceSpecAll},
+		Kind:      update.ReleaseKindExecute,
+	}
+	changes, err := Promotion(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Release(ctx, changes, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, update.ControllerResult{
+		Status: update.ReleaseStatusSuccess,
+		PerContainer: []update.ContainerUpdate{
+			{Container: helloContainer, Target: newHwRef},
+			{Container: sidecarContainer, Target: newSidecarRef},
+		},
+	}, results[hwSvcID])
+	assert.Equal(t, update.ReleaseStatusSkipped, results[flux.MustParseResourceID("staging:deployment/staging-only")].Status)
+	assert.Equal(t, "promote", string(changes.ReleaseType()))
+	assert.Equal(t, "Promote images from staging to .\n\ndefault:deployment/helloworld\n- quay.io/weaveworks/helloworld:master-a000002\n- weaveworks/sidecar:master-a000002\n", changes.CommitMessage(results))
+
+	// The manifest in the top directory now has the staging images
+	written, err := ioutil.ReadFile(filepath.Join(checkout.Dir(), "helloworld-deploy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(written), "image: quay.io/weaveworks/helloworld:master-a000002")
+	assert.Contains(t, string(written), "image: weaveworks/sidecar:master-a000002")
+}
+
+func Test_PromotionErrors(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+	ctx := &ReleaseContext{
+		cluster:   mockCluster(hwSvc),
+		manifests: mockManifests,
+		repo:      checkout,
+		registry:  mockRegistry,
+	}
+
+	for _, spec := range []update.PromoteSpec{
+		{From: "", To: "."},
+		{From: "../elsewhere", To: "."},
+		{From: ".", To: "/tmp"},
+		{From: "test", To: "test/"},
+		// the test-service workload is not defined under test
+		{From: "test", To: ".", Workloads: []update.ResourceSpec{update.MakeResourceSpec(hwSvcID)}},
+		// nothing defined under test matches workloads elsewhere
+		{From: "test", To: "."},
+	} {
+		if _, err := Promotion(ctx, spec); err == nil {
+			t.Errorf("expected an error promoting from %q to %q", spec.From, spec.To)
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
@@ -90,6 +92,24 @@ func (p *ErrorLoggingServer) SyncStatus(ctx context.Context, ref string) (_ []st
 	return p.server.SyncStatus(ctx, ref)
 }
 
+func (p *ErrorLoggingServer) SyncDryRun(ctx context.Context) (_ []cluster.ResourceChange, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "SyncDryRun", "error", err)
+		}
+	}()
+	return p.server.SyncDryRun(ctx)
+}
+
+func (p *ErrorLoggingServer) ListResources(ctx context.Context, namespace string) (_ []v12.ResourceStatus, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ListResources", "error", err)
+		}
+	}()
+	return p.server.ListResources(ctx, namespace)
+}
+
 func (p *ErrorLoggingServer) UpdateManifests(ctx context.Context, u update.Spec) (_ job.ID, err error) {
 	defer func() {
 		if err != nil {
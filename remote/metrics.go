@@ -11,8 +11,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/update"
@@ -118,6 +120,26 @@ func (i *instrumentedServer) SyncStatus(ctx context.Context, cursor string) (_ [
 	return i.s.SyncStatus(ctx, cursor)
 }
 
+func (i *instrumentedServer) SyncDryRun(ctx context.Context) (_ []cluster.ResourceChange, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "SyncDryRun",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.SyncDryRun(ctx)
+}
+
+func (i *instrumentedServer) ListResources(ctx context.Context, namespace string) (_ []v12.ResourceStatus, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ListResources",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.ListResources(ctx, namespace)
+}
+
 func (i *instrumentedServer) GitRepoConfig(ctx context.Context, regenerate bool) (_ v6.GitConfig, err error) {
 	defer func(begin time.Time) {
 		requestDuration.With(
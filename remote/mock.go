@@ -12,8 +12,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
@@ -44,6 +46,12 @@ type MockServer struct {
 	SyncStatusAnswer []string
 	SyncStatusError  error
 
+	SyncDryRunAnswer []cluster.ResourceChange
+	SyncDryRunError  error
+
+	ListResourcesAnswer []v12.ResourceStatus
+	ListResourcesError  error
+
 	JobStatusAnswer job.Status
 	JobStatusError  error
 
@@ -96,6 +104,14 @@ func (p *MockServer) SyncStatus(context.Context, string) ([]string, error) {
 	return p.SyncStatusAnswer, p.SyncStatusError
 }
 
+func (p *MockServer) SyncDryRun(context.Context) ([]cluster.ResourceChange, error) {
+	return p.SyncDryRunAnswer, p.SyncDryRunError
+}
+
+func (p *MockServer) ListResources(context.Context, string) ([]v12.ResourceStatus, error) {
+	return p.ListResourcesAnswer, p.ListResourcesError
+}
+
 func (p *MockServer) JobStatus(context.Context, job.ID) (job.Status, error) {
 	return p.JobStatusAnswer, p.JobStatusError
 }
@@ -158,6 +174,34 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 		"commit 3",
 	}
 
+	syncDryRunAnswer := []cluster.ResourceChange{
+		{
+			ID:     flux.MustParseResourceID("foobar:deployment/hello"),
+			Type:   cluster.SyncUpdate,
+			Source: "hello.yaml",
+			Fields: []cluster.FieldChange{
+				{Path: "spec.replicas", Old: "1", New: "2"},
+			},
+		},
+		{
+			ID:   flux.MustParseResourceID("foobar:service/hello"),
+			Type: cluster.SyncDelete,
+		},
+	}
+
+	listResourcesAnswer := []v12.ResourceStatus{
+		{
+			ID:                  flux.MustParseResourceID("foobar:deployment/hello"),
+			Source:              "hello.yaml",
+			LastAppliedRevision: "abc123",
+		},
+		{
+			ID:        flux.MustParseResourceID("foobar:configmap/hello"),
+			Source:    "hello.yaml",
+			SyncError: "invalid configmap",
+		},
+	}
+
 	updateSpec := update.Spec{
 		Type: update.Images,
 		Spec: update.ReleaseImageSpec{
@@ -180,6 +224,8 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 		UpdateManifestsArgTest: checkUpdateSpec,
 		UpdateManifestsAnswer:  job.ID(guid.New()),
 		SyncStatusAnswer:       syncStatusAnswer,
+		SyncDryRunAnswer:       syncDryRunAnswer,
+		ListResourcesAnswer:    listResourcesAnswer,
 	}
 
 	ctx := context.Background()
@@ -244,4 +290,27 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 	if !reflect.DeepEqual(mock.SyncStatusAnswer, syncSt) {
 		t.Errorf("expected: %#v\ngot: %#v", mock.SyncStatusAnswer, syncSt)
 	}
+	changes, err := client.SyncDryRun(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.SyncDryRunAnswer, changes) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.SyncDryRunAnswer, changes)
+	}
+	mock.SyncDryRunError = fmt.Errorf("sync dry run error")
+	if _, err = client.SyncDryRun(ctx); err == nil {
+		t.Error("expected error from SyncDryRun, got nil")
+	}
+
+	resources, err := client.ListResources(ctx, "foobar")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.ListResourcesAnswer, resources) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.ListResourcesAnswer, resources)
+	}
+	mock.ListResourcesError = fmt.Errorf("list resources error")
+	if _, err = client.ListResources(ctx, "foobar"); err == nil {
+		t.Error("expected error from ListResources, got nil")
+	}
 }
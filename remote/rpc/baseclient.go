@@ -8,8 +8,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/update"
@@ -64,6 +66,14 @@ func (bc baseClient) SyncStatus(context.Context, string) ([]string, error) {
 	return nil, remote.UpgradeNeededError(errors.New("SyncStatus method not implemented"))
 }
 
+func (bc baseClient) SyncDryRun(context.Context) ([]cluster.ResourceChange, error) {
+	return nil, remote.UpgradeNeededError(errors.New("SyncDryRun method not implemented"))
+}
+
+func (bc baseClient) ListResources(context.Context, string) ([]v12.ResourceStatus, error) {
+	return nil, remote.UpgradeNeededError(errors.New("ListResources method not implemented"))
+}
+
 func (bc baseClient) GitRepoConfig(context.Context, bool) (v6.GitConfig, error) {
 	return v6.GitConfig{}, remote.UpgradeNeededError(errors.New("GitRepoConfig method not implemented"))
 }
@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+
+	"github.com/weaveworks/flux/api/v12"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/remote"
+)
+
+// RPCClientV12 is the rpc-backed implementation of a server, for
+// talking to remote daemons. This version introduces SyncDryRun and
+// ListResources.
+type RPCClientV12 struct {
+	*RPCClientV11
+}
+
+type clientV12 interface {
+	v12.Server
+	v12.Upstream
+}
+
+var _ clientV12 = &RPCClientV12{}
+
+// NewClientV12 creates a new rpc-backed implementation of the server.
+func NewClientV12(conn io.ReadWriteCloser) *RPCClientV12 {
+	return &RPCClientV12{NewClientV11(conn)}
+}
+
+func (p *RPCClientV12) SyncDryRun(ctx context.Context) ([]cluster.ResourceChange, error) {
+	var resp SyncDryRunResponse
+	err := p.client.Call("RPCServer.SyncDryRun", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) ListResources(ctx context.Context, namespace string) ([]v12.ResourceStatus, error) {
+	var resp ListResourcesResponse
+	err := p.client.Call("RPCServer.ListResources", namespace, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
@@ -7,12 +7,14 @@ import (
 	"net/rpc/jsonrpc"
 
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v12"
 
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
@@ -196,3 +198,37 @@ func (p *RPCServer) GitRepoConfig(regenerate bool, resp *GitRepoConfigResponse)
 	}
 	return err
 }
+
+type SyncDryRunResponse struct {
+	Result           []cluster.ResourceChange
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) SyncDryRun(_ struct{}, resp *SyncDryRunResponse) error {
+	v, err := p.s.SyncDryRun(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type ListResourcesResponse struct {
+	Result           []v12.ResourceStatus
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) ListResources(namespace string, resp *ListResourcesResponse) error {
+	v, err := p.s.ListResources(context.Background(), namespace)
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
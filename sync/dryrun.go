@@ -0,0 +1,179 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+// DryRun works out the same sync definition as Sync would, but
+// rather than applying it, describes the change each action would
+// make to the cluster. Resources that would be applied without
+// changing anything are not included.
+func DryRun(logger log.Logger, m cluster.Manifests, syncSetName string, repoResources map[string]resource.Resource, clus cluster.Cluster,
+	deletes bool) ([]cluster.ResourceChange, error) {
+	return DryRunSets(logger, m, []SyncSet{{Name: syncSetName, Resources: repoResources}}, clus, deletes)
+}
+
+// DryRunSets is DryRun for several sync sets at once, as given to
+// SyncSets.
+func DryRunSets(logger log.Logger, m cluster.Manifests, syncSets []SyncSet, clus cluster.Cluster,
+	deletes bool) ([]cluster.ResourceChange, error) {
+	sync, clusterResources, err := prepareSync(logger, m, syncSets, clus, deletes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only some kinds of resource are exported from the cluster; if a
+	// kind doesn't appear at all, we can't say whether a resource of
+	// that kind would be created or updated.
+	exportedKinds := map[string]bool{}
+	for _, res := range clusterResources {
+		_, kind, _ := res.ResourceID().Components()
+		exportedKinds[kind] = true
+	}
+
+	var changes []cluster.ResourceChange
+	for _, action := range sync.Actions {
+		if action.Delete != nil {
+			changes = append(changes, cluster.ResourceChange{
+				ID:     action.Delete.ResourceID(),
+				Type:   cluster.SyncDelete,
+				Source: action.Delete.Source(),
+			})
+		}
+		if action.Apply == nil {
+			continue
+		}
+		res := action.Apply
+		change := cluster.ResourceChange{
+			ID:     res.ResourceID(),
+			Source: res.Source(),
+		}
+		cres, ok := clusterResources[res.ResourceID().String()]
+		switch {
+		case ok:
+			fields, err := diffDefinitions(cres.Bytes(), res.Bytes())
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("comparing %s with the cluster", res.ResourceID()))
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			change.Type = cluster.SyncUpdate
+			change.Fields = fields
+		default:
+			_, kind, _ := res.ResourceID().Components()
+			if exportedKinds[kind] {
+				change.Type = cluster.SyncCreate
+			} else {
+				change.Type = cluster.SyncApply
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID.String() < changes[j].ID.String()
+	})
+	return changes, nil
+}
+
+// diffDefinitions compares the fields given in a definition from the
+// repo with those of the same resource as exported from the
+// cluster. Only fields that appear in the repo definition are
+// considered, since the exported definition will include defaulted
+// and read-only fields (like `status`) that are not the business of
+// the repo.
+func diffDefinitions(clusterDef, repoDef []byte) ([]cluster.FieldChange, error) {
+	var clusterObj, repoObj map[string]interface{}
+	if err := k8syaml.Unmarshal(clusterDef, &clusterObj); err != nil {
+		return nil, errors.Wrap(err, "parsing exported definition")
+	}
+	if err := k8syaml.Unmarshal(repoDef, &repoObj); err != nil {
+		return nil, errors.Wrap(err, "parsing definition from repo")
+	}
+	// The API version a resource is defined with is not part of the
+	// resource as such, so it's not a change.
+	delete(repoObj, "apiVersion")
+
+	var changes []cluster.FieldChange
+	diffValues("", clusterObj, repoObj, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, old, new interface{}, changes *[]cluster.FieldChange) {
+	switch newVal := new.(type) {
+	case map[string]interface{}:
+		oldVal, ok := old.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var keys []string
+		for k := range newVal {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if o, ok := oldVal[k]; ok {
+				diffValues(p, o, newVal[k], changes)
+			} else {
+				*changes = append(*changes, fieldChange(p, nil, newVal[k]))
+			}
+		}
+		return
+	case []interface{}:
+		oldVal, ok := old.([]interface{})
+		if !ok {
+			break
+		}
+		for i := range newVal {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if i < len(oldVal) {
+				diffValues(p, oldVal[i], newVal[i], changes)
+			} else {
+				*changes = append(*changes, fieldChange(p, nil, newVal[i]))
+			}
+		}
+		for i := len(newVal); i < len(oldVal); i++ {
+			*changes = append(*changes, fieldChange(fmt.Sprintf("%s[%d]", path, i), oldVal[i], nil))
+		}
+		return
+	default:
+		if reflect.DeepEqual(old, new) {
+			return
+		}
+	}
+	*changes = append(*changes, fieldChange(path, old, new))
+}
+
+func fieldChange(path string, old, new interface{}) cluster.FieldChange {
+	return cluster.FieldChange{
+		Path: path,
+		Old:  encodeValue(old),
+		New:  encodeValue(new),
+	}
+}
+
+func encodeValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(bytes)
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"context"
+	"strings"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+)
+
+// State is where the progress of syncing is recorded: the revision
+// most recently synced, so that the next sync can tell what has
+// changed since.
+type State interface {
+	// GetRevision returns the revision last recorded as synced, or
+	// the empty string if nothing has been recorded yet.
+	GetRevision(ctx context.Context) (string, error)
+	// UpdateMarker records the revision given as synced, along with
+	// the notes of the commits synced, by revision (if there are
+	// any) -- the equivalent of the notes on the commits, for a State
+	// kept outside the repo.
+	UpdateMarker(ctx context.Context, revision string, notes map[string]job.Note) error
+	// GetNotes returns the notes recorded with the last sync, if the
+	// State keeps them.
+	GetNotes(ctx context.Context) (map[string]job.Note, error)
+}
+
+// GitTagState records sync progress by moving a tag in the git repo
+// (the sync tag given in the checkout's config), and pushing it
+// upstream.
+type GitTagState struct {
+	working *git.Checkout
+}
+
+func NewGitTagState(working *git.Checkout) *GitTagState {
+	return &GitTagState{working: working}
+}
+
+func (s *GitTagState) GetRevision(ctx context.Context) (string, error) {
+	rev, err := s.working.SyncRevision(ctx)
+	if isUnknownRevision(err) {
+		return "", nil
+	}
+	return rev, err
+}
+
+// UpdateMarker moves the sync tag to the revision given. The notes
+// are already attached to the commits, so aren't recorded again.
+func (s *GitTagState) UpdateMarker(ctx context.Context, revision string, notes map[string]job.Note) error {
+	return s.working.MoveSyncTagAndPush(ctx, revision, "Sync pointer")
+}
+
+// GetNotes returns nothing, since the notes are kept on the commits.
+func (s *GitTagState) GetNotes(ctx context.Context) (map[string]job.Note, error) {
+	return nil, nil
+}
+
+func isUnknownRevision(err error) bool {
+	return err != nil &&
+		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
+			strings.Contains(err.Error(), "bad revision"))
+}
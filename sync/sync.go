@@ -9,41 +9,99 @@ import (
 	"github.com/weaveworks/flux/resource"
 )
 
-// Sync synchronises the cluster to the files in a directory
-func Sync(logger log.Logger, m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster,
-	deletes bool) error {
+// SyncSet is a named set of resources from the repo, e.g., those
+// from one git source. Resources applied as part of a sync set are
+// marked with its name, so that they can be found (and garbage
+// collected) later.
+type SyncSet struct {
+	Name      string
+	Resources map[string]resource.Resource
+}
+
+// Sync synchronises the cluster to the files in a directory. If
+// deletes is true, resources that were previously applied as part of
+// the same sync set, but are no longer in the repo, are deleted. It
+// returns the definition of the sync it attempted, so that callers
+// can report on what was done.
+func Sync(logger log.Logger, m cluster.Manifests, syncSetName string, repoResources map[string]resource.Resource, clus cluster.Cluster,
+	deletes bool) (cluster.SyncDef, error) {
+	return SyncSets(logger, m, []SyncSet{{Name: syncSetName, Resources: repoResources}}, clus, deletes)
+}
+
+// SyncSets is Sync for several sync sets at once. A resource is only
+// deleted if it is no longer in any of the sync sets, so it can move
+// from one to another without being deleted in between.
+func SyncSets(logger log.Logger, m cluster.Manifests, syncSets []SyncSet, clus cluster.Cluster,
+	deletes bool) (cluster.SyncDef, error) {
+	sync, _, err := prepareSync(logger, m, syncSets, clus, deletes)
+	if err != nil {
+		return sync, err
+	}
+	return sync, clus.Sync(sync)
+}
+
+// prepareSync works out what needs to be done to synchronise the
+// cluster, returning the sync definition along with the resources
+// exported from the cluster, for comparison.
+func prepareSync(logger log.Logger, m cluster.Manifests, syncSets []SyncSet, clus cluster.Cluster,
+	deletes bool) (cluster.SyncDef, map[string]resource.Resource, error) {
+	var sync cluster.SyncDef
+
 	// Get a map of resources defined in the cluster
 	clusterBytes, err := clus.Export()
 
 	if err != nil {
-		return errors.Wrap(err, "exporting resource defs from cluster")
+		return sync, nil, errors.Wrap(err, "exporting resource defs from cluster")
 	}
 	clusterResources, err := m.ParseManifests(clusterBytes)
 	if err != nil {
-		return errors.Wrap(err, "parsing exported resources")
+		return sync, nil, errors.Wrap(err, "parsing exported resources")
 	}
 
-	// Everything that's in the cluster but not in the repo, delete;
-	// everything that's in the repo, apply. This is an approximation
-	// to figuring out what's changed, and applying that. We're
-	// relying on Kubernetes to decide for each application if it is a
-	// no-op.
-	sync := cluster.SyncDef{}
+	repoResources := map[string]resource.Resource{}
+	for _, set := range syncSets {
+		for id, res := range set.Resources {
+			repoResources[id] = res
+		}
+	}
 
-	// DANGER ZONE (tamara) This works and is dangerous. At the moment will delete Flux and
-	// other pods unless the relevant manifests are part of the user repo. Needs a lot of thought
-	// before this cleanup cluster feature can be unleashed on the world.
+	// Everything that was applied from a sync set but is no longer in
+	// the repo, delete; everything that's in the repo, apply. This
+	// is an approximation to figuring out what's changed, and
+	// applying that. We're relying on Kubernetes to decide for each
+	// application if it is a no-op.
+	//
+	// Only resources bearing the mark of one of the sync sets are
+	// considered for deletion, so fluxd itself, and anything created
+	// by other means, is left alone.
 	if deletes {
-		for id, res := range clusterResources {
-			prepareSyncDelete(logger, repoResources, id, res, &sync)
+		for _, set := range syncSets {
+			// An empty sync set is more likely a mistake than a
+			// request to delete everything
+			if len(set.Resources) == 0 {
+				continue
+			}
+			syncSetBytes, err := clus.ExportSyncSet(set.Name)
+			if err != nil {
+				return sync, nil, errors.Wrap(err, "exporting sync set from cluster")
+			}
+			syncSetResources, err := m.ParseManifests(syncSetBytes)
+			if err != nil {
+				return sync, nil, errors.Wrap(err, "parsing exported sync set")
+			}
+			for id, res := range syncSetResources {
+				prepareSyncDelete(logger, repoResources, id, res, &sync)
+			}
 		}
 	}
 
-	for id, res := range repoResources {
-		prepareSyncApply(logger, clusterResources, id, res, &sync)
+	for _, set := range syncSets {
+		for id, res := range set.Resources {
+			prepareSyncApply(logger, clusterResources, set.Name, id, res, &sync)
+		}
 	}
 
-	return clus.Sync(sync)
+	return sync, clusterResources, nil
 }
 
 func prepareSyncDelete(logger log.Logger, repoResources map[string]resource.Resource, id string, res resource.Resource, sync *cluster.SyncDef) {
@@ -61,7 +119,7 @@ func prepareSyncDelete(logger log.Logger, repoResources map[string]resource.Reso
 	}
 }
 
-func prepareSyncApply(logger log.Logger, clusterResources map[string]resource.Resource, id string, res resource.Resource, sync *cluster.SyncDef) {
+func prepareSyncApply(logger log.Logger, clusterResources map[string]resource.Resource, syncSetName, id string, res resource.Resource, sync *cluster.SyncDef) {
 	if res.Policy().Has(policy.Ignore) {
 		logger.Log("resource", res.ResourceID(), "ignore", "apply")
 		return
@@ -73,6 +131,7 @@ func prepareSyncApply(logger log.Logger, clusterResources map[string]resource.Re
 		}
 	}
 	sync.Actions = append(sync.Actions, cluster.SyncAction{
-		Apply: res,
+		Apply:   res,
+		SyncSet: syncSetName,
 	})
 }
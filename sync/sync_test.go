@@ -11,8 +11,10 @@ import (
 
 	"github.com/go-kit/kit/log"
 
-	//	"github.com/weaveworks/flux"
 	"context"
+	"io/ioutil"
+
+	"github.com/weaveworks/flux"
 
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
@@ -32,7 +34,7 @@ func TestSync(t *testing.T) {
 	// Start with nothing running. We should be told to apply all the things.
 	mockCluster := &cluster.Mock{}
 	manifests := &kubernetes.Manifests{}
-	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}}
+	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}, map[string]string{}}
 
 	dirs := checkout.ManifestDirs()
 	resources, err := manifests.LoadManifests(checkout.Dir(), dirs)
@@ -40,7 +42,7 @@ func TestSync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := Sync(log.NewNopLogger(), manifests, resources, clus, true); err != nil {
+	if _, err := Sync(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.Dir(), dirs)
@@ -60,12 +62,184 @@ func TestSync(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := Sync(log.NewNopLogger(), manifests, resources, clus, true); err != nil {
+	if _, err := Sync(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.Dir(), dirs)
 }
 
+// Resources that weren't applied as part of the sync set must be left
+// alone, even when they're not in the repo.
+func TestSyncLeavesUnmarkedResources(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}
+
+	handmade := []byte(`---
+apiVersion: v1
+kind: Service
+metadata:
+  name: handmade
+  namespace: default
+`)
+	clus.resources["default:service/handmade"] = handmade
+	other := []byte(`---
+apiVersion: v1
+kind: Service
+metadata:
+  name: other
+  namespace: default
+`)
+	clus.resources["default:service/other"] = other
+	clus.syncSets["default:service/other"] = "other-sync-set"
+
+	resources, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := Sync(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range def.Actions {
+		if action.Delete != nil {
+			t.Errorf("expected no deletes, got %s", action.Delete.ResourceID())
+		}
+	}
+	for _, id := range []string{"default:service/handmade", "default:service/other"} {
+		if _, ok := clus.resources[id]; !ok {
+			t.Errorf("expected %s to be left in the cluster", id)
+		}
+	}
+}
+
+// Each resource is marked with its own sync set, so adding a sync set
+// leaves the others' marks alone; and a resource that moves from one
+// sync set to another is not deleted.
+func TestSyncSets(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}
+
+	resources, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(log.NewNopLogger(), manifests, "first", resources, clus, true); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := "default:deployment/helloworld"
+	first, second := map[string]resource.Resource{}, map[string]resource.Resource{}
+	for id, res := range resources {
+		if id == moved {
+			second[id] = res
+		} else {
+			first[id] = res
+		}
+	}
+	def, err := SyncSets(log.NewNopLogger(), manifests, []SyncSet{{Name: "first", Resources: first}, {Name: "second", Resources: second}}, clus, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range def.Actions {
+		if action.Delete != nil {
+			t.Errorf("expected no deletes, got %s", action.Delete.ResourceID())
+		}
+	}
+	for id := range resources {
+		expected := "first"
+		if id == moved {
+			expected = "second"
+		}
+		if clus.syncSets[id] != expected {
+			t.Errorf("expected %s to be in sync set %q, got %q", id, expected, clus.syncSets[id])
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}
+
+	dirs := checkout.ManifestDirs()
+	resources, err := manifests.LoadManifests(checkout.Dir(), dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has changed, so there should be nothing to report
+	changes, err := DryRun(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	// Change a field in one definition, and remove another resource
+	// altogether
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	files := testfiles.ServiceMap(checkout.Dir())
+	if err := ioutil.WriteFile(files[helloworld][0], []byte(strings.Replace(testfiles.Files["helloworld-deploy.yaml"], "replicas: 5", "replicas: 3", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	removed := flux.MustParseResourceID("default:deployment/semver")
+	if err := os.Remove(files[removed][0]); err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err = manifests.LoadManifests(checkout.Dir(), dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err = DryRun(log.NewNopLogger(), manifests, "test-sync-set", resources, clus, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[flux.ResourceID]cluster.ResourceChange{
+		helloworld: {
+			ID:     helloworld,
+			Type:   cluster.SyncUpdate,
+			Source: "helloworld-deploy.yaml",
+			Fields: []cluster.FieldChange{{Path: "spec.replicas", Old: "5", New: "3"}},
+		},
+	}
+	got := map[flux.ResourceID]cluster.ResourceChange{}
+	for _, c := range changes {
+		switch c.ID {
+		case removed:
+			if c.Type != cluster.SyncDelete {
+				t.Errorf("expected %s to be deleted, got %q", removed, c.Type)
+			}
+		default:
+			got[c.ID] = c
+		}
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected two changes, got %+v", changes)
+	}
+
+	// .. and it's only a dry run, so the cluster is unchanged
+	if _, ok := clus.resources[removed.String()]; !ok {
+		t.Errorf("expected %s to still be in the cluster", removed)
+	}
+}
+
 func TestPrepareSyncDelete(t *testing.T) {
 	var tests = []struct {
 		msg      string
@@ -162,7 +336,7 @@ func TestPrepareSyncApply(t *testing.T) {
 	logger := log.NewNopLogger()
 	for _, sc := range tests {
 		sync := &cluster.SyncDef{}
-		prepareSyncApply(logger, sc.clusRes, sc.res.ResourceID().String(), sc.res, sync)
+		prepareSyncApply(logger, sc.clusRes, "", sc.res.ResourceID().String(), sc.res, sync)
 
 		if !reflect.DeepEqual(sc.expected, sync) {
 			t.Errorf("%s: expected %+v, got %+v\n", sc.msg, sc.expected, sync)
@@ -198,6 +372,7 @@ func execCommand(cmd string, args ...string) error {
 type syncCluster struct {
 	*cluster.Mock
 	resources map[string][]byte
+	syncSets  map[string]string // resource ID -> sync set it was applied as part of
 }
 
 func (p *syncCluster) Sync(def cluster.SyncDef) error {
@@ -206,10 +381,12 @@ func (p *syncCluster) Sync(def cluster.SyncDef) error {
 		if action.Delete != nil {
 			println("Deleting " + action.Delete.ResourceID().String())
 			delete(p.resources, action.Delete.ResourceID().String())
+			delete(p.syncSets, action.Delete.ResourceID().String())
 		}
 		if action.Apply != nil {
 			println("Applying " + action.Apply.ResourceID().String())
 			p.resources[action.Apply.ResourceID().String()] = action.Apply.Bytes()
+			p.syncSets[action.Apply.ResourceID().String()] = action.SyncSetName(def)
 		}
 	}
 	println("=== Done syncing ===")
@@ -226,6 +403,16 @@ func (p *syncCluster) Export() ([]byte, error) {
 	return bytes.Join(configs, []byte("\n---\n")), nil
 }
 
+func (p *syncCluster) ExportSyncSet(syncSetName string) ([]byte, error) {
+	var configs [][]byte
+	for id, config := range p.resources {
+		if p.syncSets[id] == syncSetName {
+			configs = append(configs, config)
+		}
+	}
+	return bytes.Join(configs, []byte("\n---\n")), nil
+}
+
 func resourcesToStrings(resources map[string]resource.Resource) map[string]string {
 	res := map[string]string{}
 	for k, r := range resources {
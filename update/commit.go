@@ -0,0 +1,82 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/weaveworks/flux"
+)
+
+// CommitMessageData is what a commit message template is given.
+type CommitMessageData struct {
+	// The message the commit would have had without a template
+	Message string
+	Cause   Cause
+	Result  Result
+	// The images released, and the resources changed, in order
+	Images    []string
+	Resources []flux.ResourceID
+	// The spec of the update, e.g., a ReleaseImageSpec, or
+	// policy.Updates
+	Spec interface{}
+}
+
+// CommitTemplates are templates for the messages of the commits made
+// for each kind of update. Where a template is nil, the usual message
+// is used.
+type CommitTemplates struct {
+	AutoRelease *template.Template
+	Release     *template.Template
+	Policy      *template.Template
+}
+
+var commitTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// ParseCommitTemplate parses a commit message template, so that
+// syntax errors are found before any commits are made. It isn't tried
+// out on any data, since what's valid (e.g., `{{ index .Images 0 }}`,
+// or fields of `.Spec`) depends on the update; a template that fails
+// for an update fails that update.
+func ParseCommitTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(commitTemplateFuncs).Parse(text)
+}
+
+// Message gives the message for the commit of an update, using the
+// template for the kind of update if there is one, or otherwise the
+// default message given.
+func (ts CommitTemplates) Message(spec Spec, result Result, defaultMessage string) (string, error) {
+	var t *template.Template
+	switch spec.Type {
+	case Auto:
+		t = ts.AutoRelease
+	case Images, Containers, Promote:
+		t = ts.Release
+	case Policy:
+		t = ts.Policy
+	}
+	if t == nil {
+		return defaultMessage, nil
+	}
+
+	resources := result.AffectedResources()
+	resources.Sort()
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, CommitMessageData{
+		Message:   defaultMessage,
+		Cause:     spec.Cause,
+		Result:    result,
+		Images:    result.ChangedImages(),
+		Resources: resources,
+		Spec:      spec.Spec,
+	}); err != nil {
+		return "", fmt.Errorf("executing commit message template %q: %s", t.Name(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,91 @@
+package update
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestCommitTemplates(t *testing.T) {
+	release, err := ParseCommitTemplate("release", `chore(release): {{ join .Images ", " }}{{ if .Cause.Message }} ({{ .Cause.Message }}){{ end }}
+{{ range .Resources }}
+- {{ . }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := CommitTemplates{Release: release}
+
+	ref, err := image.ParseRef("quay.io/weaveworks/helloworld:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Result{
+		flux.MustParseResourceID("default:deployment/b"): ControllerResult{
+			Status:       ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{{Container: "greeter", Target: ref}},
+		},
+		flux.MustParseResourceID("default:deployment/a"): ControllerResult{
+			Status:       ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{{Container: "greeter", Target: ref}},
+		},
+		flux.MustParseResourceID("default:deployment/c"): ControllerResult{
+			Status: ReleaseStatusSkipped,
+		},
+	}
+
+	spec := Spec{Type: Images, Cause: Cause{Message: "JIRA-123"}}
+	msg, err := templates.Message(spec, result, "Release quay.io/weaveworks/helloworld:2 to <all>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `chore(release): quay.io/weaveworks/helloworld:2 (JIRA-123)
+
+- default:deployment/a
+- default:deployment/b`
+	if msg != expected {
+		t.Errorf("expected message:\n%s\ngot:\n%s", expected, msg)
+	}
+
+	// No template for policy updates, so the default is used
+	spec = Spec{Type: Policy}
+	msg, err = templates.Message(spec, result, "Automated: default:deployment/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "Automated: default:deployment/a" {
+		t.Errorf("expected the default message, got %q", msg)
+	}
+}
+
+func TestParseCommitTemplate_Invalid(t *testing.T) {
+	for _, text := range []string{
+		`{{ .Message `,
+		`{{ nosuchfunc .Message }}`,
+	} {
+		if _, err := ParseCommitTemplate("test", text); err == nil {
+			t.Errorf("expected an error from %q", text)
+		}
+	}
+}
+
+// Templates that depend on the update, e.g., on there being an image
+// released, are valid; it's only when they're used for an update that
+// they can fail.
+func TestCommitTemplates_ExecuteError(t *testing.T) {
+	for _, text := range []string{
+		`{{ index .Images 0 }}`,
+		`{{ .Spec.ImageSpec }}`,
+		`{{ .NoSuchField }}`,
+	} {
+		release, err := ParseCommitTemplate("release", text)
+		if err != nil {
+			t.Errorf("expected %q to parse, got %s", text, err)
+			continue
+		}
+		templates := CommitTemplates{Release: release}
+		if _, err := templates.Message(Spec{Type: Images}, Result{}, "Release"); err == nil {
+			t.Errorf("expected an error executing %q for an empty update", text)
+		}
+	}
+}
@@ -14,6 +14,7 @@ const (
 	DifferentImage       = "a different image"
 	NotInCluster         = "not running in cluster"
 	NotInRepo            = "not found in repository"
+	InSubmodule          = "defined in a git submodule"
 	ImageNotFound        = "cannot find one or more images"
 	ImageUpToDate        = "image(s) up to date"
 	DoesNotUseImage      = "does not use image(s)"
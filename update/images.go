@@ -56,7 +56,7 @@ func (ii ImageInfos) FilterAndSort(pattern policy.Pattern) SortedImageInfos {
 	filtered := ii.Filter(pattern)
 	// Do not call sortImages() here which will clone the list that we already
 	// cloned in ImageInfos.Filter()
-	image.Sort(filtered, pattern.Newer)
+	sortByPattern(filtered, pattern)
 	return SortedImageInfos(filtered)
 }
 
@@ -91,22 +91,62 @@ func (is SortedImageInfos) Sort(pattern policy.Pattern) SortedImageInfos {
 	return sortImages(is, pattern)
 }
 
+// NewerThan returns the images that come before the image given,
+// when it is sorted along with them according to the pattern. This
+// agrees with the order of the list even for patterns that don't
+// compare consistently pair by pair (e.g., a label with a mix of
+// timestamp and other values).
+func (is SortedImageInfos) NewerThan(current image.Info, pattern policy.Pattern) SortedImageInfos {
+	all := make([]image.Info, 0, len(is)+1)
+	found := false
+	for _, img := range is {
+		if img.ID == current.ID {
+			found = true
+		}
+		all = append(all, img)
+	}
+	if !found {
+		all = append(all, current)
+	}
+	sortByPattern(all, pattern)
+
+	var newer SortedImageInfos
+	for _, img := range all {
+		if img.ID == current.ID {
+			break
+		}
+		newer = append(newer, img)
+	}
+	return newer
+}
+
 func sortImages(images []image.Info, pattern policy.Pattern) SortedImageInfos {
 	var sorted SortedImageInfos
 	for _, i := range images {
 		sorted = append(sorted, i)
 	}
-	image.Sort(sorted, pattern.Newer)
+	sortByPattern(sorted, pattern)
 	return sorted
 }
 
+// sortByPattern orders the images in place according to the pattern.
+// Images ordered by a label are sorted all together, so that their
+// labels are all compared the same way.
+func sortByPattern(images []image.Info, pattern policy.Pattern) {
+	if byLabel, ok := pattern.(policy.LabelOrderPattern); ok {
+		image.SortByLabel(images, byLabel.Label)
+		return
+	}
+	image.Sort(images, pattern.Newer)
+}
+
 // filterImages keeps the sort order pristine.
 func filterImages(images []image.Info, pattern policy.Pattern) ImageInfos {
 	var filtered ImageInfos
 	for _, i := range images {
 		tag := i.ID.Tag
 		// Ignore latest if and only if it's not what the user wants.
-		if pattern != policy.PatternLatest && strings.EqualFold(tag, "latest") {
+		if pattern.String() != policy.PatternLatest.String() && strings.EqualFold(tag, "latest") {
 			continue
 		}
 		if pattern.Matches(tag) {
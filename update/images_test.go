@@ -93,3 +93,40 @@ func mustParseName(im string) image.Name {
 	}
 	return ref.Name
 }
+
+func TestImageInfos_Sort_label(t *testing.T) {
+	at := time.Now()
+	build := func(tag, number string) image.Info {
+		return image.Info{
+			ID:        image.Ref{Name: image.Name{Image: "moon"}, Tag: tag},
+			CreatedAt: at,
+			Labels:    map[string]string{"build": number},
+		}
+	}
+	latest, b9, b10 := build("latest", "11"), build("master-b", "9"), build("master-a", "10")
+
+	ii := ImageInfos{latest, b9, b10}
+	assert.Equal(t, SortedImageInfos{b10, b9}, ii.FilterAndSort(policy.LabelOrderPattern{Pattern: policy.NewPattern("master-*"), Label: "build"}))
+	assert.Equal(t, SortedImageInfos{latest}, ii.FilterAndSort(policy.LabelOrderPattern{Pattern: policy.PatternLatest, Label: "build"}))
+}
+
+func TestSortedImageInfos_NewerThan_label(t *testing.T) {
+	at := time.Now()
+	build := func(tag, number string) image.Info {
+		return image.Info{
+			ID:        image.Ref{Name: image.Name{Image: "moon"}, Tag: tag},
+			CreatedAt: at,
+			Labels:    map[string]string{"build": number},
+		}
+	}
+	// Compared by themselves, "10" is newer than "9" as a version; but
+	// the mix of values means they are all compared as strings.
+	named, b9, b10 := build("named", "b"), build("nine", "9"), build("ten", "10")
+	pattern := policy.LabelOrderPattern{Pattern: policy.PatternAll, Label: "build"}
+
+	sorted := ImageInfos{b10, b9, named}.Sort(pattern)
+	assert.Equal(t, SortedImageInfos{named, b9, b10}, sorted)
+	assert.Equal(t, SortedImageInfos{named}, sorted.NewerThan(b9, pattern))
+	assert.Equal(t, SortedImageInfos{named, b9}, sorted.NewerThan(b10, pattern))
+	assert.Equal(t, SortedImageInfos{named, b9, b10}, sorted.NewerThan(image.Info{ID: image.Ref{Name: image.Name{Image: "moon"}, Tag: "old"}}, pattern))
+}
@@ -0,0 +1,44 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PromoteSpec defines the spec for a `promote` manifest update, which
+// sets the images of the workloads defined under one path in the
+// repo (e.g., a staging environment) in the matching workloads
+// defined under another (e.g., production). Workloads match if they
+// have the same kind and name; the namespace may differ.
+type PromoteSpec struct {
+	From string // the path with the workloads whose images are promoted
+	To   string // the path with the workloads to promote them to
+	// The workloads under From to promote; ResourceSpecAll means all
+	// of them
+	Workloads []ResourceSpec
+	Kind      ReleaseKind
+	Force     bool
+}
+
+func (s PromoteSpec) ReleaseKind() ReleaseKind {
+	return s.Kind
+}
+
+func (s PromoteSpec) ReleaseType() ReleaseType {
+	return "promote"
+}
+
+func (s PromoteSpec) CommitMessage(result Result) string {
+	body := &bytes.Buffer{}
+	for _, res := range result.AffectedResources() {
+		fmt.Fprintf(body, "\n%s", res)
+		for _, upd := range result[res].PerContainer {
+			fmt.Fprintf(body, "\n- %s", upd.Target)
+		}
+		fmt.Fprintln(body)
+	}
+	if err := result.Error(); err != "" {
+		fmt.Fprintf(body, "\n%s", result.Error())
+	}
+	return fmt.Sprintf("Promote images from %s to %s\n%s", s.From, s.To, body.String())
+}
@@ -233,6 +233,9 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 					tagPattern = policy.NewPattern(pattern)
 				}
 			}
+			// Images are ordered by the container's sort label (if
+			// any) whether or not the filter is used.
+			tagPattern = policy.WithSortLabel(u.Resource.Policy(), container.Name, tagPattern)
 
 			filteredImages := imageRepos.GetRepoImages(currentImageID.Name).FilterAndSort(tagPattern)
 			latestImage, ok := filteredImages.Latest()
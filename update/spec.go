@@ -13,6 +13,7 @@ const (
 	Auto       = "auto"
 	Sync       = "sync"
 	Containers = "containers"
+	Promote    = "promote"
 )
 
 // How did this update get triggered?
@@ -72,6 +73,12 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case Promote:
+		var update PromoteSpec
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	default:
 		return errors.New("unknown spec type: " + wire.Type)
 	}